@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"steam_bot/steam"
+	"steam_bot/utils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// ----- Cache Administration -----
+
+const cacheUsage = "Usage: <code>/cache</code>, <code>/cache clear name</code> or <code>/cache drop appid</code>"
+
+// NewCacheCommandHandler returns the handler for "/cache [clear <name>|drop <appid>]",
+// which only answers the given admins
+func NewCacheCommandHandler(base context.Context, adminIDs []int64, caches *steam.CacheSet) func(b *gotgbot.Bot, ctx *ext.Context) error {
+	return func(b *gotgbot.Bot, ctx *ext.Context) error {
+		if ctx.EffectiveUser == nil || !slices.Contains(adminIDs, ctx.EffectiveUser.Id) {
+			return nil
+		}
+		return HandleCacheCommand(base, b, ctx, caches)
+	}
+}
+
+// HandleCacheCommand shows cache stats, clears a cache or drops one app from every cache
+func HandleCacheCommand(base context.Context, b *gotgbot.Bot, ctx *ext.Context, caches *steam.CacheSet) error {
+	args := commandArgs(ctx.EffectiveMessage.Text)
+
+	var reply string
+	switch {
+	case len(args) == 0:
+		reply = formatCacheStats(caches.All())
+	case len(args) == 2 && args[0] == "clear":
+		reply = clearCache(updateContext(base, ctx), caches, args[1])
+	case len(args) == 2 && args[0] == "drop":
+		reply = dropCachedApp(updateContext(base, ctx), caches, args[1])
+	default:
+		reply = cacheUsage
+	}
+
+	_, err := ctx.EffectiveMessage.Reply(b, reply, &gotgbot.SendMessageOpts{ParseMode: "HTML"})
+	return err
+}
+
+// clearCache empties the named cache
+func clearCache(ctx context.Context, caches *steam.CacheSet, name string) string {
+	c, ok := caches.Lookup(name)
+	if !ok {
+		var names []string
+		for _, c := range caches.All() {
+			names = append(names, c.Name())
+		}
+		return fmt.Sprintf("Unknown cache <code>%s</code>. Caches: %s.", html.EscapeString(name), strings.Join(names, ", "))
+	}
+
+	size := c.Size()
+	c.Clear()
+	slog.InfoContext(ctx, "Cleared cache", "cache", name, "entries", size)
+	return fmt.Sprintf("Cleared <b>%s</b> (%d entries).", name, size)
+}
+
+// dropCachedApp removes one app from every cache so its next lookup is fresh
+func dropCachedApp(ctx context.Context, caches *steam.CacheSet, appID string) string {
+	if _, err := strconv.Atoi(appID); err != nil {
+		return "Please give a numeric Steam app ID, e.g. <code>/cache drop 620</code>."
+	}
+
+	n := caches.DropApp(appID)
+	slog.InfoContext(ctx, "Dropped app from the caches", utils.LogKeyAppID, appID, "entries", n)
+	return fmt.Sprintf("Dropped %d cached entries for app <code>%s</code>.", n, appID)
+}
+
+// formatCacheStats renders one table row per cache
+func formatCacheStats(caches []steam.CacheInspector) string {
+	var sb strings.Builder
+	sb.WriteString("<b>Caches</b>\n<pre>")
+	fmt.Fprintf(&sb, "%-16s %6s %8s %6s %7s %6s %6s %5s\n", "name", "size", "hits", "stale", "misses", "evict", "expire", "hit%")
+	for _, c := range caches {
+		s := c.Stats()
+		fmt.Fprintf(&sb, "%-16s %6d %8d %6d %7d %6d %6d %5.1f\n",
+			c.Name(), c.Size(), s.Hits, s.StaleHits, s.Misses, s.Evictions, s.Expirations, s.HitRatio()*100)
+	}
+	sb.WriteString("</pre>\n")
+	sb.WriteString(cacheUsage)
+	return sb.String()
+}
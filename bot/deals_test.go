@@ -0,0 +1,216 @@
+package bot
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"steam_bot/internal/fakeupstream"
+	"steam_bot/steam"
+	"steam_bot/store"
+	"steam_bot/utils"
+)
+
+// Deal IDs from the fake CheapShark fixture
+const (
+	portal2DealID = "JTKDNcuBdLvqkk5%2FeETXqxBWwbAY2wqcmsOR5PiFY8M%3D"
+	portalDealID  = "ZfY9sYHwmJLy2HqNNqzWYkQRDXEbCaTPNsWdYpSqdNM%3D"
+	gooseDealID   = "u9fGuBxePfTlUgQcBPBJ%2FcqV7xt9hLXTVtyUeBJVyW8%3D"
+)
+
+// startFakeUpstream returns a Steam client whose every upstream is a fresh fake server
+func startFakeUpstream(t *testing.T, opts ...steam.ClientOption) (*fakeupstream.Server, *steam.Client) {
+	t.Helper()
+
+	srv := fakeupstream.Start()
+	t.Cleanup(srv.Close)
+
+	client := steam.NewClient(append([]steam.ClientOption{
+		steam.WithStoreURL(srv.URL()),
+		steam.WithWebAPIURL(srv.URL()),
+		steam.WithCheapSharkURL(srv.URL()),
+		steam.WithExchangeRatesURL(srv.URL()),
+		steam.WithHTTPClient(utils.NewClient(utils.WithMaxAttempts(1))),
+		steam.WithAPIKey(fakeupstream.APIKey),
+		steam.WithDefaultCountry("in"), // the store fixtures are priced in INR
+	}, opts...)...)
+	return srv, client
+}
+
+func newDealChannel(t *testing.T, seen ...string) *DealChannel {
+	t.Helper()
+
+	ledger := store.NewMemoryLedger(store.RetentionPolicy{})
+	for _, dealID := range seen {
+		if err := ledger.Mark(dealID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A ledger with history has been through its first run
+	if len(seen) > 0 {
+		if err := ledger.MarkSeeded(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &DealChannel{
+		Name:     "test",
+		ChatID:   -1001234567890,
+		Filter:   steam.DefaultDealFilter,
+		Interval: time.Hour,
+		Template: "default",
+		Ledger:   ledger,
+	}
+}
+
+func TestCheckAndSendDealsPostsUnseenDeals(t *testing.T) {
+	_, client := startFakeUpstream(t)
+	telegram, b := startFakeTelegram(t)
+	ch := newDealChannel(t, portal2DealID, portalDealID)
+
+	checkAndSendDeals(context.Background(), b, client, []*DealChannel{ch}, NewHealth(client))
+
+	sent := telegram.Calls("sendMessage")
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(sent))
+	}
+	msg := sent[0].Params
+	if msg["chat_id"] != "-1001234567890" {
+		t.Errorf("chat_id = %s", msg["chat_id"])
+	}
+	if !strings.Contains(msg["text"], "Untitled Goose Game") || !strings.Contains(msg["text"], "Steam") {
+		t.Errorf("text = %q, want the Goose deal on Steam", msg["text"])
+	}
+	if !strings.Contains(msg["reply_markup"], steam.DealRedirectURL(gooseDealID)) {
+		t.Errorf("reply_markup = %s, want the deal's redirect link", msg["reply_markup"])
+	}
+	if !ch.Ledger.Has(gooseDealID) {
+		t.Error("posted deal was not recorded in the ledger")
+	}
+}
+
+func TestCheckAndSendDealsSeedsEmptyLedger(t *testing.T) {
+	_, client := startFakeUpstream(t)
+	telegram, b := startFakeTelegram(t)
+	ch := newDealChannel(t)
+
+	checkAndSendDeals(context.Background(), b, client, []*DealChannel{ch}, NewHealth(client))
+
+	if sent := telegram.Calls("sendMessage"); len(sent) != 0 {
+		t.Errorf("sent %d messages on the first run, want none", len(sent))
+	}
+	for _, dealID := range []string{portal2DealID, portalDealID, gooseDealID} {
+		if !ch.Ledger.Has(dealID) {
+			t.Errorf("deal %s was not seeded", dealID)
+		}
+	}
+}
+
+func TestCheckAndSendDealsSeedsOnlyOnce(t *testing.T) {
+	_, client := startFakeUpstream(t)
+	telegram, b := startFakeTelegram(t)
+	path := filepath.Join(t.TempDir(), "ledger.json")
+
+	// The first run matches nothing, leaving the ledger empty
+	ledger, err := store.NewFileLedger(path, store.RetentionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := newDealChannel(t)
+	ch.Ledger = ledger
+	ch.Filter.MaxPrice = 0.5
+	checkAndSendDeals(context.Background(), b, client, []*DealChannel{ch}, NewHealth(client))
+	if err := ledger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart, the first matching deal is posted rather than seeded
+	ledger, err = store.NewFileLedger(path, store.RetentionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ledger.Len() != 0 || !ledger.Seeded() {
+		t.Fatalf("reopened ledger has %d deals, seeded %t; want an empty seeded ledger", ledger.Len(), ledger.Seeded())
+	}
+	ch = newDealChannel(t)
+	ch.Ledger = ledger
+	ch.Filter.ExcludedTitles = []string{"Portal"}
+	checkAndSendDeals(context.Background(), b, client, []*DealChannel{ch}, NewHealth(client))
+
+	sent := telegram.Calls("sendMessage")
+	if len(sent) != 1 || !strings.Contains(sent[0].Params["text"], "Untitled Goose Game") {
+		t.Errorf("sent %+v, want the Goose deal", sent)
+	}
+}
+
+func TestCheckAndSendDealsSurvivesCheapSharkOutage(t *testing.T) {
+	srv, client := startFakeUpstream(t)
+	srv.Fail("/api/1.0/deals", 503)
+	telegram, b := startFakeTelegram(t)
+	ch := newDealChannel(t, portal2DealID)
+
+	checkAndSendDeals(context.Background(), b, client, []*DealChannel{ch}, NewHealth(client))
+
+	if len(telegram.Calls("sendMessage")) != 0 || ch.Ledger.Len() != 1 {
+		t.Error("deals were posted or recorded during the outage")
+	}
+	// The channel is retried on the next tick
+	if !ch.lastRun.IsZero() {
+		t.Error("failed check counted as a run")
+	}
+}
+
+func TestChannelsRunOnTheirOwnIntervals(t *testing.T) {
+	hourly := &DealChannel{Name: "hourly", Interval: time.Hour}
+	slow := &DealChannel{Name: "slow", Interval: 90 * time.Minute}
+	channels := []*DealChannel{hourly, slow}
+
+	tick := pollInterval(channels)
+	if tick != 30*time.Minute {
+		t.Fatalf("poll interval = %s, want 30m", tick)
+	}
+
+	runs := map[string][]time.Duration{}
+	start := time.Now()
+	for elapsed := time.Duration(0); elapsed <= 6*time.Hour; elapsed += tick {
+		// Tickers may fire a little early or late
+		now := start.Add(elapsed + time.Duration(elapsed/tick%3-1)*time.Second)
+		for _, ch := range dueChannels(channels, now) {
+			ch.lastRun = now
+			runs[ch.Name] = append(runs[ch.Name], elapsed)
+		}
+	}
+
+	for _, ch := range channels {
+		for i, at := range runs[ch.Name] {
+			if want := time.Duration(i) * ch.Interval; at != want {
+				t.Errorf("%s ran at %v, want every %s", ch.Name, runs[ch.Name], ch.Interval)
+				break
+			}
+		}
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	tests := []struct {
+		intervals []time.Duration
+		want      time.Duration
+	}{
+		{[]time.Duration{time.Hour}, time.Hour},
+		{[]time.Duration{time.Hour, 3 * time.Hour}, time.Hour},
+		{[]time.Duration{time.Hour, 90 * time.Minute}, 30 * time.Minute},
+		{[]time.Duration{45 * time.Minute, time.Hour, 2 * time.Hour}, 15 * time.Minute},
+		{[]time.Duration{time.Hour, time.Hour + time.Second}, time.Second},
+		{[]time.Duration{time.Hour, time.Hour + 300*time.Millisecond}, time.Hour}, // rounded to seconds
+	}
+	for _, tt := range tests {
+		var channels []*DealChannel
+		for _, interval := range tt.intervals {
+			channels = append(channels, &DealChannel{Interval: interval})
+		}
+		if got := pollInterval(channels); got != tt.want {
+			t.Errorf("pollInterval(%v) = %s, want %s", tt.intervals, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"steam_bot/steam"
+	"steam_bot/tracing"
+	"steam_bot/utils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// ----- Upstream Requests -----
+
+// requestTimeout bounds the upstream calls made while handling a single update
+const requestTimeout = 20 * time.Second
+
+// newRequestContext returns the context for upstream calls made while handling an
+// update, derived from parent so their log lines identify the update
+func newRequestContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, requestTimeout)
+}
+
+// updateContext returns the context for handling an update, derived from base, the
+// bot's lifetime context, so shutting down cancels the work. Its log lines carry the
+// update, user and chat IDs of the update being handled, and attrs.
+func updateContext(base context.Context, ctx *ext.Context, attrs ...slog.Attr) context.Context {
+	ids := []slog.Attr{slog.Int64(utils.LogKeyUpdateID, ctx.UpdateId)}
+	if ctx.EffectiveUser != nil {
+		ids = append(ids, slog.Int64(utils.LogKeyUserID, ctx.EffectiveUser.Id))
+	}
+	if ctx.EffectiveChat != nil {
+		ids = append(ids, slog.Int64(utils.LogKeyChatID, ctx.EffectiveChat.Id))
+	}
+	return utils.WithLogAttrs(base, append(ids, attrs...)...)
+}
+
+// startSpan starts a span as tracing.Start does and adds its trace ID to the log
+// attributes, so log lines lead to the trace
+func startSpan(ctx context.Context, name string, attrs ...tracing.Attr) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, name, attrs...)
+	if span.IsRecording() {
+		ctx = utils.WithLogAttrs(ctx, slog.String(utils.LogKeyTraceID, span.TraceID()))
+	}
+	return ctx, span
+}
+
+// upstreamErrorText turns a failed call to the named service into a message for the user
+func upstreamErrorText(service string, err error) string {
+	switch {
+	case errors.Is(err, steam.ErrNotFound):
+		return "Not found on " + service + "."
+	case errors.Is(err, steam.ErrRateLimited):
+		return service + " is rate limiting us right now, please try again in a minute."
+	case errors.Is(err, steam.ErrUpstreamDown), errors.Is(err, context.DeadlineExceeded):
+		return service + " is not responding right now, please try again later."
+	default:
+		return "Something went wrong talking to " + service + ", please try again."
+	}
+}
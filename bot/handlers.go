@@ -1,41 +1,47 @@
 package bot
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"html"
+	"log/slog"
+	"net/http"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"steam_bot/config"
+	"steam_bot/logattr"
 	"steam_bot/steam"
+	"steam_bot/store"
 	"steam_bot/templates"
+	"steam_bot/tracing"
+	"steam_bot/utils"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
-)
-
-// ----- Sent Posts Cache -----
-
-var (
-	sentPosts      = make(map[string]time.Time)
-	sentPostsMu    sync.RWMutex
-	maxCacheSize   = 200
-	cleanupPercent = 0.5
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
 )
 
 // ----- Bot Initialization -----
 
-func StartBot(cfg *config.Config) (*gotgbot.Bot, *ext.Updater, *ext.Dispatcher, error) {
-	b, err := gotgbot.NewBot(cfg.BotToken, nil)
+// StartBot creates the bot and its dispatcher. Updates are handled with contexts
+// derived from base, which is cancelled to abort the handlers' upstream calls.
+func StartBot(base context.Context, cfg *config.Config, health *Health) (*gotgbot.Bot, *ext.Updater, *ext.Dispatcher, error) {
+	b, err := gotgbot.NewBot(cfg.BotToken, &gotgbot.BotOpts{
+		BotClient: instrumentedBotClient{&gotgbot.BaseBotClient{Client: http.Client{}}, health},
+	})
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("creating bot: %w", err)
 	}
 
 	dispatcher := ext.NewDispatcher(&ext.DispatcherOpts{
 		Error: func(b *gotgbot.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
-			log.Println("Error handling update:", err.Error())
+			slog.ErrorContext(updateContext(base, ctx), "Error handling update", logattr.Error(err))
 			return ext.DispatcherActionNoop
 		},
 		MaxRoutines: ext.DefaultMaxRoutines,
@@ -46,145 +52,315 @@ func StartBot(cfg *config.Config) (*gotgbot.Bot, *ext.Updater, *ext.Dispatcher,
 	return b, updater, dispatcher, nil
 }
 
+// AddHandlers registers the handler for every update the bot answers. Users' store
+// countries are kept in prefs; if it is nil everyone gets the client's default.
+func AddHandlers(base context.Context, dispatcher *ext.Dispatcher, b *gotgbot.Bot, cfg *config.Config, client *steam.Client, watcher *Watcher, prefs *store.Preferences) error {
+	dispatcher.AddHandler(handlers.NewInlineQuery(nil, NewInlineQueryHandler(base, client, prefs)))
+	dispatcher.AddHandler(handlers.NewCallback(nil, NewCallbackQueryHandler(base, cfg, client, watcher, prefs)))
+	dispatcher.AddHandler(handlers.NewCommand("watch", withBase(base, watcher.HandleWatchCommand)))
+	dispatcher.AddHandler(handlers.NewCommand("watchlist", watcher.HandleWatchlistCommand))
+	dispatcher.AddHandler(handlers.NewCommand("unwatch", withBase(base, watcher.HandleUnwatchCommand)))
+	dispatcher.AddHandler(handlers.NewCommand("region", NewRegionCommandHandler(base, client, prefs)))
+	dispatcher.AddHandler(handlers.NewCommand("cache", NewCacheCommandHandler(base, cfg.AdminIDs, client.Caches())))
+
+	cmdFilter, err := message.Regex(`^/(` + templates.CommandKeys() + `)(@` + b.User.Username + `)?(\s|$)`)
+	if err != nil {
+		return fmt.Errorf("compiling command regex: %w", err)
+	}
+	dispatcher.AddHandler(handlers.NewMessage(cmdFilter, DynamicCmdHandler))
+
+	return nil
+}
+
+// withBase adapts a handler that derives its contexts from base
+func withBase(base context.Context, handle func(context.Context, *gotgbot.Bot, *ext.Context) error) handlers.Response {
+	return func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return handle(base, b, ctx)
+	}
+}
+
 // ----- Deals Routine -----
 
-func SendDealsRoutine(b *gotgbot.Bot, channelID int64) {
-	ticker := time.NewTicker(1 * time.Hour)
+// DealChannel is a channel that receives deals matching its own rules
+type DealChannel struct {
+	Name     string
+	ChatID   int64
+	Filter   steam.DealFilter
+	Interval time.Duration
+	Template string
+	Country  string
+	Ledger   store.DealLedger
+
+	lastRun time.Time
+}
+
+// OpenDealChannels opens a dedup ledger for every configured channel
+func OpenDealChannels(cfg *config.Config) ([]*DealChannel, error) {
+	channels := make([]*DealChannel, 0, len(cfg.Channels))
+
+	for _, ch := range cfg.Channels {
+		ledger, err := store.NewDealLedger(cfg.LedgerBackend, ch.LedgerPath, store.RetentionPolicy{
+			MaxAge:     cfg.LedgerMaxAge,
+			MaxEntries: cfg.LedgerMaxEntries,
+		})
+		if err != nil {
+			CloseDealChannels(channels)
+			return nil, fmt.Errorf("opening ledger for channel %s: %w", ch.Name, err)
+		}
+
+		channels = append(channels, &DealChannel{
+			Name:     ch.Name,
+			ChatID:   ch.ChatID,
+			Filter:   ch.Filter,
+			Interval: ch.Interval,
+			Template: ch.Template,
+			Country:  ch.Country,
+			Ledger:   ledger,
+		})
+	}
+
+	return channels, nil
+}
+
+// CloseDealChannels flushes and closes every channel's ledger
+func CloseDealChannels(channels []*DealChannel) {
+	for _, ch := range channels {
+		if err := ch.Ledger.Close(); err != nil {
+			slog.Error("Error closing deal ledger", "channel", ch.Name, logattr.Error(err))
+		}
+	}
+}
+
+// SendDealsRoutine polls CheapShark for the channels that are due, ticking often
+// enough to run each on its own interval, and posts each channel the unseen deals
+// that pass its own filter, until ctx is cancelled
+func SendDealsRoutine(ctx context.Context, b *gotgbot.Bot, client *steam.Client, channels []*DealChannel, health *Health) {
+	if len(channels) == 0 {
+		return
+	}
+
+	// Deal polling yields to users waiting on inline queries and buttons
+	ctx = utils.WithPriority(ctx, utils.PriorityBackground)
+
+	health.setDealsInterval(shortestInterval(channels))
+
+	ticker := time.NewTicker(pollInterval(channels))
 	defer ticker.Stop()
 
-	checkAndSendDeals(b, channelID)
+	checkAndSendDeals(ctx, b, client, channels, health)
 
-	for range ticker.C {
-		checkAndSendDeals(b, channelID)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkAndSendDeals(ctx, b, client, channels, health)
+		}
 	}
 }
 
-func checkAndSendDeals(b *gotgbot.Bot, channelID int64) {
-	log.Println("Checking for deals...")
+// shortestInterval returns the shortest channel interval, how often deals are fetched
+func shortestInterval(channels []*DealChannel) time.Duration {
+	interval := channels[0].Interval
+	for _, ch := range channels[1:] {
+		interval = min(interval, ch.Interval)
+	}
+	return interval
+}
 
-	deals, err := steam.GetCheapSharkDeals()
+// pollInterval returns the greatest common divisor of the channel intervals in whole
+// seconds, so every channel's interval is a whole number of polls
+func pollInterval(channels []*DealChannel) time.Duration {
+	var seconds int64
+	for _, ch := range channels {
+		s := max(int64(ch.Interval.Round(time.Second)/time.Second), 1)
+		for s != 0 {
+			seconds, s = s, seconds%s
+		}
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// dueChannels returns the channels whose interval has elapsed at now. Ticks may
+// arrive a little early, so a channel is due from half a poll before its interval ends.
+func dueChannels(channels []*DealChannel, now time.Time) []*DealChannel {
+	slack := pollInterval(channels) / 2
+
+	var due []*DealChannel
+	for _, ch := range channels {
+		if ch.lastRun.IsZero() || now.Sub(ch.lastRun) >= ch.Interval-slack {
+			due = append(due, ch)
+		}
+	}
+	return due
+}
+
+func checkAndSendDeals(ctx context.Context, b *gotgbot.Bot, client *steam.Client, channels []*DealChannel, health *Health) {
+	now := time.Now()
+
+	due := dueChannels(channels, now)
+	if len(due) == 0 {
+		return
+	}
+	filters := make([]steam.DealFilter, 0, len(due))
+	for _, ch := range due {
+		filters = append(filters, ch.Filter)
+	}
+
+	ctx, span := startSpan(ctx, "bot.checkAndSendDeals", tracing.Int("channels", int64(len(due))))
+	defer span.End()
+
+	slog.InfoContext(ctx, "Checking for deals", "channels", len(due))
+
+	deals, err := client.GetCheapSharkDealsFor(ctx, filters...)
+	health.dealsChecked(err)
 	if err != nil {
-		log.Println("Error fetching deals:", err)
+		slog.ErrorContext(ctx, "Error fetching deals", logattr.Error(err))
+		span.RecordError(err)
 		return
 	}
+	dealsFetched.Add(float64(len(deals)))
+	span.SetAttributes(tracing.Int("deals", int64(len(deals))))
+
+	for _, ch := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		ch.lastRun = now
+		postChannelDeals(ctx, b, client, ch, deals)
+	}
+}
 
-	if initializeDealsCache(deals) {
+// postChannelDeals posts the channel's new deals. Once ctx is cancelled the deal
+// being posted is finished and recorded, but no further deals are started.
+func postChannelDeals(ctx context.Context, b *gotgbot.Bot, client *steam.Client, ch *DealChannel, deals []steam.CheapSharkDeal) {
+	ctx = utils.WithLogAttrs(ctx, slog.String("channel", ch.Name))
+	if seedLedger(ctx, ch, deals) {
 		return
 	}
 
+	posted := false
 	for _, deal := range deals {
-		if isAlreadySent(deal.DealID) {
+		if ch.Ledger.Has(deal.DealID) {
+			dealsSkipped.Inc(ch.Name, "seen")
+			continue
+		}
+		if !ch.Filter.Match(deal) {
+			dealsSkipped.Inc(ch.Name, "filtered")
+			continue
+		}
+		if !client.GetStore(ctx, deal.StoreID).Active() {
+			dealsSkipped.Inc(ch.Name, "inactive_store")
 			continue
 		}
 
-		if err := sendDeal(b, channelID, deal); err != nil {
-			log.Println("Error sending deal:", err)
+		// Space out posts so the channel isn't flooded
+		if posted && !sleepContext(ctx, 2*time.Second) {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		// A post that has started is finished even if shutdown begins meanwhile
+		if err := sendDeal(context.WithoutCancel(ctx), b, client, ch, deal); err != nil {
+			slog.ErrorContext(ctx, "Error sending deal", "deal_id", deal.DealID, logattr.Error(err))
+			dealsSkipped.Inc(ch.Name, "failed")
 			continue
 		}
+		dealsPosted.Inc(ch.Name)
 
-		markAsSent(deal.DealID)
-		time.Sleep(2 * time.Second)
+		if err := ch.Ledger.Mark(deal.DealID, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "Error recording sent deal", "deal_id", deal.DealID, logattr.Error(err))
+		}
+		posted = true
 	}
-}
 
-func initializeDealsCache(deals []steam.CheapSharkDeal) bool {
-	sentPostsMu.Lock()
-	defer sentPostsMu.Unlock()
+	if removed, err := ch.Ledger.Prune(); err != nil {
+		slog.ErrorContext(ctx, "Error pruning deal ledger", logattr.Error(err))
+	} else if removed > 0 {
+		slog.InfoContext(ctx, "Pruned old entries from deal ledger", "removed", removed, "remaining", ch.Ledger.Len())
+	}
+}
 
-	if len(sentPosts) > 0 {
-		if len(sentPosts) > maxCacheSize {
-			cleanupOldEntries()
-		}
+// seedLedger records the channel's current matching deals without posting them on
+// the channel's first run, so a fresh deployment doesn't flood the channel. The
+// ledger remembers it was seeded, so later deals are posted even if the first run
+// matched none. Returns true if the ledger was seeded.
+func seedLedger(ctx context.Context, ch *DealChannel, deals []steam.CheapSharkDeal) bool {
+	if ch.Ledger.Seeded() {
 		return false
 	}
 
+	now := time.Now()
+	seeded := 0
 	for _, deal := range deals {
-		sentPosts[deal.DealID] = time.Now()
+		if !ch.Filter.Match(deal) {
+			continue
+		}
+		if err := ch.Ledger.Mark(deal.DealID, now); err != nil {
+			slog.ErrorContext(ctx, "Error seeding deal ledger", "deal_id", deal.DealID, logattr.Error(err))
+		}
+		seeded++
+	}
+	if err := ch.Ledger.MarkSeeded(); err != nil {
+		slog.ErrorContext(ctx, "Error marking deal ledger as seeded", logattr.Error(err))
 	}
-	log.Printf("Initialized sent posts cache with %d items", len(deals))
+	slog.InfoContext(ctx, "Seeded empty deal ledger", "seeded", seeded)
+	dealsSkipped.Add(float64(seeded), ch.Name, "seeded")
 	return true
 }
 
-func isAlreadySent(dealID string) bool {
-	sentPostsMu.RLock()
-	defer sentPostsMu.RUnlock()
-	_, exists := sentPosts[dealID]
-	return exists
-}
+func sendDeal(ctx context.Context, b *gotgbot.Bot, client *steam.Client, ch *DealChannel, deal steam.CheapSharkDeal) error {
+	ctx = utils.WithLogAttrs(ctx, slog.String("deal_id", deal.DealID), slog.String(utils.LogKeyAppID, deal.SteamAppID))
+	store := client.GetStore(ctx, deal.StoreID)
 
-func markAsSent(dealID string) {
-	sentPostsMu.Lock()
-	defer sentPostsMu.Unlock()
-	sentPosts[dealID] = time.Now()
-}
+	// Non-Steam deals may have no Steam app; fall back to CheapShark's own data
+	var appInfo steam.AppInfo
+	if deal.SteamAppID != "" {
+		info, err := client.GetSteamAppInfoInRegion(ctx, deal.SteamAppID, firstNonEmpty(ch.Country, client.DefaultCountry()))
+		if err != nil {
+			slog.WarnContext(ctx, "Error getting app details, posting without them", logattr.Error(err))
+		} else {
+			appInfo = info
+		}
+	}
 
-func sendDeal(b *gotgbot.Bot, channelID int64, deal steam.CheapSharkDeal) error {
-	appInfo, err := steam.GetSteamAppInfo(deal.SteamAppID)
-	if err != nil {
-		return fmt.Errorf("getting details for app %s: %w", deal.SteamAppID, err)
-	}
-
-	msg := templates.FormatDealMessage(
-		deal.Title,
-		deal.NormalPrice,
-		deal.SalePrice,
-		appInfo.Price,
-		deal.SteamRating,
-		appInfo.Description,
-		appInfo.HeaderImage,
-		appInfo.Categories,
-		appInfo.Genres,
-	)
+	format, ok := templates.DealTemplates[ch.Template]
+	if !ok {
+		format = templates.DealTemplates["default"]
+	}
+
+	msg := format(templates.DealPost{
+		Title:       deal.Title,
+		NormalPrice: deal.NormalPrice,
+		SalePrice:   deal.SalePrice,
+		LocalPrice:  appInfo.Price,
+		Savings:     deal.Savings,
+		Rating:      deal.SteamRating,
+		StoreName:   store.StoreName,
+		StoreIcon:   store.LogoURL(),
+		Description: appInfo.Description,
+		ImageURL:    firstNonEmpty(appInfo.HeaderImage, deal.Thumb),
+		Categories:  appInfo.Categories,
+		Genres:      appInfo.Genres,
+	})
 
-	_, err = b.SendMessage(channelID, msg, &gotgbot.SendMessageOpts{
+	_, err := b.SendMessage(ch.ChatID, msg, &gotgbot.SendMessageOpts{
 		ParseMode: "HTML",
 		ReplyMarkup: gotgbot.InlineKeyboardMarkup{
 			InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
-				{Text: "Claim Deal", Url: fmt.Sprintf("https://store.steampowered.com/app/%s", deal.SteamAppID)},
+				{Text: "Claim Deal", Url: steam.DealRedirectURL(deal.DealID)},
 			}},
 		},
 	})
 
 	if err == nil {
-		log.Println("Sent deal:", deal.Title)
+		slog.InfoContext(ctx, "Sent deal", "title", deal.Title, "store", store.StoreName)
 	}
 	return err
 }
 
-// cleanupOldEntries removes the oldest entries from sentPosts
-// Must be called with sentPostsMu locked
-func cleanupOldEntries() {
-	if len(sentPosts) == 0 {
-		return
-	}
-
-	type entry struct {
-		id   string
-		time time.Time
-	}
-
-	entries := make([]entry, 0, len(sentPosts))
-	for id, t := range sentPosts {
-		entries = append(entries, entry{id: id, time: t})
-	}
-
-	// Sort by timestamp (oldest first)
-	for i := range len(entries) - 1 {
-		for j := i + 1; j < len(entries); j++ {
-			if entries[i].time.After(entries[j].time) {
-				entries[i], entries[j] = entries[j], entries[i]
-			}
-		}
-	}
-
-	removeCount := int(float64(len(sentPosts)) * cleanupPercent)
-	for _, e := range entries[:removeCount] {
-		delete(sentPosts, e.id)
-	}
-
-	log.Printf("Cleaned up %d old entries from cache, %d remaining", removeCount, len(sentPosts))
-}
-
 // ----- Inline Query Handler -----
 
 func handleInlineDotCommand(b *gotgbot.Bot, ctx *ext.Context, cmd string) error {
@@ -325,35 +501,83 @@ func buildInlineCommandResult(name string, cmd templates.InlineCommand) gotgbot.
 	return result
 }
 
-func HandleInlineQuery(b *gotgbot.Bot, ctx *ext.Context) error {
+// NewInlineQueryHandler creates an inline query handler looking games up with client
+// in each user's store country from prefs
+func NewInlineQueryHandler(base context.Context, client *steam.Client, prefs *store.Preferences) func(b *gotgbot.Bot, ctx *ext.Context) error {
+	return func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return HandleInlineQuery(base, b, ctx, client, prefs)
+	}
+}
+
+func HandleInlineQuery(base context.Context, b *gotgbot.Bot, ctx *ext.Context, client *steam.Client, prefs *store.Preferences) (err error) {
+	start := time.Now()
+	logCtx, span := startSpan(updateContext(base, ctx), "bot.HandleInlineQuery")
+	span.SetKind(tracing.KindServer)
+	kind, failed := "search", false
+	defer func() {
+		inlineQueries.Inc(kind, resultLabel(failed || err != nil))
+		inlineQueryDuration.ObserveSince(start, kind)
+		slog.DebugContext(logCtx, "Handled inline query", "kind", kind, "failed", failed || err != nil, "duration", time.Since(start))
+		span.SetAttributes(tracing.String("inline.kind", kind), tracing.Bool("inline.failed", failed))
+		span.Finish(err)
+	}()
+
 	query := ctx.InlineQuery.Query
 
 	// Show all commands menu when query is empty
 	if query == "" {
+		kind = "help"
 		return showAllInlineCommands(b, ctx)
 	}
 
 	// Handle dot commands (e.g., ".help")
 	if cmd, ok := strings.CutPrefix(query, "."); ok {
+		kind = "command"
 		return handleInlineDotCommand(b, ctx, cmd)
 	}
 
+	reqCtx, cancel := newRequestContext(logCtx)
+	defer cancel()
+
 	userID := ctx.InlineQuery.From.Id
-	results, err := steam.SearchSteam(query)
+	cc := regions{client: client, prefs: prefs}.userCountry(userID)
+	results, err := client.SearchSteam(reqCtx, query, cc)
 	if err != nil {
-		log.Println("Error searching steam:", err)
-		return nil
+		slog.ErrorContext(reqCtx, "Error searching Steam", "query", query, logattr.Error(err))
+		failed = true
+		return answerInlineError(b, ctx, upstreamErrorText("Steam", err))
 	}
 
-	inlineResults := processSearchResults(results, userID)
+	inlineResults := processSearchResults(reqCtx, client, results, userID, cc)
 
+	// Results depend on the user's region, so they must not be shared between users
 	_, err = ctx.InlineQuery.Answer(b, inlineResults, &gotgbot.AnswerInlineQueryOpts{
-		CacheTime: 100,
+		CacheTime:  100,
+		IsPersonal: true,
 	})
 	return err
 }
 
-func processSearchResults(results []steam.SteamSearchItem, userID int64) []gotgbot.InlineQueryResult {
+// answerInlineError answers an inline query with a single result explaining why the search failed
+func answerInlineError(b *gotgbot.Bot, ctx *ext.Context, text string) error {
+	result := gotgbot.InlineQueryResultArticle{
+		Id:          "error",
+		Title:       "Search failed",
+		Description: text,
+		InputMessageContent: gotgbot.InputTextMessageContent{
+			MessageText: text,
+		},
+	}
+
+	// Don't let Telegram cache the failure
+	_, err := ctx.InlineQuery.Answer(b, []gotgbot.InlineQueryResult{result}, &gotgbot.AnswerInlineQueryOpts{
+		CacheTime:  0,
+		IsPersonal: true,
+	})
+	return err
+}
+
+func processSearchResults(ctx context.Context, client *steam.Client, results []steam.SteamSearchItem, userID int64, cc string) []gotgbot.InlineQueryResult {
 	inlineResults := make([]gotgbot.InlineQueryResult, len(results))
 
 	var wg sync.WaitGroup
@@ -366,7 +590,7 @@ func processSearchResults(results []steam.SteamSearchItem, userID int64) []gotgb
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			inlineResults[i] = buildInlineResult(i, item, userID)
+			inlineResults[i] = buildInlineResult(ctx, client, i, item, userID, cc)
 		}(idx, item)
 	}
 
@@ -374,32 +598,26 @@ func processSearchResults(results []steam.SteamSearchItem, userID int64) []gotgb
 	return inlineResults
 }
 
-func buildInlineResult(index int, item steam.SteamSearchItem, userID int64) gotgbot.InlineQueryResultArticle {
+func buildInlineResult(ctx context.Context, client *steam.Client, index int, item steam.SteamSearchItem, userID int64, cc string) gotgbot.InlineQueryResultArticle {
 	appID := strconv.Itoa(item.ID)
-	appInfo, _ := steam.GetSteamAppInfo(appID) // Uses cache from GetFullSteamAppDetails
-
-	usPrice := float64(item.Price.Final) / 100.0
-	usPriceStr := fmt.Sprintf("$%.2f", usPrice)
+	appInfo, _ := client.GetSteamAppInfoInRegion(ctx, appID, cc) // Uses cache from GetFullSteamAppDetailsInRegion
 
-	priceDisplay := formatPriceDisplay(usPrice, appInfo.Price)
+	priceDisplay := firstNonEmpty(appInfo.Price, formatSearchPrice(item))
 	imageURL := firstNonEmpty(appInfo.HeaderImage, item.TinyImage)
 
-	msg := templates.FormatDealMessage(
-		item.Name,
-		usPriceStr,
-		"",
-		appInfo.Price,
-		"",
-		appInfo.Description,
-		imageURL,
-		appInfo.Categories,
-		appInfo.Genres,
-	)
+	msg := templates.FormatDealMessage(templates.DealPost{
+		Title:       item.Name,
+		NormalPrice: priceDisplay,
+		Description: appInfo.Description,
+		ImageURL:    imageURL,
+		Categories:  appInfo.Categories,
+		Genres:      appInfo.Genres,
+	})
 
 	return gotgbot.InlineQueryResultArticle{
 		Id:           strconv.Itoa(index),
 		Title:        item.Name,
-		Description:  fmt.Sprintf("Price: %s", priceDisplay),
+		Description:  fmt.Sprintf("Price: %s", firstNonEmpty(priceDisplay, "N/A")),
 		ThumbnailUrl: item.TinyImage,
 		InputMessageContent: gotgbot.InputTextMessageContent{
 			MessageText: msg,
@@ -412,17 +630,12 @@ func buildInlineResult(index int, item steam.SteamSearchItem, userID int64) gotg
 	}
 }
 
-func formatPriceDisplay(usPrice float64, inrPrice string) string {
-	if usPrice == 0 {
-		return inrPrice
-	}
-	var priceStr string
-	if inrPrice != "" {
-		priceStr = fmt.Sprintf("$%.2f / %s", usPrice, inrPrice)
-	} else {
-		priceStr = fmt.Sprintf("$%.2f", usPrice)
+// formatSearchPrice formats the price embedded in a search result, used when app details are unavailable
+func formatSearchPrice(item steam.SteamSearchItem) string {
+	if item.Price.Final == 0 {
+		return ""
 	}
-	return priceStr
+	return fmt.Sprintf("%.2f %s", float64(item.Price.Final)/100.0, item.Price.Currency)
 }
 
 func firstNonEmpty(values ...string) string {
@@ -445,6 +658,13 @@ func buildInlineKeyboard(appID int, userID int64) *gotgbot.InlineKeyboardMarkup
 				{Text: "Details", CallbackData: fmt.Sprintf("details:%d_%d", appID, userID)},
 				{Text: "Requirements", CallbackData: fmt.Sprintf("requirements:%d_%d", appID, userID)},
 			},
+			{
+				{Text: "📈 Price History", CallbackData: fmt.Sprintf("history:%d_%d", appID, userID)},
+				{Text: "🌍 Regional Prices", CallbackData: fmt.Sprintf("regions:%d_%d", appID, userID)},
+			},
+			{
+				{Text: "🔔 Watch", CallbackData: fmt.Sprintf("watch:%d_%d", appID, userID)},
+			},
 		},
 	}
 }
@@ -461,6 +681,9 @@ const (
 	CallbackHLTB
 	CallbackMySteam
 	CallbackBack
+	CallbackWatch
+	CallbackPriceHistory
+	CallbackRegionalPrices
 )
 
 // CallbackData holds parsed callback information
@@ -470,21 +693,39 @@ type CallbackData struct {
 	UserID int64
 }
 
-// NewCallbackQueryHandler creates a callback query handler with config access
-func NewCallbackQueryHandler(cfg *config.Config) func(b *gotgbot.Bot, ctx *ext.Context) error {
+// NewCallbackQueryHandler creates a callback query handler with config, Steam client,
+// watchlist and region preference access
+func NewCallbackQueryHandler(base context.Context, cfg *config.Config, client *steam.Client, watcher *Watcher, prefs *store.Preferences) func(b *gotgbot.Bot, ctx *ext.Context) error {
 	return func(b *gotgbot.Bot, ctx *ext.Context) error {
-		return HandleCallbackQuery(b, ctx, cfg)
+		return HandleCallbackQuery(base, b, ctx, cfg, client, watcher, prefs)
 	}
 }
 
-func HandleCallbackQuery(b *gotgbot.Bot, ctx *ext.Context, cfg *config.Config) error {
+func HandleCallbackQuery(base context.Context, b *gotgbot.Bot, ctx *ext.Context, cfg *config.Config, client *steam.Client, watcher *Watcher, prefs *store.Preferences) (err error) {
+	start := time.Now()
 	cbData, err := parseCallbackData(ctx.CallbackQuery.Data)
 	if err != nil || cbData.Type == CallbackUnknown {
+		callbacks.Inc(CallbackUnknown.String(), "invalid")
 		return nil
 	}
 
+	logCtx := updateContext(base, ctx, slog.String(utils.LogKeyCallbackType, cbData.Type.String()), slog.String(utils.LogKeyAppID, cbData.AppID))
+	logCtx, span := startSpan(logCtx, "bot.HandleCallbackQuery",
+		tracing.String("callback.type", cbData.Type.String()), tracing.String("app_id", cbData.AppID))
+	span.SetKind(tracing.KindServer)
+	result := ""
+	defer func() {
+		result = cmp.Or(result, resultLabel(err != nil))
+		callbacks.Inc(cbData.Type.String(), result)
+		callbackDuration.ObserveSince(start, cbData.Type.String())
+		slog.DebugContext(logCtx, "Handled callback", "result", result, "duration", time.Since(start))
+		span.SetAttributes(tracing.String("callback.result", result))
+		span.Finish(err)
+	}()
+
 	// Verify user authorization
 	if cbData.UserID != ctx.CallbackQuery.From.Id {
+		result = "denied"
 		_, _ = ctx.CallbackQuery.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
 			Text:      "This is not for you",
 			ShowAlert: true,
@@ -492,27 +733,37 @@ func HandleCallbackQuery(b *gotgbot.Bot, ctx *ext.Context, cfg *config.Config) e
 		return nil
 	}
 
+	reqCtx, cancel := newRequestContext(logCtx)
+	defer cancel()
+
 	// Handle mysteam callback separately (doesn't need app details)
 	if cbData.Type == CallbackMySteam {
-		return handleMySteamCallback(b, ctx, cbData, cfg)
+		return handleMySteamCallback(reqCtx, b, ctx, client, cbData, cfg)
+	}
+
+	// Handle watch callback (adds to the user's watchlist without editing the message)
+	if cbData.Type == CallbackWatch {
+		return watcher.handleWatchCallback(reqCtx, b, ctx, cbData)
 	}
 
 	// Handle back callback (uses cache to restore original view)
+	cc := regions{client: client, prefs: prefs}.userCountry(cbData.UserID)
 	if cbData.Type == CallbackBack {
-		return handleBackCallback(b, ctx, cbData)
+		return handleBackCallback(reqCtx, b, ctx, client, cbData, cc)
 	}
 
-	_, _ = ctx.CallbackQuery.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Fetching..."})
-
-	// Fetch app details once (cached)
-	details, err := steam.GetFullSteamAppDetails(cbData.AppID)
+	// Fetch app details once (cached), priced for the user's region
+	details, err := client.GetFullSteamAppDetailsInRegion(reqCtx, cbData.AppID, cc)
 	if err != nil {
-		log.Println("Error getting details:", err)
-		return nil
+		slog.ErrorContext(reqCtx, "Error getting app details", logattr.Error(err))
+		result = "error"
+		return answerCallbackError(b, ctx, upstreamErrorText("Steam", err))
 	}
 
+	_, _ = ctx.CallbackQuery.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Fetching..."})
+
 	// Route to appropriate handler
-	msg, replyMarkup := routeCallback(cbData, details)
+	msg, replyMarkup := routeCallback(reqCtx, client, cbData, details, cfg)
 	if msg == "" {
 		return nil
 	}
@@ -520,49 +771,39 @@ func HandleCallbackQuery(b *gotgbot.Bot, ctx *ext.Context, cfg *config.Config) e
 	return sendCallbackResponse(b, ctx, msg, replyMarkup)
 }
 
-func handleBackCallback(b *gotgbot.Bot, ctx *ext.Context, cbData CallbackData) error {
-	_, _ = ctx.CallbackQuery.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Going back..."})
-
-	// Try to get from cache first
-	cache := steam.GetAppDetailsCache()
-	details, cached := cache.Get(cbData.AppID)
+// answerCallbackError answers a callback query with an alert explaining why it failed
+func answerCallbackError(b *gotgbot.Bot, ctx *ext.Context, text string) error {
+	_, err := ctx.CallbackQuery.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text:      text,
+		ShowAlert: true,
+	})
+	return err
+}
 
-	// If not cached, fetch it
-	if !cached {
-		var err error
-		details, err = steam.GetFullSteamAppDetails(cbData.AppID)
-		if err != nil {
-			log.Println("Error getting details for back navigation:", err)
-			return nil
-		}
+// handleBackCallback restores the search result view, priced for the user's region cc
+func handleBackCallback(reqCtx context.Context, b *gotgbot.Bot, ctx *ext.Context, client *steam.Client, cbData CallbackData, cc string) error {
+	// Cached after the original search
+	details, err := client.GetFullSteamAppDetailsInRegion(reqCtx, cbData.AppID, cc)
+	if err != nil {
+		slog.ErrorContext(reqCtx, "Error getting app details for back navigation", logattr.Error(err))
+		return answerCallbackError(b, ctx, upstreamErrorText("Steam", err))
 	}
 
-	// Get app info for pricing
-	appInfo, _ := steam.GetSteamAppInfo(cbData.AppID)
+	_, _ = ctx.CallbackQuery.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Going back..."})
+	appInfo := details.ToAppInfo()
 
 	// Parse appID to int for URL generation
 	appIDInt, _ := strconv.Atoi(cbData.AppID)
 
-	// Format price display
-	var priceDisplay string
-	if appInfo.Price != "" {
-		priceDisplay = appInfo.Price
-	} else {
-		priceDisplay = "Free"
-	}
-
 	// Reconstruct the original search result message
-	msg := templates.FormatDealMessage(
-		details.Name,
-		priceDisplay,
-		"",
-		appInfo.Price,
-		"",
-		appInfo.Description,
-		appInfo.HeaderImage,
-		appInfo.Categories,
-		appInfo.Genres,
-	)
+	msg := templates.FormatDealMessage(templates.DealPost{
+		Title:       details.Name,
+		NormalPrice: firstNonEmpty(appInfo.Price, "Free"),
+		Description: appInfo.Description,
+		ImageURL:    appInfo.HeaderImage,
+		Categories:  appInfo.Categories,
+		Genres:      appInfo.Genres,
+	})
 
 	// Build the original inline keyboard
 	replyMarkup := buildInlineKeyboard(appIDInt, cbData.UserID)
@@ -570,7 +811,7 @@ func handleBackCallback(b *gotgbot.Bot, ctx *ext.Context, cbData CallbackData) e
 	return sendCallbackResponse(b, ctx, msg, *replyMarkup)
 }
 
-func handleMySteamCallback(b *gotgbot.Bot, ctx *ext.Context, cbData CallbackData, cfg *config.Config) error {
+func handleMySteamCallback(reqCtx context.Context, b *gotgbot.Bot, ctx *ext.Context, client *steam.Client, cbData CallbackData, cfg *config.Config) error {
 	username := cbData.AppID // AppID field holds the username for mysteam
 
 	// Check if username is empty
@@ -604,10 +845,14 @@ func handleMySteamCallback(b *gotgbot.Bot, ctx *ext.Context, cbData CallbackData
 	_, _ = ctx.CallbackQuery.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Fetching profile..."})
 
 	// Fetch user info
-	userInfo, err := steam.GetSteamUserInfo(cfg.SteamAPIKey, username)
+	userInfo, err := client.GetSteamUserInfo(reqCtx, username)
 	if err != nil {
-		log.Println("Error getting Steam user info:", err)
-		_, _, _ = b.EditMessageText(fmt.Sprintf("<b>Error:</b> User not found: %s", username), &gotgbot.EditMessageTextOpts{
+		slog.ErrorContext(reqCtx, "Error getting Steam user info", logattr.Error(err))
+		errText := upstreamErrorText("Steam", err)
+		if errors.Is(err, steam.ErrNotFound) {
+			errText = "User not found: " + html.EscapeString(username)
+		}
+		_, _, _ = b.EditMessageText("<b>Error:</b> "+errText, &gotgbot.EditMessageTextOpts{
 			InlineMessageId: ctx.CallbackQuery.InlineMessageId,
 			ParseMode:       "HTML",
 		})
@@ -649,6 +894,9 @@ func parseCallbackData(data string) (CallbackData, error) {
 		"hltb:":         CallbackHLTB,
 		"mysteam:":      CallbackMySteam,
 		"back:":         CallbackBack,
+		"watch:":        CallbackWatch,
+		"history:":      CallbackPriceHistory,
+		"regions:":      CallbackRegionalPrices,
 	}
 
 	var payload string
@@ -680,21 +928,25 @@ func parseCallbackData(data string) (CallbackData, error) {
 	return result, nil
 }
 
-func routeCallback(cbData CallbackData, details *steam.SteamAppDetails) (string, gotgbot.InlineKeyboardMarkup) {
+func routeCallback(ctx context.Context, client *steam.Client, cbData CallbackData, details *steam.SteamAppDetails, cfg *config.Config) (string, gotgbot.InlineKeyboardMarkup) {
 	switch cbData.Type {
 	case CallbackDetails:
-		return handleDetailsCallback(cbData, details)
+		return handleDetailsCallback(ctx, client, cbData, details)
 	case CallbackRequirements:
 		return handleRequirementsCallback(cbData, details)
 	case CallbackHLTB:
-		return handleHLTBCallback(cbData, details)
+		return handleHLTBCallback(ctx, client, cbData, details)
+	case CallbackPriceHistory:
+		return handlePriceHistoryCallback(client, cbData, details)
+	case CallbackRegionalPrices:
+		return handleRegionalPricesCallback(ctx, client, cbData, details, cfg)
 	default:
 		return "", gotgbot.InlineKeyboardMarkup{}
 	}
 }
 
-func handleDetailsCallback(cbData CallbackData, details *steam.SteamAppDetails) (string, gotgbot.InlineKeyboardMarkup) {
-	reviews := fetchReviews(cbData.AppID)
+func handleDetailsCallback(ctx context.Context, client *steam.Client, cbData CallbackData, details *steam.SteamAppDetails) (string, gotgbot.InlineKeyboardMarkup) {
+	reviews := fetchReviews(ctx, client, cbData.AppID)
 
 	msg := templates.FormatMoreDetails(
 		details.Name,
@@ -722,6 +974,10 @@ func handleDetailsCallback(cbData CallbackData, details *steam.SteamAppDetails)
 				{Text: "Requirements", CallbackData: fmt.Sprintf("requirements:%s_%d", cbData.AppID, cbData.UserID)},
 				{Text: "⏱️ HLTB", CallbackData: fmt.Sprintf("hltb:%s_%d", cbData.AppID, cbData.UserID)},
 			},
+			{
+				{Text: "📈 Price History", CallbackData: fmt.Sprintf("history:%s_%d", cbData.AppID, cbData.UserID)},
+				{Text: "🌍 Regional Prices", CallbackData: fmt.Sprintf("regions:%s_%d", cbData.AppID, cbData.UserID)},
+			},
 			{
 				{Text: "❮", CallbackData: fmt.Sprintf("back:%s_%d", cbData.AppID, cbData.UserID)},
 			},
@@ -752,12 +1008,12 @@ func handleRequirementsCallback(cbData CallbackData, details *steam.SteamAppDeta
 	return msg, replyMarkup
 }
 
-func handleHLTBCallback(cbData CallbackData, details *steam.SteamAppDetails) (string, gotgbot.InlineKeyboardMarkup) {
-	reviews := fetchReviews(cbData.AppID)
+func handleHLTBCallback(ctx context.Context, client *steam.Client, cbData CallbackData, details *steam.SteamAppDetails) (string, gotgbot.InlineKeyboardMarkup) {
+	reviews := fetchReviews(ctx, client, cbData.AppID)
 
-	hltbResult, err := steam.GetHltbData(details.Name)
+	hltbResult, err := client.GetHltbData(ctx, details.Name)
 	if err != nil {
-		log.Println("Error getting HLTB data:", err)
+		slog.ErrorContext(ctx, "Error getting HLTB data", logattr.Error(err))
 		return "", gotgbot.InlineKeyboardMarkup{}
 	}
 
@@ -795,10 +1051,94 @@ func handleHLTBCallback(cbData CallbackData, details *steam.SteamAppDetails) (st
 	return msg, replyMarkup
 }
 
-func fetchReviews(appID string) *steam.SteamReviewSummary {
-	reviews, err := steam.GetSteamAppReviews(appID)
+func handlePriceHistoryCallback(client *steam.Client, cbData CallbackData, details *steam.SteamAppDetails) (string, gotgbot.InlineKeyboardMarkup) {
+	var regions []templates.PriceHistoryRegion
+
+	if history := client.PriceHistory(); history != nil {
+		now := time.Now()
+		for _, region := range history.Regions(cbData.AppID) {
+			stats, ok := history.Stats(cbData.AppID, region, now)
+			if !ok {
+				continue
+			}
+			regions = append(regions, templates.PriceHistoryRegion{
+				Region:        stats.Region,
+				Currency:      stats.Currency,
+				Current:       stats.Current.Price,
+				Regular:       stats.Current.Regular,
+				Lowest:        stats.Lowest.Price,
+				LowestAt:      stats.Lowest.Time,
+				Average:       stats.Average,
+				DaysSinceSale: stats.DaysSinceSale(now),
+				Since:         stats.Since,
+			})
+		}
+	}
+
+	msg := templates.FormatPriceHistory(details.Name, regions)
+
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
+				{Text: "View on Steam", Url: fmt.Sprintf("https://store.steampowered.com/app/%s", cbData.AppID)},
+				{Text: "Details", CallbackData: fmt.Sprintf("details:%s_%d", cbData.AppID, cbData.UserID)},
+			},
+			{
+				{Text: "❮", CallbackData: fmt.Sprintf("back:%s_%d", cbData.AppID, cbData.UserID)},
+			},
+		},
+	}
+
+	return msg, replyMarkup
+}
+
+func handleRegionalPricesCallback(ctx context.Context, client *steam.Client, cbData CallbackData, details *steam.SteamAppDetails, cfg *config.Config) (string, gotgbot.InlineKeyboardMarkup) {
+	prices, err := client.GetRegionalPrices(ctx, cbData.AppID, cfg.PriceRegions)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting regional prices", logattr.Error(err))
+	}
+
+	// Prices are still shown in local currency if the exchange rates are unavailable
+	rates, err := client.GetExchangeRates(ctx, cfg.BaseCurrency)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting exchange rates", logattr.Error(err))
+	}
+
+	rows := make([]templates.RegionalPriceRow, 0, len(prices))
+	for _, p := range prices {
+		row := templates.RegionalPriceRow{
+			Region:    p.CC,
+			Available: p.Available,
+			Native:    strings.ReplaceAll(p.Price.FinalFormatted, " ", ""),
+			Discount:  p.Price.DiscountPercent,
+		}
+		if p.Available && rates != nil {
+			row.Converted, row.HasConverted = steam.ConvertCurrency(float64(p.Price.Final)/100, p.Price.Currency, rates)
+		}
+		rows = append(rows, row)
+	}
+
+	msg := templates.FormatRegionalPrices(details.Name, cfg.BaseCurrency, rows)
+
+	replyMarkup := gotgbot.InlineKeyboardMarkup{
+		InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+			{
+				{Text: "View on Steam", Url: fmt.Sprintf("https://store.steampowered.com/app/%s", cbData.AppID)},
+				{Text: "📈 Price History", CallbackData: fmt.Sprintf("history:%s_%d", cbData.AppID, cbData.UserID)},
+			},
+			{
+				{Text: "❮", CallbackData: fmt.Sprintf("back:%s_%d", cbData.AppID, cbData.UserID)},
+			},
+		},
+	}
+
+	return msg, replyMarkup
+}
+
+func fetchReviews(ctx context.Context, client *steam.Client, appID string) *steam.SteamReviewSummary {
+	reviews, err := client.GetSteamAppReviews(ctx, appID)
 	if err != nil {
-		log.Println("Error getting reviews:", err)
+		slog.ErrorContext(ctx, "Error getting reviews", logattr.Error(err))
 		return &steam.SteamReviewSummary{}
 	}
 	return reviews
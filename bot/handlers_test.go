@@ -0,0 +1,290 @@
+package bot
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"steam_bot/templates"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// inlineArticle is the part of an InlineQueryResultArticle the tests look at
+type inlineArticle struct {
+	Id                  string `json:"id"`
+	Title               string `json:"title"`
+	Description         string `json:"description"`
+	InputMessageContent struct {
+		MessageText string `json:"message_text"`
+	} `json:"input_message_content"`
+	ReplyMarkup gotgbot.InlineKeyboardMarkup `json:"reply_markup"`
+}
+
+// answeredResults decodes the results of the last answerInlineQuery call
+func (h *harness) answeredResults() []inlineArticle {
+	h.t.Helper()
+
+	var results []inlineArticle
+	if err := h.lastCall("answerInlineQuery").Decode("results", &results); err != nil {
+		h.t.Fatal(err)
+	}
+	return results
+}
+
+// ----- Inline Queries -----
+
+func TestInlineQuerySearchesSteam(t *testing.T) {
+	h := newHarness(t)
+
+	h.inlineQuery(alice, "portal")
+
+	answer := h.lastCall("answerInlineQuery")
+	if answer.Params["inline_query_id"] != "inline-query" || answer.Params["is_personal"] != "true" {
+		t.Errorf("answer params = %v, want a personal answer to the query", answer.Params)
+	}
+
+	results := h.answeredResults()
+	if len(results) != 5 {
+		t.Fatalf("got %d results, want 5", len(results))
+	}
+	portal2 := results[0]
+	if portal2.Title != "Portal 2" || !strings.Contains(portal2.Description, "₹82") {
+		t.Errorf("first result = %q, %q; want Portal 2 at ₹82", portal2.Title, portal2.Description)
+	}
+	if !strings.Contains(portal2.InputMessageContent.MessageText, "Portal 2") {
+		t.Errorf("message = %q, want the game's name", portal2.InputMessageContent.MessageText)
+	}
+
+	want := []string{"details:620_1001", "requirements:620_1001", "history:620_1001", "regions:620_1001", "watch:620_1001"}
+	if got := buttonData(portal2.ReplyMarkup); !slices.Equal(got, want) {
+		t.Errorf("buttons = %q, want %q", got, want)
+	}
+}
+
+func TestInlineQueryWithoutTextListsCommands(t *testing.T) {
+	h := newHarness(t)
+
+	h.inlineQuery(alice, "")
+
+	results := h.answeredResults()
+	if len(results) != len(templates.InlineCommands) {
+		t.Fatalf("got %d results, want one per inline command (%d)", len(results), len(templates.InlineCommands))
+	}
+	for _, result := range results {
+		name, ok := strings.CutPrefix(result.Id, "cmd_")
+		if _, known := templates.InlineCommands[name]; !ok || !known {
+			t.Errorf("result %q is not an inline command", result.Id)
+		}
+	}
+	if n := h.upstream.Requests("/api/storesearch/"); n != 0 {
+		t.Errorf("store was searched %d times, want 0", n)
+	}
+}
+
+func TestInlineQueryReportsSearchFailure(t *testing.T) {
+	h := newHarness(t)
+	h.upstream.Fail("/api/storesearch/", 503)
+
+	h.inlineQuery(alice, "portal")
+
+	results := h.answeredResults()
+	if len(results) != 1 || results[0].Id != "error" || results[0].Title != "Search failed" {
+		t.Fatalf("results = %+v, want a single error result", results)
+	}
+	if !strings.Contains(results[0].Description, "Steam is not responding") {
+		t.Errorf("description = %q, want the outage explained", results[0].Description)
+	}
+}
+
+// ----- Callback Queries -----
+
+func TestCallbackQueries(t *testing.T) {
+	tests := map[CallbackType]struct {
+		data        string
+		wantText    []string // in the edited message
+		wantButtons []string // callback data of the edited message's keyboard
+		wantAlert   string   // instead of an edit
+	}{
+		CallbackDetails: {
+			data:        "details:620_1001",
+			wantText:    []string{"Portal 2 - Details", "Overwhelmingly Positive", "👍 389212 | 👎 4213"},
+			wantButtons: []string{"requirements:620_1001", "hltb:620_1001", "history:620_1001", "regions:620_1001", "back:620_1001"},
+		},
+		CallbackRequirements: {
+			data:        "requirements:620_1001",
+			wantText:    []string{"Portal 2 - Requirements", "Windows 7"},
+			wantButtons: []string{"details:620_1001", "back:620_1001"},
+		},
+		CallbackHLTB: {
+			data:        "hltb:620_1001",
+			wantText:    []string{"How Long To Beat", "Main Story: 8.5h", "Completionist: 22h", "PlayStation 3"},
+			wantButtons: []string{"requirements:620_1001", "back:620_1001"},
+		},
+		CallbackMySteam: {
+			data:     "mysteam:gabelogannewell_1001",
+			wantText: []string{"Rabscuttle", "<b>Level:</b> 26", "<b>Games:</b> 224", "<b>Country:</b> US"},
+		},
+		CallbackBack: {
+			data:        "back:620_1001",
+			wantText:    []string{"Portal 2", "<code>₹82</code>"},
+			wantButtons: []string{"details:620_1001", "requirements:620_1001", "history:620_1001", "regions:620_1001", "watch:620_1001"},
+		},
+		CallbackWatch: {
+			data:      "watch:620_1001",
+			wantAlert: "Watching Portal 2.",
+		},
+		CallbackPriceHistory: {
+			data:        "history:620_1001",
+			wantText:    []string{"Portal 2 - Price History", "<b>IN</b> (INR)", "Current: <code>82.00</code>"},
+			wantButtons: []string{"details:620_1001", "back:620_1001"},
+		},
+		CallbackRegionalPrices: {
+			data:        "regions:620_1001",
+			wantText:    []string{"Portal 2 - Regional Prices", "IN  ₹82", "≈      0.92 USD"},
+			wantButtons: []string{"history:620_1001", "back:620_1001"},
+		},
+	}
+
+	for typ := CallbackUnknown + 1; typ.String() != CallbackUnknown.String(); typ++ {
+		tt, ok := tests[typ]
+		if !ok {
+			t.Errorf("no test for callback type %s", typ)
+			continue
+		}
+
+		t.Run(typ.String(), func(t *testing.T) {
+			h := newHarness(t)
+
+			h.callback(alice, tt.data)
+
+			if tt.wantAlert != "" {
+				answer := h.lastCall("answerCallbackQuery")
+				if !strings.HasPrefix(answer.Params["text"], tt.wantAlert) || answer.Params["show_alert"] != "true" {
+					t.Errorf("answer = %v, want an alert starting %q", answer.Params, tt.wantAlert)
+				}
+				if edits := h.telegram.Calls("editMessageText"); len(edits) != 0 {
+					t.Errorf("message was edited %d times, want 0", len(edits))
+				}
+				return
+			}
+
+			edit := h.lastCall("editMessageText")
+			if edit.Params["inline_message_id"] != inlineMessageID || edit.Params["parse_mode"] != "HTML" {
+				t.Errorf("edit params = %v, want an HTML edit of the inline message", edit.Params)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(edit.Params["text"], want) {
+					t.Errorf("text = %q, want it to contain %q", edit.Params["text"], want)
+				}
+			}
+			if got := buttonData(h.keyboard(edit)); !slices.Equal(got, tt.wantButtons) {
+				t.Errorf("buttons = %q, want %q", got, tt.wantButtons)
+			}
+		})
+	}
+}
+
+func TestCallbackQueryWatchAddsToWatchlist(t *testing.T) {
+	h := newHarness(t)
+
+	h.callback(alice, "watch:620_1001")
+
+	entries := h.watchlist.All()
+	if len(entries) != 1 {
+		t.Fatalf("watchlist has %d entries, want 1", len(entries))
+	}
+	if e := entries[0]; e.UserID != alice.Id || e.AppID != "620" || e.GameID != "137" || e.LastPrice != 0.99 {
+		t.Errorf("entry = %+v, want Portal 2 watched by alice at $0.99", e)
+	}
+}
+
+func TestCallbackQueryFromAnotherUserIsDenied(t *testing.T) {
+	h := newHarness(t)
+
+	h.callback(bob, "details:620_1001")
+
+	answer := h.lastCall("answerCallbackQuery")
+	if answer.Params["text"] != "This is not for you" || answer.Params["show_alert"] != "true" {
+		t.Errorf("answer = %v, want a denial alert", answer.Params)
+	}
+	if calls := h.telegram.Calls(""); len(calls) != 1 {
+		t.Errorf("made %d Bot API calls, want only the denial", len(calls))
+	}
+	if n := h.upstream.Requests("/api/appdetails"); n != 0 {
+		t.Errorf("app details were fetched %d times for a denied callback", n)
+	}
+}
+
+func TestCallbackQueryWithUnknownDataIsIgnored(t *testing.T) {
+	h := newHarness(t)
+
+	h.callback(alice, "bogus:620_1001")
+	h.callback(alice, "details:620")
+
+	if calls := h.telegram.Calls(""); len(calls) != 0 {
+		t.Errorf("made Bot API calls %+v, want none", calls)
+	}
+}
+
+func TestCallbackQueryForUnknownApp(t *testing.T) {
+	h := newHarness(t)
+
+	h.callback(alice, "details:999999_1001")
+
+	answer := h.lastCall("answerCallbackQuery")
+	if answer.Params["text"] != "Not found on Steam." || answer.Params["show_alert"] != "true" {
+		t.Errorf("answer = %v, want a not found alert", answer.Params)
+	}
+	if edits := h.telegram.Calls("editMessageText"); len(edits) != 0 {
+		t.Errorf("message was edited %d times, want 0", len(edits))
+	}
+}
+
+func TestCallbackQueryMySteamUnknownUser(t *testing.T) {
+	h := newHarness(t)
+
+	h.callback(alice, "mysteam:nobody<3_1001")
+
+	edit := h.lastCall("editMessageText")
+	if want := "<b>Error:</b> User not found: nobody&lt;3"; edit.Params["text"] != want {
+		t.Errorf("text = %q, want %q", edit.Params["text"], want)
+	}
+}
+
+// ----- Commands -----
+
+func TestDynamicCommandsReply(t *testing.T) {
+	for cmd, reply := range templates.Commands {
+		for _, text := range []string{"/" + cmd, "/" + cmd + "@steam_test_bot", "/" + cmd + " extra words"} {
+			t.Run(text, func(t *testing.T) {
+				h := newHarness(t)
+
+				h.command(alice, text)
+
+				sent := h.lastCall("sendMessage")
+				if sent.Params["chat_id"] != strconv.FormatInt(alice.Id, 10) || sent.Params["text"] != reply || sent.Params["parse_mode"] != "HTML" {
+					t.Errorf("sent %v, want the %s reply to alice", sent.Params, cmd)
+				}
+
+				var replyTo gotgbot.ReplyParameters
+				if err := sent.Decode("reply_parameters", &replyTo); err != nil || replyTo.MessageId != 1 {
+					t.Errorf("reply_parameters = %+v, %v; want a reply to the command", replyTo, err)
+				}
+			})
+		}
+	}
+}
+
+func TestDynamicCommandsIgnoreOtherCommands(t *testing.T) {
+	h := newHarness(t)
+
+	for _, text := range []string{"/nosuchcommand", "/help@another_bot", "/helpme"} {
+		h.command(alice, text)
+	}
+
+	if sent := h.telegram.Calls("sendMessage"); len(sent) != 0 {
+		t.Errorf("sent %+v, want no messages", sent)
+	}
+}
@@ -0,0 +1,195 @@
+package bot
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"steam_bot/config"
+	"steam_bot/internal/faketelegram"
+	"steam_bot/internal/fakeupstream"
+	"steam_bot/steam"
+	"steam_bot/store"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// Users sending the synthetic updates
+var (
+	alice = gotgbot.User{Id: 1001, FirstName: "Alice", Username: "alice"}
+	bob   = gotgbot.User{Id: 1002, FirstName: "Bob", Username: "bob"}
+)
+
+// inlineMessageID identifies the inline message every synthetic callback comes from
+const inlineMessageID = "AgAAAFakeInlineMessage"
+
+// startFakeTelegram returns a bot whose every Bot API call goes to a fresh fake server
+func startFakeTelegram(t *testing.T) (*faketelegram.Server, *gotgbot.Bot) {
+	t.Helper()
+
+	srv := faketelegram.Start()
+	t.Cleanup(srv.Close)
+
+	b, err := srv.NewBot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Reset() // forget the bot's getMe
+	return srv, b
+}
+
+// harness feeds synthetic updates through the handlers main registers, with Telegram
+// and every upstream faked
+type harness struct {
+	t          *testing.T
+	telegram   *faketelegram.Server
+	upstream   *fakeupstream.Server
+	bot        *gotgbot.Bot
+	dispatcher *ext.Dispatcher
+	client     *steam.Client
+	watchlist  *store.Watchlist
+	prefs      *store.Preferences
+	watcher    *Watcher
+
+	// cancelRequests cancels the context updates are handled with, as Shutdown does
+	cancelRequests context.CancelFunc
+
+	lastUpdateID atomic.Int64
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	telegram, b := startFakeTelegram(t)
+
+	history, err := store.NewPriceHistory("", store.HistoryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream, client := startFakeUpstream(t, steam.WithHltbSearcher(fakeupstream.HLTB{}), steam.WithPriceHistory(history))
+
+	watchlist, err := store.NewWatchlist(filepath.Join(t.TempDir(), "watchlist.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = watchlist.Close() })
+
+	prefs, err := store.NewPreferences("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		SteamAPIKey:  fakeupstream.APIKey,
+		PriceRegions: []string{"us", "gb", "in"},
+		BaseCurrency: "USD",
+	}
+
+	base, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	h := &harness{
+		t:         t,
+		telegram:  telegram,
+		upstream:  upstream,
+		bot:       b,
+		client:    client,
+		watchlist: watchlist,
+		prefs:     prefs,
+		watcher:   NewWatcher(watchlist, client, prefs),
+
+		cancelRequests: cancel,
+	}
+	h.dispatcher = ext.NewDispatcher(&ext.DispatcherOpts{
+		Error: func(_ *gotgbot.Bot, _ *ext.Context, err error) ext.DispatcherAction {
+			t.Errorf("handling update: %v", err)
+			return ext.DispatcherActionNoop
+		},
+	})
+	if err := AddHandlers(base, h.dispatcher, b, cfg, client, h.watcher, prefs); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// process runs update through the handlers, returning once they are done
+func (h *harness) process(update gotgbot.Update) {
+	h.t.Helper()
+
+	update.UpdateId = h.lastUpdateID.Add(1)
+	if err := h.dispatcher.ProcessUpdate(h.bot, &update, nil); err != nil {
+		h.t.Fatalf("processing update: %v", err)
+	}
+}
+
+// inlineQuery sends query as typed by from after the bot's username
+func (h *harness) inlineQuery(from gotgbot.User, query string) {
+	h.process(gotgbot.Update{InlineQuery: &gotgbot.InlineQuery{
+		Id:    "inline-query",
+		From:  from,
+		Query: query,
+	}})
+}
+
+// callback presses the button carrying data on an inline message
+func (h *harness) callback(from gotgbot.User, data string) {
+	h.process(gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+		Id:              "callback-query",
+		From:            from,
+		InlineMessageId: inlineMessageID,
+		ChatInstance:    "chat-instance",
+		Data:            data,
+	}})
+}
+
+// command sends text, starting with a /command, in a private chat with from
+func (h *harness) command(from gotgbot.User, text string) {
+	command, _, _ := strings.Cut(text, " ")
+	h.process(gotgbot.Update{Message: &gotgbot.Message{
+		MessageId: 1,
+		From:      &from,
+		Chat:      gotgbot.Chat{Id: from.Id, Type: "private"},
+		Text:      text,
+		Entities: []gotgbot.MessageEntity{
+			{Type: "bot_command", Offset: 0, Length: int64(len(command))},
+		},
+	}})
+}
+
+// lastCall returns the last call of method, failing the test if there was none
+func (h *harness) lastCall(method string) faketelegram.Call {
+	h.t.Helper()
+
+	calls := h.telegram.Calls(method)
+	if len(calls) == 0 {
+		h.t.Fatalf("%s was not called", method)
+	}
+	return calls[len(calls)-1]
+}
+
+// keyboard decodes the inline keyboard a call sent
+func (h *harness) keyboard(call faketelegram.Call) gotgbot.InlineKeyboardMarkup {
+	h.t.Helper()
+
+	var markup gotgbot.InlineKeyboardMarkup
+	if err := call.Decode("reply_markup", &markup); err != nil {
+		h.t.Fatal(err)
+	}
+	return markup
+}
+
+// buttonData returns the callback data of every button in markup, row by row
+func buttonData(markup gotgbot.InlineKeyboardMarkup) []string {
+	var data []string
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if button.CallbackData != "" {
+				data = append(data, button.CallbackData)
+			}
+		}
+	}
+	return data
+}
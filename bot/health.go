@@ -0,0 +1,291 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"steam_bot/steam"
+	"steam_bot/utils"
+)
+
+// ----- Health Checks -----
+
+// Check statuses. Only a critical check that is down makes the bot unready; degraded
+// means recent failures that haven't lasted long enough to count as an outage.
+const (
+	healthOK       = "ok"
+	healthPending  = "pending"
+	healthDisabled = "disabled"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+// criticalUpstreams are the hosts the bot can't answer queries or post deals without;
+// the others only enrich replies
+var criticalUpstreams = []string{"store.steampowered.com", "www.cheapshark.com"}
+
+// updatesStaleAfter is how long polling may go without a successful getUpdates call
+// before the loop counts as dead. Each long poll returns within 10 seconds.
+const updatesStaleAfter = 2 * time.Minute
+
+// upstreamDownAfter is how long a host may fail without a single success before it
+// counts as down
+const upstreamDownAfter = 5 * time.Minute
+
+// Health tracks the subsystems the bot reports on at /healthz and /readyz. Create
+// one with NewHealth and pass it to the parts of the bot it watches.
+type Health struct {
+	mu             sync.Mutex
+	started        time.Time
+	updateMode     string    // empty until updates are being received
+	updatesSince   time.Time // when updateMode was set
+	lastPoll       time.Time // last successful getUpdates call
+	stopping       bool
+	dealsInterval  time.Duration // zero if no deal channels are configured
+	lastDealsCheck time.Time     // last successful checkAndSendDeals fetch
+	lastDealsFail  time.Time
+	lastDealsError string
+	client         *steam.Client // reports the HLTB client (nil skips the check)
+}
+
+// NewHealth starts tracking the bot's health, including client's HLTB client
+func NewHealth(client *steam.Client) *Health {
+	return &Health{started: time.Now(), client: client}
+}
+
+func (h *Health) setUpdateMode(mode string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.updateMode = mode
+	h.updatesSince = time.Now()
+}
+
+// updatesPolled records a successful getUpdates call
+func (h *Health) updatesPolled() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPoll = time.Now()
+}
+
+func (h *Health) setStopping() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopping = true
+}
+
+func (h *Health) setDealsInterval(interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dealsInterval = interval
+}
+
+// dealsChecked records the outcome of a deal fetch
+func (h *Health) dealsChecked(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err != nil {
+		h.lastDealsFail = time.Now()
+		h.lastDealsError = err.Error()
+		return
+	}
+	h.lastDealsCheck = time.Now()
+}
+
+// healthCheck is the state of one subsystem
+type healthCheck struct {
+	Status      string    `json:"status"`
+	Critical    bool      `json:"critical"`
+	Detail      string    `json:"detail,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// failing reports whether the check makes the bot unready
+func (c healthCheck) failing() bool {
+	return c.Critical && c.Status == healthDown
+}
+
+// healthReport is the body of /healthz and /readyz
+type healthReport struct {
+	Status string                 `json:"status"`
+	Uptime string                 `json:"uptime"`
+	Checks map[string]healthCheck `json:"checks"`
+}
+
+// report checks every subsystem
+func (h *Health) report(now time.Time) healthReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	checks := map[string]healthCheck{
+		"updates": h.updatesCheck(now),
+		"deals":   h.dealsCheck(now),
+		"hltb":    h.hltbCheck(),
+	}
+
+	upstreams := utils.UpstreamStatuses()
+	for _, host := range criticalUpstreams {
+		if _, ok := upstreams[host]; !ok {
+			upstreams[host] = utils.UpstreamStatus{}
+		}
+	}
+	for host, status := range upstreams {
+		checks["upstream:"+host] = h.upstreamCheck(host, status, now)
+	}
+
+	// Down if any critical check is down, degraded if anything else is failing
+	status := healthOK
+	for _, check := range checks {
+		switch {
+		case check.failing():
+			status = healthDown
+		case status == healthOK && (check.Status == healthDegraded || check.Status == healthDown):
+			status = healthDegraded
+		}
+	}
+
+	return healthReport{
+		Status: status,
+		Uptime: now.Sub(h.started).Round(time.Second).String(),
+		Checks: checks,
+	}
+}
+
+// updatesCheck expects polling to call getUpdates at least every updatesStaleAfter.
+// Telegram pushes webhook updates only when there are any, so a quiet webhook is fine.
+func (h *Health) updatesCheck(now time.Time) healthCheck {
+	check := healthCheck{Critical: true, Detail: h.updateMode, LastSuccess: h.lastPoll}
+	since := h.lastPoll
+	if since.IsZero() {
+		since = h.updatesSince
+	}
+
+	switch {
+	case h.stopping:
+		check.Status = healthDown
+		check.Detail = "shutting down"
+	case h.updateMode == "":
+		check.Status = healthDown
+		check.Detail = "not receiving updates"
+	case h.updateMode == ModePolling && now.Sub(since) > updatesStaleAfter:
+		check.Status = healthDown
+		check.Detail = "no successful getUpdates call for " + now.Sub(since).Round(time.Second).String()
+	default:
+		check.Status = healthOK
+	}
+	return check
+}
+
+// dealsCheck expects a successful fetch at least every other poll interval
+func (h *Health) dealsCheck(now time.Time) healthCheck {
+	if h.dealsInterval == 0 {
+		return healthCheck{Status: healthDisabled, Detail: "no deal channels"}
+	}
+
+	check := healthCheck{
+		Critical:    true,
+		LastSuccess: h.lastDealsCheck,
+		LastFailure: h.lastDealsFail,
+		LastError:   h.lastDealsError,
+	}
+	since := h.lastDealsCheck
+	if since.IsZero() {
+		since = h.started
+	}
+
+	switch {
+	case now.Sub(since) > 2*h.dealsInterval:
+		check.Status = healthDown
+		check.Detail = "no successful check for " + now.Sub(since).Round(time.Second).String()
+	case h.lastDealsFail.After(h.lastDealsCheck):
+		check.Status = healthDegraded
+	case h.lastDealsCheck.IsZero():
+		check.Status = healthPending
+	default:
+		check.Status = healthOK
+	}
+	return check
+}
+
+// upstreamCheck counts a host as down once it has failed for upstreamDownAfter
+// without answering
+func (h *Health) upstreamCheck(host string, status utils.UpstreamStatus, now time.Time) healthCheck {
+	check := healthCheck{
+		Critical:    slices.Contains(criticalUpstreams, host),
+		LastSuccess: status.LastSuccess,
+		LastFailure: status.LastFailure,
+		LastError:   status.LastError,
+	}
+	since := status.LastSuccess
+	if since.IsZero() {
+		since = h.started
+	}
+
+	switch {
+	case status.LastSuccess.IsZero() && status.LastFailure.IsZero():
+		check.Status = healthPending
+		check.Detail = "not requested yet"
+	case !status.LastFailure.After(status.LastSuccess):
+		check.Status = healthOK
+	case now.Sub(since) > upstreamDownAfter:
+		check.Status = healthDown
+	default:
+		check.Status = healthDegraded
+	}
+	return check
+}
+
+// hltbCheck reports the HLTB client, which is created on the first lookup. Replies
+// only lose their playtimes without it, so it isn't critical.
+func (h *Health) hltbCheck() healthCheck {
+	if h.client == nil {
+		return healthCheck{Status: healthDisabled}
+	}
+	initialized, err := h.client.HltbClientStatus()
+	switch {
+	case err != nil:
+		return healthCheck{Status: healthDown, LastError: err.Error()}
+	case !initialized:
+		return healthCheck{Status: healthPending, Detail: "initialized on first lookup"}
+	default:
+		return healthCheck{Status: healthOK}
+	}
+}
+
+// ----- Health Endpoints -----
+
+// handleHealthz is the liveness probe: it fails only when the bot has stopped
+// receiving updates, which a restart would fix
+func (h *Health) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	report := h.report(time.Now())
+	code := http.StatusOK
+	if report.Checks["updates"].failing() {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealthReport(w, code, report)
+}
+
+// handleReadyz is the readiness probe: it fails while any critical subsystem is down
+func (h *Health) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	report := h.report(time.Now())
+	code := http.StatusOK
+	if report.Status == healthDown {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealthReport(w, code, report)
+}
+
+func writeHealthReport(w http.ResponseWriter, code int, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpdatesCheck(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		state    *Health
+		now      time.Time
+		wantDown bool
+	}{
+		{"not started", &Health{}, start, true},
+		{"stopping", &Health{updateMode: ModePolling, updatesSince: start, lastPoll: start, stopping: true}, start, true},
+		{"polling, first poll pending", &Health{updateMode: ModePolling, updatesSince: start}, start.Add(time.Minute), false},
+		{"polling never succeeded", &Health{updateMode: ModePolling, updatesSince: start}, start.Add(3 * time.Minute), true},
+		{"polling recently", &Health{updateMode: ModePolling, updatesSince: start, lastPoll: start.Add(time.Hour)}, start.Add(time.Hour + 10*time.Second), false},
+		{"polling stalled", &Health{updateMode: ModePolling, updatesSince: start, lastPoll: start.Add(time.Hour)}, start.Add(time.Hour + 3*time.Minute), true},
+		{"quiet webhook", &Health{updateMode: ModeWebhook, updatesSince: start}, start.Add(24 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := tt.state.updatesCheck(tt.now)
+			if check.failing() != tt.wantDown {
+				t.Errorf("check = %+v, want down %t", check, tt.wantDown)
+			}
+		})
+	}
+}
+
+func TestHealthServerServesProbes(t *testing.T) {
+	for _, withMetrics := range []bool{false, true} {
+		server, err := StartHealthServer("127.0.0.1:0", NewHealth(nil), withMetrics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer server.Close()
+
+		for path, want := range map[string]bool{"/healthz": true, "/readyz": true, "/metrics": withMetrics} {
+			resp, err := http.Get("http://" + server.Addr + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if found := resp.StatusCode != http.StatusNotFound; found != want {
+				t.Errorf("with metrics %t: GET %s = %d, want served %t", withMetrics, path, resp.StatusCode, want)
+			}
+		}
+	}
+}
+
+func TestHealthzReportsStalledPolling(t *testing.T) {
+	health := NewHealth(nil)
+	health.updateMode = ModePolling
+	health.updatesSince = time.Now().Add(-time.Hour)
+	health.lastPoll = time.Now().Add(-5 * time.Minute)
+
+	rec := httptest.NewRecorder()
+	health.handleHealthz(rec, nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503 for a stalled polling loop", rec.Code)
+	}
+
+	var report healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if check := report.Checks["updates"]; check.Status != healthDown {
+		t.Errorf("updates check = %+v, want down", check)
+	}
+
+	health.updatesPolled()
+	rec = httptest.NewRecorder()
+	health.handleHealthz(rec, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d after a successful poll, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"steam_bot/logattr"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// ----- Lifecycle -----
+
+// Shutdown stops receiving updates, waits for in-flight handlers and the background
+// routines to finish, and gives up after timeout. On timeout cancelRequests is called
+// to abort any upstream API calls that are still running.
+func Shutdown(updater *ext.Updater, routines *sync.WaitGroup, cancelRequests context.CancelFunc, timeout time.Duration, health *Health) error {
+	health.setStopping()
+
+	done := make(chan struct{})
+	go func() {
+		// Stopping the updater also stops the dispatcher, which waits for running handlers
+		if err := updater.Stop(); err != nil {
+			slog.Error("Error stopping updater", logattr.Error(err))
+		}
+		routines.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		cancelRequests()
+		return fmt.Errorf("timed out after %s waiting for in-flight work", timeout)
+	}
+}
+
+// sleepContext pauses for d and reports whether it did so without ctx being cancelled
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
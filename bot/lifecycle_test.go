@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func TestShutdownCancelsInFlightFetches(t *testing.T) {
+	h := newHarness(t)
+	release := h.upstream.Hold("/api/storesearch/")
+	defer release()
+
+	// Run the update through the dispatcher the way the updater does, so stopping
+	// it waits for the handler
+	updates := make(chan json.RawMessage, 1)
+	defer close(updates)
+	go h.dispatcher.Start(h.bot, updates)
+
+	raw, err := json.Marshal(gotgbot.Update{UpdateId: 1, InlineQuery: &gotgbot.InlineQuery{
+		Id:    "inline-query",
+		From:  alice,
+		Query: "portal",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates <- raw
+
+	deadline := time.Now().Add(5 * time.Second)
+	for h.upstream.Requests("/api/storesearch/") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the search never reached the upstream")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var routines sync.WaitGroup
+	start := time.Now()
+	err = Shutdown(ext.NewUpdater(h.dispatcher, nil), &routines, h.cancelRequests, 100*time.Millisecond, NewHealth(nil))
+	if err == nil {
+		t.Error("Shutdown succeeded with a fetch held open, want a timeout")
+	}
+
+	// Cancelling the handler's fetch lets it answer and finish, which Stop waits for
+	deadline = time.Now().Add(5 * time.Second)
+	for len(h.telegram.Calls("answerInlineQuery")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the handler was still waiting on the upstream %s after Shutdown", time.Since(start))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"steam_bot/metrics"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// ----- Metrics -----
+
+var (
+	inlineQueries = metrics.NewCounterVec("steam_bot_inline_queries_total",
+		"Inline queries handled by kind (search, command, help) and result", "kind", "result")
+	inlineQueryDuration = metrics.NewHistogramVec("steam_bot_inline_query_duration_seconds",
+		"Time taken to answer inline queries", metrics.LatencyBuckets, "kind")
+
+	callbacks = metrics.NewCounterVec("steam_bot_callbacks_total",
+		"Callback queries handled by button type and result", "type", "result")
+	callbackDuration = metrics.NewHistogramVec("steam_bot_callback_duration_seconds",
+		"Time taken to handle callback queries", metrics.LatencyBuckets, "type")
+
+	dealsFetched = metrics.NewCounterVec("steam_bot_deals_fetched_total",
+		"Deals returned by CheapShark polls")
+	dealsPosted = metrics.NewCounterVec("steam_bot_deals_posted_total",
+		"Deals posted, by channel", "channel")
+	dealsSkipped = metrics.NewCounterVec("steam_bot_deals_skipped_total",
+		"Deals not posted, by channel and reason (seen, filtered, inactive_store, seeded, failed)", "channel", "reason")
+
+	telegramErrors = metrics.NewCounterVec("steam_bot_telegram_api_errors_total",
+		"Failed Telegram Bot API requests by method and error code (error if no response arrived)", "method", "code")
+)
+
+// String returns the type's name as used in metrics
+func (t CallbackType) String() string {
+	switch t {
+	case CallbackDetails:
+		return "details"
+	case CallbackRequirements:
+		return "requirements"
+	case CallbackHLTB:
+		return "hltb"
+	case CallbackMySteam:
+		return "mysteam"
+	case CallbackBack:
+		return "back"
+	case CallbackWatch:
+		return "watch"
+	case CallbackPriceHistory:
+		return "history"
+	case CallbackRegionalPrices:
+		return "regions"
+	default:
+		return "unknown"
+	}
+}
+
+// resultLabel turns a handler's outcome into a metric label value
+func resultLabel(failed bool) string {
+	if failed {
+		return "error"
+	}
+	return "ok"
+}
+
+// instrumentedBotClient counts failed Telegram API requests and reports successful
+// long polls to the health checks
+type instrumentedBotClient struct {
+	gotgbot.BotClient
+	health *Health
+}
+
+func (c instrumentedBotClient) RequestWithContext(ctx context.Context, token string, method string, params map[string]string, data map[string]gotgbot.FileReader, opts *gotgbot.RequestOpts) (json.RawMessage, error) {
+	resp, err := c.BotClient.RequestWithContext(ctx, token, method, params, data, opts)
+	if err != nil {
+		code := "error"
+		var tgErr *gotgbot.TelegramError
+		if errors.As(err, &tgErr) {
+			code = strconv.Itoa(tgErr.Code)
+		}
+		telegramErrors.Inc(method, code)
+	} else if method == "getUpdates" {
+		c.health.updatesPolled()
+	}
+	return resp, err
+}
@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"steam_bot/logattr"
+	"steam_bot/metrics"
+)
+
+// ----- Monitoring Servers -----
+
+// StartHealthServer serves health's liveness and readiness probes at /healthz and
+// /readyz on addr, and Prometheus metrics at /metrics too if withMetrics is set.
+// Close the returned server to stop it.
+func StartHealthServer(addr string, health *Health, withMetrics bool) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", health.handleHealthz)
+	mux.HandleFunc("GET /readyz", health.handleReadyz)
+	if withMetrics {
+		mux.Handle("GET /metrics", metrics.Handler())
+	}
+	return serveMonitoring(addr, mux)
+}
+
+// StartMetricsServer serves Prometheus metrics at /metrics on addr. Close the
+// returned server to stop it.
+func StartMetricsServer(addr string) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	return serveMonitoring(addr, mux)
+}
+
+func serveMonitoring(addr string, mux *http.ServeMux) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", addr, err)
+	}
+
+	server := &http.Server{
+		Addr:              ln.Addr().String(),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error serving monitoring endpoints", logattr.Error(err))
+		}
+	}()
+
+	slog.Info("Serving monitoring endpoints", "addr", server.Addr)
+	return server, nil
+}
@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+
+	"steam_bot/logattr"
+	"steam_bot/steam"
+	"steam_bot/store"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// ----- Region Preferences -----
+
+// regions resolves users' Steam store countries
+type regions struct {
+	client *steam.Client
+	prefs  *store.Preferences // per-user store countries; nil means everyone gets the default
+}
+
+// userCountry returns the Steam store country for a Telegram user, falling back to the client's default
+func (r regions) userCountry(userID int64) string {
+	if r.prefs != nil {
+		if cc, ok := r.prefs.Country(userID); ok {
+			return cc
+		}
+	}
+	return r.client.DefaultCountry()
+}
+
+// NewRegionCommandHandler creates the "/region" handler, which saves users' countries
+// in prefs and reports client's default country to users without one
+func NewRegionCommandHandler(base context.Context, client *steam.Client, prefs *store.Preferences) func(b *gotgbot.Bot, ctx *ext.Context) error {
+	return func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return HandleRegionCommand(base, b, ctx, client, prefs)
+	}
+}
+
+// HandleRegionCommand handles "/region [cc|reset]". Changing regions is disabled if prefs is nil.
+func HandleRegionCommand(base context.Context, b *gotgbot.Bot, ctx *ext.Context, client *steam.Client, prefs *store.Preferences) error {
+	r := regions{client: client, prefs: prefs}
+	userID := ctx.EffectiveUser.Id
+	args := commandArgs(ctx.EffectiveMessage.Text)
+
+	if len(args) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(b, fmt.Sprintf(
+			"Your Steam region is <b>%s</b>.\n\nUse <code>/region cc</code> (e.g. <code>/region us</code>) to change it or <code>/region reset</code> to use the default.",
+			strings.ToUpper(r.userCountry(userID)),
+		), &gotgbot.SendMessageOpts{ParseMode: "HTML"})
+		return err
+	}
+
+	if prefs == nil {
+		_, err := ctx.EffectiveMessage.Reply(b, "Region preferences are disabled.", nil)
+		return err
+	}
+
+	cc := strings.ToLower(args[0])
+
+	var err error
+	var reply string
+	switch {
+	case cc == "reset":
+		err = prefs.ClearCountry(userID)
+		reply = fmt.Sprintf("Region reset to the default (<b>%s</b>).", strings.ToUpper(client.DefaultCountry()))
+	case steam.IsStoreCountry(cc):
+		err = prefs.SetCountry(userID, cc)
+		reply = fmt.Sprintf("Region set to <b>%s</b>. Prices will now be shown for this Steam store.", strings.ToUpper(cc))
+	default:
+		reply = fmt.Sprintf("<code>%s</code> is not a Steam store country. Please use a two-letter country code, e.g. <code>/region us</code>.", html.EscapeString(args[0]))
+	}
+
+	if err != nil {
+		slog.ErrorContext(updateContext(base, ctx), "Error saving region preference", "country", cc, logattr.Error(err))
+		reply = "Could not save your region, please try again later."
+	}
+
+	_, err = ctx.EffectiveMessage.Reply(b, reply, &gotgbot.SendMessageOpts{ParseMode: "HTML"})
+	return err
+}
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegionCommandSavesPerUserCountry(t *testing.T) {
+	h := newHarness(t)
+
+	h.command(alice, "/region us")
+	if text := h.lastCall("sendMessage").Params["text"]; !strings.HasPrefix(text, "Region set to <b>US</b>") {
+		t.Errorf("reply = %q, want the region confirmed", text)
+	}
+	if cc, ok := h.prefs.Country(alice.Id); !ok || cc != "us" {
+		t.Errorf("alice's country = %q, %t; want us", cc, ok)
+	}
+
+	h.command(alice, "/region")
+	if text := h.lastCall("sendMessage").Params["text"]; !strings.HasPrefix(text, "Your Steam region is <b>US</b>") {
+		t.Errorf("reply = %q, want alice's region", text)
+	}
+
+	// Other users keep the client's default
+	h.command(bob, "/region")
+	if text := h.lastCall("sendMessage").Params["text"]; !strings.HasPrefix(text, "Your Steam region is <b>"+strings.ToUpper(h.client.DefaultCountry())+"</b>") {
+		t.Errorf("reply = %q, want bob on the default region", text)
+	}
+
+	h.command(alice, "/region reset")
+	if _, ok := h.prefs.Country(alice.Id); ok {
+		t.Error("alice's country was not cleared")
+	}
+}
+
+func TestRegionCommandRejectsUnknownCountries(t *testing.T) {
+	h := newHarness(t)
+
+	for _, cc := range []string{"xx", "zz", "usa", "<b>"} {
+		h.command(alice, "/region "+cc)
+		if text := h.lastCall("sendMessage").Params["text"]; !strings.Contains(text, "is not a Steam store country") {
+			t.Errorf("/region %s replied %q, want it rejected", cc, text)
+		}
+	}
+	if cc, ok := h.prefs.Country(alice.Id); ok {
+		t.Errorf("alice's country = %q, want none saved", cc)
+	}
+
+	h.command(alice, "/region GB")
+	if cc, _ := h.prefs.Country(alice.Id); cc != "gb" {
+		t.Errorf("alice's country = %q, want gb", cc)
+	}
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"steam_bot/config"
+	"steam_bot/logattr"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// ----- Update Delivery -----
+
+// Update delivery modes
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// defaultWebhookPath is used when WEBHOOK_URL has no path component
+const defaultWebhookPath = "webhook"
+
+// StartReceivingUpdates starts the updater in the configured mode and returns the
+// mode actually in use. If the webhook cannot be set up the bot falls back to
+// long polling, which deletes any webhook still registered with Telegram.
+func StartReceivingUpdates(b *gotgbot.Bot, updater *ext.Updater, cfg *config.Config, health *Health) (string, error) {
+	if cfg.UpdateMode == ModeWebhook {
+		err := startWebhook(b, updater, cfg)
+		if err == nil {
+			health.setUpdateMode(ModeWebhook)
+			return ModeWebhook, nil
+		}
+		slog.Error("Error starting webhook, falling back to polling", logattr.Error(err))
+	}
+
+	if err := startPolling(b, updater); err != nil {
+		return "", err
+	}
+	health.setUpdateMode(ModePolling)
+	return ModePolling, nil
+}
+
+func startPolling(b *gotgbot.Bot, updater *ext.Updater) error {
+	err := updater.StartPolling(b, &ext.PollingOpts{
+		DropPendingUpdates:    true,
+		EnableWebhookDeletion: true,
+		GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
+			Timeout: 9,
+			RequestOpts: &gotgbot.RequestOpts{
+				Timeout: time.Second * 10,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("starting polling: %w", err)
+	}
+	return nil
+}
+
+func startWebhook(b *gotgbot.Bot, updater *ext.Updater, cfg *config.Config) error {
+	domain, urlPath, err := splitWebhookURL(cfg.WebhookURL)
+	if err != nil {
+		return err
+	}
+
+	// The server goroutine loads the certificate and panics if it can't, so check it
+	// while falling back is still possible
+	if cfg.WebhookCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.WebhookCertFile, cfg.WebhookKeyFile); err != nil {
+			return fmt.Errorf("loading webhook certificate: %w", err)
+		}
+	}
+
+	// Register with Telegram first: if that fails nothing is listening yet. Polling
+	// deletes the webhook again if the server below fails to start.
+	_, err = b.SetWebhook(domain+"/"+urlPath, &gotgbot.SetWebhookOpts{
+		MaxConnections:     100,
+		DropPendingUpdates: true,
+		SecretToken:        cfg.WebhookSecret,
+	})
+	if err != nil {
+		return fmt.Errorf("setting webhook: %w", err)
+	}
+
+	err = updater.AddWebhook(b, urlPath, &ext.AddWebhookOpts{SecretToken: cfg.WebhookSecret})
+	if err != nil {
+		return fmt.Errorf("adding webhook: %w", err)
+	}
+
+	err = updater.StartServer(ext.WebhookOpts{
+		ListenAddr:  cfg.WebhookListenAddr,
+		SecretToken: cfg.WebhookSecret,
+		CertFile:    cfg.WebhookCertFile,
+		KeyFile:     cfg.WebhookKeyFile,
+	})
+	if err != nil {
+		// Remove the bot and stop its dispatcher, so polling can take over on the same updater
+		updater.StopBot(b.Token)
+		return fmt.Errorf("starting webhook server: %w", err)
+	}
+
+	slog.Info("Receiving updates via webhook", "url", domain+"/"+urlPath, "listen_addr", cfg.WebhookListenAddr)
+	return nil
+}
+
+// splitWebhookURL splits a public webhook URL into the domain Telegram calls and the path served locally
+func splitWebhookURL(rawURL string) (string, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid WEBHOOK_URL: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid WEBHOOK_URL %q: must be an absolute https URL", rawURL)
+	}
+
+	urlPath := strings.Trim(u.Path, "/")
+	if urlPath == "" {
+		urlPath = defaultWebhookPath
+	}
+
+	return u.Scheme + "://" + u.Host, urlPath, nil
+}
@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"steam_bot/config"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func TestStartReceivingUpdatesFallsBackWhenListenAddrIsTaken(t *testing.T) {
+	telegram, b := startFakeTelegram(t)
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	updater := ext.NewUpdater(ext.NewDispatcher(nil), nil)
+	defer func() { _ = updater.Stop() }()
+
+	mode, err := StartReceivingUpdates(b, updater, &config.Config{
+		UpdateMode:        ModeWebhook,
+		WebhookURL:        "https://bot.example.com/hook",
+		WebhookListenAddr: taken.Addr().String(),
+	}, NewHealth(nil))
+	if err != nil {
+		t.Fatalf("falling back to polling: %v", err)
+	}
+	if mode != ModePolling {
+		t.Errorf("mode = %s, want %s", mode, ModePolling)
+	}
+
+	// The webhook was registered, then deleted when polling took over
+	if len(telegram.Calls("setWebhook")) != 1 || len(telegram.Calls("deleteWebhook")) != 1 {
+		t.Errorf("calls = %+v, want setWebhook then deleteWebhook", telegram.Calls(""))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(telegram.Calls("getUpdates")) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("polling never called getUpdates")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartReceivingUpdatesFallsBackOnBadCertificate(t *testing.T) {
+	telegram, b := startFakeTelegram(t)
+
+	updater := ext.NewUpdater(ext.NewDispatcher(nil), nil)
+	defer func() { _ = updater.Stop() }()
+
+	mode, err := StartReceivingUpdates(b, updater, &config.Config{
+		UpdateMode:        ModeWebhook,
+		WebhookURL:        "https://bot.example.com/hook",
+		WebhookListenAddr: "127.0.0.1:0",
+		WebhookCertFile:   "testdata/missing.crt",
+		WebhookKeyFile:    "testdata/missing.key",
+	}, NewHealth(nil))
+	if err != nil || mode != ModePolling {
+		t.Fatalf("mode = %q, %v; want a fallback to polling", mode, err)
+	}
+	if n := len(telegram.Calls("setWebhook")); n != 0 {
+		t.Errorf("webhook was set %d times with an unusable certificate", n)
+	}
+}
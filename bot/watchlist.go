@@ -0,0 +1,370 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"steam_bot/logattr"
+	"steam_bot/steam"
+	"steam_bot/store"
+	"steam_bot/templates"
+	"steam_bot/utils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// ----- Watchlist -----
+
+// Watcher manages users' price-drop watchlists and sends private alerts
+type Watcher struct {
+	list    *store.Watchlist
+	steam   *steam.Client
+	regions regions
+}
+
+// NewWatcher creates a Watcher backed by list, looking prices up with client. Alerts
+// quote the Steam price in each user's store country from prefs, which may be nil.
+func NewWatcher(list *store.Watchlist, client *steam.Client, prefs *store.Preferences) *Watcher {
+	return &Watcher{list: list, steam: client, regions: regions{client: client, prefs: prefs}}
+}
+
+// watchGame resolves an app on CheapShark and adds it to the user's watchlist
+func (w *Watcher) watchGame(ctx context.Context, userID int64, appID string, targetPrice float64) (store.WatchEntry, error) {
+	gameID, err := w.steam.FindCheapSharkGameID(ctx, appID)
+	if err != nil {
+		return store.WatchEntry{}, err
+	}
+
+	game, err := w.steam.GetCheapSharkGame(ctx, gameID)
+	if err != nil {
+		return store.WatchEntry{}, err
+	}
+
+	var current float64
+	if deal, ok := game.CheapestDeal(); ok {
+		current = parsePrice(deal.Price)
+	}
+
+	entry := store.WatchEntry{
+		UserID:        userID,
+		AppID:         appID,
+		GameID:        gameID,
+		Title:         game.Info.Title,
+		TargetPrice:   targetPrice,
+		BaselinePrice: current,
+		LastPrice:     current,
+		AddedAt:       time.Now(),
+		CheckedAt:     time.Now(),
+	}
+
+	if err := w.list.Add(entry); err != nil {
+		return store.WatchEntry{}, err
+	}
+	return entry, nil
+}
+
+// HandleWatchCommand handles "/watch <appid|name> [$price]"
+func (w *Watcher) HandleWatchCommand(base context.Context, b *gotgbot.Bot, ctx *ext.Context) error {
+	args := commandArgs(ctx.EffectiveMessage.Text)
+	if len(args) == 0 {
+		_, err := ctx.EffectiveMessage.Reply(b, "Usage: <code>/watch appid|name [$price]</code>", &gotgbot.SendMessageOpts{
+			ParseMode: "HTML",
+		})
+		return err
+	}
+
+	args, targetPrice := splitTargetPrice(args)
+
+	reqCtx, cancel := newRequestContext(updateContext(base, ctx))
+	defer cancel()
+
+	appID, err := resolveAppID(reqCtx, w.steam, strings.Join(args, " "))
+	if err != nil {
+		reply := "Could not find that game on Steam."
+		if !errors.Is(err, steam.ErrNotFound) {
+			slog.ErrorContext(reqCtx, "Error resolving game to watch", logattr.Error(err))
+			reply = upstreamErrorText("Steam", err)
+		}
+		_, err = ctx.EffectiveMessage.Reply(b, reply, nil)
+		return err
+	}
+
+	entry, err := w.watchGame(reqCtx, ctx.EffectiveUser.Id, appID, targetPrice)
+	if err != nil {
+		slog.ErrorContext(reqCtx, "Error adding watch", logattr.Error(err))
+		_, err = ctx.EffectiveMessage.Reply(b, watchErrorText(err), nil)
+		return err
+	}
+
+	reply := fmt.Sprintf("🔔 Watching <b>%s</b>", html.EscapeString(entry.Title))
+	if entry.TargetPrice > 0 {
+		reply += fmt.Sprintf(" for a price at or below <code>$%.2f</code>", entry.TargetPrice)
+	} else if entry.LastPrice > 0 {
+		reply += fmt.Sprintf(" for any drop below <code>$%.2f</code>", entry.LastPrice)
+	}
+	reply += ".\n\nAlerts are sent in a private chat with me."
+
+	_, err = ctx.EffectiveMessage.Reply(b, reply, &gotgbot.SendMessageOpts{ParseMode: "HTML"})
+	return err
+}
+
+// HandleWatchlistCommand handles "/watchlist"
+func (w *Watcher) HandleWatchlistCommand(b *gotgbot.Bot, ctx *ext.Context) error {
+	entries := w.list.List(ctx.EffectiveUser.Id)
+
+	items := make([]templates.WatchItem, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, templates.WatchItem{
+			AppID:       e.AppID,
+			Title:       e.Title,
+			TargetPrice: e.TargetPrice,
+			LastPrice:   e.LastPrice,
+		})
+	}
+
+	_, err := ctx.EffectiveMessage.Reply(b, templates.FormatWatchlist(items), &gotgbot.SendMessageOpts{
+		ParseMode: "HTML",
+	})
+	return err
+}
+
+// HandleUnwatchCommand handles "/unwatch <appid>"
+func (w *Watcher) HandleUnwatchCommand(base context.Context, b *gotgbot.Bot, ctx *ext.Context) error {
+	args := commandArgs(ctx.EffectiveMessage.Text)
+	if len(args) != 1 {
+		_, err := ctx.EffectiveMessage.Reply(b, "Usage: <code>/unwatch appid</code>", &gotgbot.SendMessageOpts{
+			ParseMode: "HTML",
+		})
+		return err
+	}
+
+	removed, err := w.list.Remove(ctx.EffectiveUser.Id, args[0])
+	if err != nil {
+		slog.ErrorContext(updateContext(base, ctx, slog.String(utils.LogKeyAppID, args[0])), "Error removing watch", logattr.Error(err))
+	}
+
+	reply := "That game is not on your watchlist."
+	if removed {
+		reply = "Removed from your watchlist."
+	}
+	_, err = ctx.EffectiveMessage.Reply(b, reply, nil)
+	return err
+}
+
+// handleWatchCallback adds the game behind a "🔔 Watch" button to the presser's watchlist
+func (w *Watcher) handleWatchCallback(reqCtx context.Context, b *gotgbot.Bot, ctx *ext.Context, cbData CallbackData) error {
+	entry, err := w.watchGame(reqCtx, cbData.UserID, cbData.AppID, 0)
+	if err != nil {
+		slog.ErrorContext(reqCtx, "Error adding watch", logattr.Error(err))
+		return answerCallbackError(b, ctx, watchErrorText(err))
+	}
+
+	_, _ = ctx.CallbackQuery.Answer(b, &gotgbot.AnswerCallbackQueryOpts{
+		Text:      fmt.Sprintf("Watching %s. Start a private chat with me to receive price alerts.", entry.Title),
+		ShowAlert: true,
+	})
+	return nil
+}
+
+// ----- Watchlist Routine -----
+
+// WatchlistRoutine re-checks every watched game's price at the given interval
+func (w *Watcher) WatchlistRoutine(ctx context.Context, b *gotgbot.Bot, interval time.Duration) {
+	ctx = utils.WithPriority(ctx, utils.PriorityBackground)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.checkWatchlist(ctx, b)
+		}
+	}
+}
+
+func (w *Watcher) checkWatchlist(ctx context.Context, b *gotgbot.Bot) {
+	entries := w.list.All()
+	if len(entries) == 0 {
+		return
+	}
+	slog.InfoContext(ctx, "Checking watched games", "count", len(entries))
+
+	// Several users often watch the same game; look each one up once
+	games := make(map[string]*steam.CheapSharkGame)
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		game, ok := games[entry.GameID]
+		if !ok {
+			var err error
+			game, err = w.steam.GetCheapSharkGame(ctx, entry.GameID)
+			if err != nil {
+				slog.ErrorContext(ctx, "Error checking watched game", utils.LogKeyAppID, entry.AppID, "game_id", entry.GameID, logattr.Error(err))
+				continue
+			}
+			games[entry.GameID] = game
+		}
+
+		w.checkWatch(ctx, b, entry, game)
+	}
+}
+
+func (w *Watcher) checkWatch(ctx context.Context, b *gotgbot.Bot, entry store.WatchEntry, game *steam.CheapSharkGame) {
+	ctx = utils.WithLogAttrs(ctx, slog.Int64(utils.LogKeyUserID, entry.UserID), slog.String(utils.LogKeyAppID, entry.AppID))
+	deal, ok := game.CheapestDeal()
+	if !ok {
+		return
+	}
+
+	price := parsePrice(deal.Price)
+	historicalLow := game.HistoricalLow()
+	isHistoricalLow := historicalLow > 0 && price <= historicalLow
+
+	var triggered bool
+	if entry.TargetPrice > 0 {
+		triggered = price <= entry.TargetPrice
+	} else {
+		triggered = entry.BaselinePrice > 0 && price < entry.BaselinePrice
+	}
+	triggered = triggered || isHistoricalLow
+
+	entry.LastPrice = price
+	entry.CheckedAt = time.Now()
+
+	switch {
+	case !triggered:
+		// Re-arm so the next drop alerts again
+		entry.LastAlertPrice = 0
+	case entry.LastAlertPrice == 0 || price < entry.LastAlertPrice:
+		msg := templates.FormatWatchAlert(
+			entry.Title,
+			price,
+			parsePrice(deal.RetailPrice),
+			historicalLow,
+			w.steam.GetStore(ctx, deal.StoreID).StoreName,
+			isHistoricalLow,
+			w.regionalSteamPrice(ctx, entry.UserID, entry.AppID),
+		)
+
+		_, err := b.SendMessage(entry.UserID, msg, &gotgbot.SendMessageOpts{
+			ParseMode: "HTML",
+			ReplyMarkup: gotgbot.InlineKeyboardMarkup{
+				InlineKeyboard: [][]gotgbot.InlineKeyboardButton{{
+					{Text: "Claim Deal", Url: steam.DealRedirectURL(deal.DealID)},
+				}},
+			},
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Error sending price alert", logattr.Error(err))
+			return
+		}
+		entry.LastAlertPrice = price
+	}
+
+	if err := w.list.UpdateCheck(entry); err != nil {
+		slog.ErrorContext(ctx, "Error updating watch", logattr.Error(err))
+	}
+}
+
+// ----- Helpers -----
+
+// regionalSteamPrice returns the app's formatted Steam price in the user's region, or "" if unavailable
+func (w *Watcher) regionalSteamPrice(ctx context.Context, userID int64, appID string) string {
+	cc := w.regions.userCountry(userID)
+	prices, err := w.steam.GetPricesInRegion(ctx, []string{appID}, cc)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error getting regional price for alert", logattr.Error(err))
+		return ""
+	}
+
+	p, ok := prices[appID]
+	if !ok || !p.Available {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", strings.ReplaceAll(p.Price.FinalFormatted, " ", ""), strings.ToUpper(cc))
+}
+
+// watchErrorText explains why a game could not be added to a watchlist
+func watchErrorText(err error) string {
+	switch {
+	case errors.Is(err, store.ErrWatchlistFull):
+		return fmt.Sprintf("Your watchlist is full (%d games). Remove one with /unwatch first.", store.MaxWatchesPerUser)
+	case errors.Is(err, steam.ErrNotFound):
+		return "Price tracking isn't available for this game."
+	default:
+		return upstreamErrorText("CheapShark", err)
+	}
+}
+
+// splitTargetPrice splits a target price off the end of the /watch arguments. Many
+// titles end in a number ("Cyberpunk 2077"), so a price needs a $ or @ marker unless
+// it follows an app ID.
+func splitTargetPrice(args []string) ([]string, float64) {
+	if len(args) < 2 {
+		return args, 0
+	}
+
+	last := args[len(args)-1]
+	number, marked := strings.CutPrefix(last, "$")
+	if !marked {
+		number, marked = strings.CutPrefix(last, "@")
+	}
+	if !marked && (len(args) != 2 || !isAppID(args[0])) {
+		return args, 0
+	}
+
+	price, err := strconv.ParseFloat(number, 64)
+	if err != nil || price <= 0 {
+		return args, 0
+	}
+	return args[:len(args)-1], price
+}
+
+// isAppID reports whether s is a numeric Steam app ID
+func isAppID(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// commandArgs returns the whitespace-separated arguments after a /command
+func commandArgs(text string) []string {
+	fields := strings.Fields(text)
+	if len(fields) <= 1 {
+		return nil
+	}
+	return fields[1:]
+}
+
+// resolveAppID returns query itself if it is a numeric app ID, otherwise the top Steam search hit
+func resolveAppID(ctx context.Context, client *steam.Client, query string) (string, error) {
+	if isAppID(query) {
+		return query, nil
+	}
+
+	results, err := client.SearchSteam(ctx, query, "")
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("no results for %q: %w", query, steam.ErrNotFound)
+	}
+	return strconv.Itoa(results[0].ID), nil
+}
+
+func parsePrice(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
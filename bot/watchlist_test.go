@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWatchCommandTargetPrice(t *testing.T) {
+	tests := []struct {
+		text   string
+		target float64
+	}{
+		{"/watch Portal 2", 0},
+		{"/watch Portal 2 $5", 5},
+		{"/watch Portal 2 @5", 5},
+		{"/watch 620", 0},
+		{"/watch 620 5", 5},
+		{"/watch 620 $5", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			h := newHarness(t)
+
+			h.command(alice, tt.text)
+
+			entries := h.watchlist.List(alice.Id)
+			if len(entries) != 1 {
+				t.Fatalf("watchlist has %d entries, want 1", len(entries))
+			}
+			if e := entries[0]; e.AppID != "620" || e.TargetPrice != tt.target {
+				t.Errorf("watching %s with target %v, want 620 with %v", e.AppID, e.TargetPrice, tt.target)
+			}
+			if reply := h.lastCall("sendMessage").Params["text"]; !strings.HasPrefix(reply, "🔔 Watching <b>Portal 2</b>") {
+				t.Errorf("reply = %q", reply)
+			}
+		})
+	}
+}
+
+func TestWatchCommandKeepsTrailingNumberInTitle(t *testing.T) {
+	h := newHarness(t)
+
+	h.command(alice, "/watch Portal 2")
+
+	if n := h.upstream.Requests("/api/storesearch/"); n != 1 {
+		t.Fatalf("store was searched %d times, want 1", n)
+	}
+	if entries := h.watchlist.List(alice.Id); len(entries) != 1 || entries[0].TargetPrice != 0 {
+		t.Errorf("entries = %+v, want Portal 2 watched for any drop", entries)
+	}
+}
+
+func TestCheckWatchKeepsTargetChangedMeanwhile(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	h.command(alice, "/watch 620 $5")
+	checked := h.watchlist.List(alice.Id)[0]
+
+	// The user sets a new target while the check is running
+	h.command(alice, "/watch 620 $0.5")
+
+	game, err := h.client.GetCheapSharkGame(ctx, checked.GameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.watcher.checkWatch(ctx, h.bot, checked, game)
+
+	if e := h.watchlist.List(alice.Id)[0]; e.TargetPrice != 0.5 {
+		t.Errorf("target = %v after the check, want the new 0.5", e.TargetPrice)
+	}
+}
+
+func TestCheckWatchRecordsPrice(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	h.command(alice, "/watch 620 $5")
+	checked := h.watchlist.List(alice.Id)[0]
+	h.telegram.Reset()
+
+	game, err := h.client.GetCheapSharkGame(ctx, checked.GameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.watcher.checkWatch(ctx, h.bot, checked, game)
+
+	e := h.watchlist.List(alice.Id)[0]
+	if e.TargetPrice != 5 || e.LastAlertPrice != 0.99 || !e.CheckedAt.After(checked.CheckedAt) {
+		t.Errorf("entry = %+v, want an alert at 0.99 recorded", e)
+	}
+	if sent := h.telegram.Calls("sendMessage"); len(sent) != 1 || sent[0].Params["chat_id"] != "1001" {
+		t.Errorf("sent %+v, want one alert to alice", sent)
+	}
+}
+
+func TestWatchMessagesEscapeTitles(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	h.command(alice, "/watch 620 $5")
+	entry := h.watchlist.List(alice.Id)[0]
+	entry.Title = "Command & Conquer <Remastered>"
+	if err := h.watchlist.Add(entry); err != nil {
+		t.Fatal(err)
+	}
+	const escaped = "<b>Command &amp; Conquer &lt;Remastered&gt;</b>"
+
+	h.command(alice, "/watchlist")
+	if text := h.lastCall("sendMessage").Params["text"]; !strings.Contains(text, escaped) {
+		t.Errorf("watchlist = %q, want the title escaped", text)
+	}
+
+	game, err := h.client.GetCheapSharkGame(ctx, entry.GameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.watcher.checkWatch(ctx, h.bot, entry, game)
+	if text := h.lastCall("sendMessage").Params["text"]; !strings.Contains(text, escaped) {
+		t.Errorf("alert = %q, want the title escaped", text)
+	}
+}
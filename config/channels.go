@@ -0,0 +1,155 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"steam_bot/steam"
+	"steam_bot/templates"
+)
+
+// ChannelConfig describes one channel that receives deal posts
+type ChannelConfig struct {
+	Name       string
+	ChatID     int64
+	Filter     steam.DealFilter
+	Interval   time.Duration
+	Template   string
+	Country    string // Steam store country for local prices (empty = default)
+	LedgerPath string
+}
+
+// channelFileEntry is the on-disk JSON shape of a ChannelConfig
+type channelFileEntry struct {
+	Name       string          `json:"name"`
+	ChatID     int64           `json:"chat_id"`
+	Filter     json.RawMessage `json:"filter"`
+	Interval   string          `json:"interval"`
+	Template   string          `json:"template"`
+	Country    string          `json:"country"`
+	LedgerPath string          `json:"ledger_path"`
+}
+
+const defaultDealsInterval = time.Hour
+
+// loadDefaultChannel builds the single-channel setup from CHANNEL_ID and the DEALS_* variables
+func loadDefaultChannel(ledgerPath string) ChannelConfig {
+	channelIDStr := os.Getenv("CHANNEL_ID")
+	if channelIDStr == "" {
+		log.Fatal("CHANNEL_ID is not set")
+	}
+
+	channelID, err := strconv.ParseInt(channelIDStr, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid CHANNEL_ID: %v", err)
+	}
+
+	template := getEnv("DEALS_TEMPLATE", "default")
+	if _, ok := templates.DealTemplates[template]; !ok {
+		log.Fatalf("Invalid DEALS_TEMPLATE: unknown template %q", template)
+	}
+
+	country := strings.ToLower(os.Getenv("DEALS_COUNTRY"))
+	if country != "" && !steam.IsStoreCountry(country) {
+		log.Fatalf("Invalid DEALS_COUNTRY: %q is not a Steam store country code", country)
+	}
+
+	return ChannelConfig{
+		Name:       "default",
+		ChatID:     channelID,
+		Filter:     loadDealFilter(),
+		Interval:   getEnvInterval("DEALS_INTERVAL", defaultDealsInterval),
+		Template:   template,
+		Country:    country,
+		LedgerPath: ledgerPath,
+	}
+}
+
+// loadChannelsFile reads a JSON array of channel targets. Filter fields that are
+// omitted fall back to steam.DefaultDealFilter, and each channel gets its own
+// ledger file next to defaultLedgerPath unless ledger_path is given.
+func loadChannelsFile(path, defaultLedgerPath string) ([]ChannelConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var entries []channelFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s defines no channels", path)
+	}
+
+	channels := make([]ChannelConfig, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+
+	for i, entry := range entries {
+		if entry.Name == "" {
+			entry.Name = strconv.Itoa(i)
+		}
+		if seen[entry.Name] {
+			return nil, fmt.Errorf("duplicate channel name %q", entry.Name)
+		}
+		seen[entry.Name] = true
+
+		if entry.ChatID == 0 {
+			return nil, fmt.Errorf("channel %q: chat_id is required", entry.Name)
+		}
+
+		filter := steam.DefaultDealFilter
+		filter.StoreIDs = slices.Clone(filter.StoreIDs)
+		if len(entry.Filter) > 0 {
+			if err := json.Unmarshal(entry.Filter, &filter); err != nil {
+				return nil, fmt.Errorf("channel %q: decoding filter: %w", entry.Name, err)
+			}
+		}
+		if err := filter.Validate(); err != nil {
+			return nil, fmt.Errorf("channel %q: %w", entry.Name, err)
+		}
+
+		interval := defaultDealsInterval
+		if entry.Interval != "" {
+			interval, err = time.ParseDuration(entry.Interval)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("channel %q: invalid interval %q", entry.Name, entry.Interval)
+			}
+		}
+
+		if entry.Template == "" {
+			entry.Template = "default"
+		}
+		if _, ok := templates.DealTemplates[entry.Template]; !ok {
+			return nil, fmt.Errorf("channel %q: unknown template %q", entry.Name, entry.Template)
+		}
+
+		entry.Country = strings.ToLower(entry.Country)
+		if entry.Country != "" && !steam.IsStoreCountry(entry.Country) {
+			return nil, fmt.Errorf("channel %q: %q is not a Steam store country code", entry.Name, entry.Country)
+		}
+
+		if entry.LedgerPath == "" {
+			entry.LedgerPath = filepath.Join(filepath.Dir(defaultLedgerPath), "sent_deals_"+entry.Name+".json")
+		}
+
+		channels = append(channels, ChannelConfig{
+			Name:       entry.Name,
+			ChatID:     entry.ChatID,
+			Filter:     filter,
+			Interval:   interval,
+			Template:   entry.Template,
+			Country:    entry.Country,
+			LedgerPath: entry.LedgerPath,
+		})
+	}
+
+	return channels, nil
+}
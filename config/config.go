@@ -2,17 +2,74 @@ package config
 
 import (
 	"log"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"steam_bot/steam"
+	"steam_bot/store"
+	"steam_bot/utils"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	BotToken    string
-	ChannelID   int64
 	HltbAPI     string
 	SteamAPIKey string
+
+	AdminIDs []int64
+
+	LedgerBackend    string
+	LedgerPath       string
+	LedgerMaxAge     time.Duration
+	LedgerMaxEntries int
+
+	Channels []ChannelConfig
+
+	WatchlistPath     string
+	WatchlistInterval time.Duration
+
+	PriceHistoryPath          string
+	PriceHistoryFlushInterval time.Duration
+	PriceHistoryMaxAge        time.Duration
+	PriceHistoryMaxApps       int
+
+	PriceRegions []string
+	BaseCurrency string
+
+	DefaultCountry  string
+	PreferencesPath string
+
+	UpdateMode        string
+	WebhookURL        string
+	WebhookListenAddr string
+	WebhookSecret     string
+	WebhookCertFile   string
+	WebhookKeyFile    string
+
+	ShutdownTimeout time.Duration
+
+	LogLevel  slog.Level
+	LogFormat string
+
+	HealthAddr  string
+	MetricsAddr string
+
+	TracingEndpoint    string
+	TracingHeaders     map[string]string
+	TracingServiceName string
+	TracingSampleRatio float64
+
+	CacheStaleWhileRevalidate time.Duration
+	CacheStaleOnError         time.Duration
+
+	CacheBackend   string
+	CacheBackends  map[string]string
+	RedisURL       string
+	RedisKeyPrefix string
 }
 
 func LoadConfig() *Config {
@@ -26,23 +83,273 @@ func LoadConfig() *Config {
 		log.Fatal("BOT_TOKEN is not set")
 	}
 
-	channelIDStr := os.Getenv("CHANNEL_ID")
-	if channelIDStr == "" {
-		log.Fatal("CHANNEL_ID is not set")
-	}
-
-	channelID, err := strconv.ParseInt(channelIDStr, 10, 64)
-	if err != nil {
-		log.Fatalf("Invalid CHANNEL_ID: %v", err)
-	}
-
 	hltbAPI := os.Getenv("HLTB_API")
 	steamAPIKey := os.Getenv("STEAM_API_KEY")
 
-	return &Config{
+	cfg := &Config{
 		BotToken:    botToken,
-		ChannelID:   channelID,
 		HltbAPI:     hltbAPI,
 		SteamAPIKey: steamAPIKey,
+
+		AdminIDs: getEnvIDs("ADMIN_IDS"),
+
+		LedgerBackend:    getEnv("LEDGER_BACKEND", "file"),
+		LedgerPath:       getEnv("LEDGER_PATH", "data/sent_deals.json"),
+		LedgerMaxAge:     getEnvDuration("LEDGER_MAX_AGE", 30*24*time.Hour),
+		LedgerMaxEntries: getEnvInt("LEDGER_MAX_ENTRIES", 200),
+
+		WatchlistPath:     getEnv("WATCHLIST_PATH", "data/watchlist.json"),
+		WatchlistInterval: getEnvInterval("WATCHLIST_INTERVAL", 3*time.Hour),
+
+		PriceHistoryPath:          getEnv("PRICE_HISTORY_PATH", "data/price_history.json"),
+		PriceHistoryFlushInterval: getEnvDuration("PRICE_HISTORY_FLUSH_INTERVAL", store.DefaultHistoryPolicy.FlushInterval),
+		PriceHistoryMaxAge:        getEnvDuration("PRICE_HISTORY_MAX_AGE", store.DefaultHistoryPolicy.MaxAge),
+		PriceHistoryMaxApps:       getEnvInt("PRICE_HISTORY_MAX_APPS", store.DefaultHistoryPolicy.MaxApps),
+
+		PriceRegions: getEnvList("PRICE_REGIONS", []string{"us", "gb", "de", "ca", "au", "br", "in", "jp"}),
+		BaseCurrency: strings.ToUpper(getEnv("BASE_CURRENCY", "USD")),
+
+		DefaultCountry:  strings.ToLower(getEnv("DEFAULT_COUNTRY", "us")),
+		PreferencesPath: getEnv("PREFERENCES_PATH", "data/preferences.json"),
+
+		WebhookURL:        os.Getenv("WEBHOOK_URL"),
+		WebhookListenAddr: getEnv("WEBHOOK_LISTEN_ADDR", ":8080"),
+		WebhookSecret:     os.Getenv("WEBHOOK_SECRET"),
+		WebhookCertFile:   os.Getenv("WEBHOOK_CERT_FILE"),
+		WebhookKeyFile:    os.Getenv("WEBHOOK_KEY_FILE"),
+
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+
+		LogFormat: strings.ToLower(getEnv("LOG_FORMAT", utils.LogFormatJSON)),
+
+		HealthAddr:  getEnv("HEALTH_ADDR", ":8081"),
+		MetricsAddr: os.Getenv("METRICS_ADDR"),
+
+		TracingEndpoint:    tracesEndpoint(),
+		TracingHeaders:     getEnvPairs("OTEL_EXPORTER_OTLP_HEADERS"),
+		TracingServiceName: getEnv("OTEL_SERVICE_NAME", "steam_bot"),
+		TracingSampleRatio: getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+
+		CacheStaleWhileRevalidate: getEnvDuration("CACHE_STALE_WHILE_REVALIDATE", time.Hour),
+		CacheStaleOnError:         getEnvDuration("CACHE_STALE_ON_ERROR", 24*time.Hour),
+
+		CacheBackend:   strings.ToLower(getEnv("CACHE_BACKEND", "memory")),
+		CacheBackends:  getEnvMap("CACHE_BACKENDS"),
+		RedisURL:       os.Getenv("REDIS_URL"),
+		RedisKeyPrefix: getEnv("REDIS_KEY_PREFIX", "steam_bot"),
+	}
+
+	// Webhook mode is the default once a public URL is configured
+	defaultMode := "polling"
+	if cfg.WebhookURL != "" {
+		defaultMode = "webhook"
+	}
+	cfg.UpdateMode = strings.ToLower(getEnv("UPDATE_MODE", defaultMode))
+
+	switch cfg.UpdateMode {
+	case "polling":
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			log.Fatal("UPDATE_MODE=webhook requires WEBHOOK_URL")
+		}
+		if (cfg.WebhookCertFile == "") != (cfg.WebhookKeyFile == "") {
+			log.Fatal("WEBHOOK_CERT_FILE and WEBHOOK_KEY_FILE must be set together")
+		}
+	default:
+		log.Fatalf("Invalid UPDATE_MODE: %q (expected polling or webhook)", cfg.UpdateMode)
+	}
+
+	cfg.LogLevel, err = utils.ParseLogLevel(getEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	if cfg.LogFormat != utils.LogFormatJSON && cfg.LogFormat != utils.LogFormatText {
+		log.Fatalf("Invalid LOG_FORMAT: %q (expected %s or %s)", cfg.LogFormat, utils.LogFormatJSON, utils.LogFormatText)
+	}
+	if !steam.IsStoreCountry(cfg.DefaultCountry) {
+		log.Fatalf("Invalid DEFAULT_COUNTRY: %q is not a Steam store country code", cfg.DefaultCountry)
+	}
+	for i, cc := range cfg.PriceRegions {
+		cfg.PriceRegions[i] = strings.ToLower(cc)
+		if !steam.IsStoreCountry(cfg.PriceRegions[i]) {
+			log.Fatalf("Invalid PRICE_REGIONS: %q is not a Steam store country code", cc)
+		}
+	}
+
+	if channelsFile := os.Getenv("CHANNELS_FILE"); channelsFile != "" {
+		cfg.Channels, err = loadChannelsFile(channelsFile, cfg.LedgerPath)
+		if err != nil {
+			log.Fatalf("Invalid CHANNELS_FILE: %v", err)
+		}
+	} else {
+		cfg.Channels = []ChannelConfig{loadDefaultChannel(cfg.LedgerPath)}
+	}
+
+	return cfg
+}
+
+// loadDealFilter reads the DEALS_* variables, defaulting to steam.DefaultDealFilter
+func loadDealFilter() steam.DealFilter {
+	def := steam.DefaultDealFilter
+
+	storeIDs := getEnvList("DEALS_STORE_IDS", def.StoreIDs)
+	if len(storeIDs) == 1 && strings.EqualFold(storeIDs[0], "all") {
+		storeIDs = nil
+	}
+
+	filter := steam.DealFilter{
+		StoreIDs:       storeIDs,
+		PageSize:       getEnvInt("DEALS_PAGE_SIZE", def.PageSize),
+		MinSavings:     getEnvFloat("DEALS_MIN_SAVINGS", def.MinSavings),
+		MinPrice:       getEnvFloat("DEALS_MIN_PRICE", def.MinPrice),
+		MaxPrice:       getEnvFloat("DEALS_MAX_PRICE", def.MaxPrice),
+		MinMetacritic:  getEnvInt("DEALS_MIN_METACRITIC", def.MinMetacritic),
+		MinSteamRating: getEnv("DEALS_MIN_STEAM_RATING", def.MinSteamRating),
+		MinDealRating:  getEnvFloat("DEALS_MIN_DEAL_RATING", def.MinDealRating),
+		AAAOnly:        getEnvBool("DEALS_AAA_ONLY", def.AAAOnly),
+		ExcludedTitles: getEnvList("DEALS_EXCLUDE_TITLES", def.ExcludedTitles),
+		ExcludedAppIDs: getEnvList("DEALS_EXCLUDE_APPIDS", def.ExcludedAppIDs),
+	}
+	if err := filter.Validate(); err != nil {
+		log.Fatalf("Invalid DEALS_MIN_STEAM_RATING: %v", err)
+	}
+	return filter
+}
+
+// tracesEndpoint returns the OTLP/HTTP traces URL from the standard OpenTelemetry
+// variables, or "" if tracing is off
+func tracesEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// getEnv returns the value of key or fallback when unset
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt parses key as an integer, exiting on malformed values
+func getEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return n
+}
+
+// getEnvDuration parses key as a time.Duration (e.g. "720h"), exiting on malformed values
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return d
+}
+
+// getEnvInterval parses key like getEnvDuration and also exits on values that
+// aren't positive, which a ticker can't run on
+func getEnvInterval(key string, fallback time.Duration) time.Duration {
+	d := getEnvDuration(key, fallback)
+	if d <= 0 {
+		log.Fatalf("Invalid %s: %s is not a positive duration", key, d)
+	}
+	return d
+}
+
+// getEnvFloat parses key as a float, exiting on malformed values
+func getEnvFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return f
+}
+
+// getEnvBool parses key as a boolean, exiting on malformed values
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return b
+}
+
+// getEnvList splits a comma-separated key into trimmed, non-empty items
+func getEnvList(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvIDs parses key as a comma-separated list of Telegram user IDs, exiting on malformed values
+func getEnvIDs(key string) []int64 {
+	var ids []int64
+	for _, item := range getEnvList(key, nil) {
+		id, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", key, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// getEnvMap parses a comma-separated list of name=value pairs with lowercased values,
+// exiting on malformed items
+func getEnvMap(key string) map[string]string {
+	items := getEnvPairs(key)
+	for name, value := range items {
+		items[name] = strings.ToLower(value)
+	}
+	return items
+}
+
+// getEnvPairs parses a comma-separated list of name=value pairs, exiting on malformed items
+func getEnvPairs(key string) map[string]string {
+	items := make(map[string]string)
+	for _, item := range getEnvList(key, nil) {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			log.Fatalf("Invalid %s: %q is not name=value", key, item)
+		}
+		items[strings.TrimSpace(name)] = strings.TrimSpace(value)
 	}
+	return items
 }
@@ -0,0 +1,324 @@
+// Package fakeredis is an in-memory stand-in for a Redis server, speaking enough
+// RESP for utils.RedisClient. It is meant for tests.
+package fakeredis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a single-database Redis stand-in listening on a loopback port
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu    sync.Mutex
+	data  map[string]item
+	conns map[net.Conn]struct{}
+	now   func() time.Time
+}
+
+type item struct {
+	value     string
+	expiresAt time.Time // zero if the key never expires
+}
+
+// Start starts a server on a free loopback port
+func Start() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listening: %w", err)
+	}
+
+	s := &Server{
+		ln:    ln,
+		data:  make(map[string]item),
+		conns: make(map[net.Conn]struct{}),
+		now:   time.Now,
+	}
+	s.wg.Go(s.serve)
+	return s, nil
+}
+
+// URL returns a redis:// URL for the server
+func (s *Server) URL() string {
+	return "redis://" + s.ln.Addr().String()
+}
+
+// Close stops the server and drops every connection
+func (s *Server) Close() {
+	s.ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Keys returns the live keys, sorted
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if s.liveLocked(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TTL returns how long key has left to live, or 0 if it is missing or never expires
+func (s *Server) TTL(key string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.liveLocked(key) || s.data[key].expiresAt.IsZero() {
+		return 0
+	}
+	return s.data[key].expiresAt.Sub(s.now())
+}
+
+// FastForward moves the server's clock forward, expiring keys as Redis would
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.now = func() time.Time { return now.Add(d) }
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Go(func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		})
+	}
+}
+
+// handle answers commands on conn until it is closed
+func (s *Server) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				writeError(w, "ERR "+err.Error())
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		s.exec(w, strings.ToUpper(args[0]), args[1:])
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exec runs one command and writes its reply
+func (s *Server) exec(w *bufio.Writer, cmd string, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch cmd {
+	case "PING":
+		w.WriteString("+PONG\r\n")
+	case "AUTH", "SELECT":
+		w.WriteString("+OK\r\n")
+	case "GET":
+		if len(args) != 1 {
+			writeError(w, "ERR wrong number of arguments for 'get' command")
+			return
+		}
+		if !s.liveLocked(args[0]) {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		writeBulk(w, s.data[args[0]].value)
+	case "SET":
+		s.set(w, args)
+	case "DEL":
+		n := 0
+		for _, key := range args {
+			if s.liveLocked(key) {
+				n++
+			}
+			delete(s.data, key)
+		}
+		fmt.Fprintf(w, ":%d\r\n", n)
+	case "SCAN":
+		s.scan(w, args)
+	case "DBSIZE":
+		n := 0
+		for key := range s.data {
+			if s.liveLocked(key) {
+				n++
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", n)
+	case "FLUSHDB", "FLUSHALL":
+		s.data = make(map[string]item)
+		w.WriteString("+OK\r\n")
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", cmd))
+	}
+}
+
+// set handles SET key value [EX seconds | PX milliseconds]
+func (s *Server) set(w *bufio.Writer, args []string) {
+	if len(args) < 2 {
+		writeError(w, "ERR wrong number of arguments for 'set' command")
+		return
+	}
+
+	it := item{value: args[1]}
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			writeError(w, "ERR syntax error")
+			return
+		}
+		n, err := strconv.ParseInt(args[i+1], 10, 64)
+		if err != nil || n <= 0 {
+			writeError(w, "ERR invalid expire time in 'set' command")
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "EX":
+			it.expiresAt = s.now().Add(time.Duration(n) * time.Second)
+		case "PX":
+			it.expiresAt = s.now().Add(time.Duration(n) * time.Millisecond)
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+
+	s.data[args[0]] = it
+	w.WriteString("+OK\r\n")
+}
+
+// scan handles SCAN cursor [MATCH pattern] [COUNT n], returning every match at once
+func (s *Server) scan(w *bufio.Writer, args []string) {
+	pattern := "*"
+	for i := 1; i+1 < len(args); i += 2 {
+		if strings.EqualFold(args[i], "MATCH") {
+			pattern = args[i+1]
+		}
+	}
+
+	var keys []string
+	for key := range s.data {
+		if ok, _ := path.Match(pattern, key); ok && s.liveLocked(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	w.WriteString("*2\r\n")
+	writeBulk(w, "0")
+	fmt.Fprintf(w, "*%d\r\n", len(keys))
+	for _, key := range keys {
+		writeBulk(w, key)
+	}
+}
+
+// liveLocked reports whether key exists, dropping it if it has expired (must be called with lock held)
+func (s *Server) liveLocked(key string) bool {
+	it, ok := s.data[key]
+	if !ok {
+		return false
+	}
+	if !it.expiresAt.IsZero() && !s.now().Before(it.expiresAt) {
+		delete(s.data, key)
+		return false
+	}
+	return true
+}
+
+// readCommand reads a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		// Inline command, as sent by redis-cli or telnet
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid multibulk length")
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		header, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(header, "$") {
+			return nil, fmt.Errorf("expected '$', got '%s'", header)
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid bulk length")
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func writeError(w *bufio.Writer, msg string) {
+	w.WriteString("-" + msg + "\r\n")
+}
@@ -0,0 +1,231 @@
+// Package faketelegram is an offline stand-in for the Telegram Bot API. It records
+// every method called and answers the way Telegram does when the call succeeds. It
+// is meant for tests.
+package faketelegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// Token is the only bot token the server accepts
+const Token = "123456789:fake-telegram-bot-token"
+
+// BotUser is the bot getMe returns
+var BotUser = gotgbot.User{
+	Id:        123456789,
+	IsBot:     true,
+	FirstName: "Steam Bot",
+	Username:  "steam_test_bot",
+}
+
+// Call is one Bot API method call, with its parameters as gotgbot sent them
+type Call struct {
+	Method string
+	Params map[string]string
+}
+
+// Decode unmarshals the JSON-encoded parameter name, such as reply_markup or
+// results, into v
+func (c Call) Decode(name string, v any) error {
+	raw, ok := c.Params[name]
+	if !ok {
+		return fmt.Errorf("%s was called without %s", c.Method, name)
+	}
+	if err := json.Unmarshal([]byte(raw), v); err != nil {
+		return fmt.Errorf("decoding %s of %s: %w", name, c.Method, err)
+	}
+	return nil
+}
+
+// Server serves the Bot API from a loopback address, so a bot's API URL can point
+// at URL()
+type Server struct {
+	srv    *httptest.Server
+	closed chan struct{} // ends pending long polls
+
+	mu            sync.Mutex
+	calls         []Call
+	lastMessageID int64
+}
+
+// Start starts a server on a free loopback port
+func Start() *Server {
+	s := &Server{closed: make(chan struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{auth}/{method}", s.method)
+
+	s.srv = httptest.NewServer(mux)
+	return s
+}
+
+// URL returns the server's base URL, without a trailing slash
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	close(s.closed)
+	s.srv.Close()
+}
+
+// NewBot returns a bot that talks to the server
+func (s *Server) NewBot() (*gotgbot.Bot, error) {
+	return gotgbot.NewBot(Token, &gotgbot.BotOpts{
+		BotClient: &gotgbot.BaseBotClient{
+			Client:             http.Client{},
+			DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: s.URL()},
+		},
+	})
+}
+
+// Calls returns the calls of method in the order they arrived, or every call if
+// method is empty
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var calls []Call
+	for _, call := range s.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets every recorded call
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+// ----- Bot API -----
+
+// response is the envelope every Bot API method answers with
+type response struct {
+	Ok          bool   `json:"ok"`
+	Result      any    `json:"result,omitempty"`
+	ErrorCode   int    `json:"error_code,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+func (s *Server) method(w http.ResponseWriter, r *http.Request) {
+	if r.PathValue("auth") != "bot"+Token {
+		writeResponse(w, http.StatusUnauthorized, response{ErrorCode: http.StatusUnauthorized, Description: "Unauthorized"})
+		return
+	}
+
+	params, err := readParams(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, response{ErrorCode: http.StatusBadRequest, Description: "Bad Request: " + err.Error()})
+		return
+	}
+
+	method := r.PathValue("method")
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: method, Params: params})
+	s.mu.Unlock()
+
+	// No updates are ever pending, so long polls wait out their timeout
+	if method == "getUpdates" {
+		timeout, _ := strconv.Atoi(params["timeout"])
+		select {
+		case <-time.After(time.Duration(timeout) * time.Second):
+		case <-r.Context().Done():
+		case <-s.closed:
+		}
+	}
+
+	writeResponse(w, http.StatusOK, response{Ok: true, Result: s.result(method, params)})
+}
+
+// result is what a successful call of method returns
+func (s *Server) result(method string, params map[string]string) any {
+	switch method {
+	case "getMe":
+		return BotUser
+	case "getUpdates":
+		return []gotgbot.Update{}
+	case "sendMessage":
+		return s.message(params)
+	case "editMessageText", "editMessageReplyMarkup":
+		// Edits of inline messages only report success
+		if params["inline_message_id"] != "" {
+			return true
+		}
+		return s.message(params)
+	default:
+		return true
+	}
+}
+
+// message is the message a send or edit produces
+func (s *Server) message(params map[string]string) gotgbot.Message {
+	chatID, _ := strconv.ParseInt(params["chat_id"], 10, 64)
+	chatType := "private"
+	if chatID < 0 {
+		chatType = "supergroup"
+	}
+
+	messageID, _ := strconv.ParseInt(params["message_id"], 10, 64)
+	if messageID == 0 {
+		s.mu.Lock()
+		s.lastMessageID++
+		messageID = s.lastMessageID
+		s.mu.Unlock()
+	}
+
+	return gotgbot.Message{
+		MessageId: messageID,
+		Date:      time.Now().Unix(),
+		Chat:      gotgbot.Chat{Id: chatID, Type: chatType},
+		From:      &BotUser,
+		Text:      params["text"],
+	}
+}
+
+// ----- Helpers -----
+
+// readParams decodes a JSON or multipart request body into the string parameters
+// gotgbot sends
+func readParams(r *http.Request) (map[string]string, error) {
+	params := make(map[string]string)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			return nil, err
+		}
+		for name, values := range r.MultipartForm.Value {
+			params[name] = values[0]
+		}
+		return params, nil
+	}
+
+	if r.ContentLength == 0 {
+		return params, nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,334 @@
+// Package fakeupstream is an offline stand-in for the Steam storefront, the Steam
+// Web API, CheapShark, the exchange rate API and How Long To Beat, answering from
+// JSON responses recorded from the real services. It is meant for tests.
+package fakeupstream
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rshero/hltb"
+)
+
+// APIKey is the only Steam Web API key the server accepts
+const APIKey = "fake-steam-api-key"
+
+//go:embed fixtures
+var fixtures embed.FS
+
+// Server serves every upstream from one loopback address, so each client base URL
+// can point at URL()
+type Server struct {
+	srv *httptest.Server
+
+	mu       sync.Mutex
+	requests map[string]int           // by path
+	failures map[string]int           // status to answer with, by path
+	holds    map[string]chan struct{} // closed to release held requests, by path
+}
+
+// Start starts a server on a free loopback port
+func Start() *Server {
+	s := &Server{
+		requests: make(map[string]int),
+		failures: make(map[string]int),
+		holds:    make(map[string]chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+
+	// Steam storefront
+	mux.HandleFunc("GET /api/appdetails", s.appDetails)
+	mux.HandleFunc("GET /appreviews/{appid}", s.appReviews)
+	mux.HandleFunc("GET /api/storesearch/", s.storeSearch)
+
+	// Steam Web API
+	mux.HandleFunc("GET /ISteamUser/ResolveVanityURL/v0001/", s.withAPIKey(s.resolveVanityURL))
+	mux.HandleFunc("GET /ISteamUser/GetPlayerSummaries/v0002/", s.withAPIKey(s.playerSummaries))
+	mux.HandleFunc("GET /IPlayerService/GetSteamLevel/v1/", s.withAPIKey(s.steamLevel))
+	mux.HandleFunc("GET /IPlayerService/GetOwnedGames/v1/", s.withAPIKey(s.ownedGames))
+
+	// CheapShark
+	mux.HandleFunc("GET /api/1.0/deals", s.deals)
+	mux.HandleFunc("GET /api/1.0/stores", s.stores)
+	mux.HandleFunc("GET /api/1.0/games", s.games)
+
+	// Exchange rates
+	mux.HandleFunc("GET /v6/latest/{base}", s.exchangeRates)
+
+	s.srv = httptest.NewServer(s.track(mux))
+	return s
+}
+
+// URL returns the server's base URL, without a trailing slash
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Requests returns how many requests path has received
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Fail makes path answer with the given status until it is called again with 0
+func (s *Server) Fail(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status == 0 {
+		delete(s.failures, path)
+		return
+	}
+	s.failures[path] = status
+}
+
+// Hold makes requests to path wait until release is called or the client gives up
+func (s *Server) Hold(path string) (release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	held := make(chan struct{})
+	s.holds[path] = held
+	return sync.OnceFunc(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.holds[path] == held {
+			delete(s.holds, path)
+		}
+		close(held)
+	})
+}
+
+// track counts requests and answers the ones Fail and Hold apply to
+func (s *Server) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		status := s.failures[r.URL.Path]
+		held := s.holds[r.URL.Path]
+		s.mu.Unlock()
+
+		if held != nil {
+			select {
+			case <-held:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ----- Steam Storefront -----
+
+// appDetails merges the recorded responses of every requested app. Apps without a
+// fixture fail as unknown apps do.
+func (s *Server) appDetails(w http.ResponseWriter, r *http.Request) {
+	priceOnly := r.URL.Query().Get("filters") == "price_overview"
+
+	response := make(map[string]any)
+	for appID := range strings.SplitSeq(r.URL.Query().Get("appids"), ",") {
+		var recorded map[string]struct {
+			Success bool                       `json:"success"`
+			Data    map[string]json.RawMessage `json:"data"`
+		}
+		if !readFixture("store/appdetails/"+appID+".json", &recorded) || !recorded[appID].Success {
+			response[appID] = map[string]bool{"success": false}
+			continue
+		}
+
+		entry := recorded[appID]
+		if !priceOnly {
+			response[appID] = entry
+			continue
+		}
+
+		// Free apps have no price, for which Steam sends an empty array instead of an object
+		var data any = []any{}
+		if price, ok := entry.Data["price_overview"]; ok {
+			data = map[string]json.RawMessage{"price_overview": price}
+		}
+		response[appID] = map[string]any{"success": true, "data": data}
+	}
+
+	writeJSON(w, response)
+}
+
+func (s *Server) appReviews(w http.ResponseWriter, r *http.Request) {
+	serveFixture(w, "store/appreviews/"+r.PathValue("appid")+".json", `{"success":2}`)
+}
+
+// storeSearch answers from the fixture recorded for the search term
+func (s *Server) storeSearch(w http.ResponseWriter, r *http.Request) {
+	term := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("term")))
+	serveFixture(w, "store/storesearch/"+url.QueryEscape(term)+".json", `{"total":0,"items":[]}`)
+}
+
+// ----- Steam Web API -----
+
+// withAPIKey rejects requests without APIKey the way Steam does
+func (s *Server) withAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != APIKey {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("<html><head><title>Forbidden</title></head><body><h1>Forbidden</h1>Access is denied. Retrying will not help. Please verify your <pre>key=</pre> parameter.</body></html>"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) resolveVanityURL(w http.ResponseWriter, r *http.Request) {
+	vanity := strings.ToLower(r.URL.Query().Get("vanityurl"))
+	serveFixture(w, "webapi/resolvevanityurl/"+url.QueryEscape(vanity)+".json", `{"response":{"success":42,"message":"No match"}}`)
+}
+
+func (s *Server) playerSummaries(w http.ResponseWriter, r *http.Request) {
+	serveFixture(w, "webapi/playersummaries/"+url.QueryEscape(r.URL.Query().Get("steamids"))+".json", `{"response":{"players":[]}}`)
+}
+
+func (s *Server) steamLevel(w http.ResponseWriter, r *http.Request) {
+	serveFixture(w, "webapi/steamlevel/"+url.QueryEscape(r.URL.Query().Get("steamid"))+".json", `{"response":{}}`)
+}
+
+func (s *Server) ownedGames(w http.ResponseWriter, r *http.Request) {
+	serveFixture(w, "webapi/ownedgames/"+url.QueryEscape(r.URL.Query().Get("steamid"))+".json", `{"response":{}}`)
+}
+
+// ----- CheapShark -----
+
+// cheapSharkPageSize is the number of deals CheapShark returns without a pageSize
+const cheapSharkPageSize = 60
+
+// deals applies the query parameters DealFilter.Query sends to the recorded deals
+func (s *Server) deals(w http.ResponseWriter, r *http.Request) {
+	var recorded []map[string]any
+	if !readFixture("cheapshark/deals.json", &recorded) {
+		http.Error(w, "missing deals fixture", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	var stores []string
+	if q.Has("storeID") {
+		stores = strings.Split(q.Get("storeID"), ",")
+	}
+	pageSize := cheapSharkPageSize
+	if n, err := strconv.Atoi(q.Get("pageSize")); err == nil && n > 0 {
+		pageSize = n
+	}
+
+	skip := 0
+	if n, err := strconv.Atoi(q.Get("pageNumber")); err == nil && n > 0 {
+		skip = n * pageSize
+	}
+
+	deals := make([]map[string]any, 0, len(recorded))
+	for _, deal := range recorded {
+		if len(deals) == pageSize {
+			break
+		}
+
+		switch {
+		case stores != nil && !slices.Contains(stores, fmt.Sprint(deal["storeID"])):
+		case q.Has("lowerPrice") && number(deal["salePrice"]) < number(q.Get("lowerPrice")):
+		case q.Has("upperPrice") && number(deal["salePrice"]) > number(q.Get("upperPrice")):
+		case q.Has("metacritic") && number(deal["metacriticScore"]) < number(q.Get("metacritic")):
+		case q.Get("AAA") == "1" && number(deal["normalPrice"]) <= 29:
+		case skip > 0:
+			skip--
+		default:
+			deals = append(deals, deal)
+		}
+	}
+
+	writeJSON(w, deals)
+}
+
+func (s *Server) stores(w http.ResponseWriter, r *http.Request) {
+	serveFixture(w, "cheapshark/stores.json", `[]`)
+}
+
+// games looks a game up by Steam app ID, or fetches it by CheapShark game ID
+func (s *Server) games(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Has("id") {
+		serveFixture(w, "cheapshark/games/id/"+url.QueryEscape(q.Get("id"))+".json", `[]`)
+		return
+	}
+	serveFixture(w, "cheapshark/games/steamappid/"+url.QueryEscape(q.Get("steamAppID"))+".json", `[]`)
+}
+
+// ----- Exchange Rates -----
+
+func (s *Server) exchangeRates(w http.ResponseWriter, r *http.Request) {
+	base := strings.ToUpper(r.PathValue("base"))
+	serveFixture(w, "exchangerates/"+url.QueryEscape(base)+".json", `{"result":"error","error-type":"unsupported-code"}`)
+}
+
+// ----- How Long To Beat -----
+
+// HLTB answers HLTB searches from recorded results. The HLTB client talks to a
+// fixed host, so a client is given HLTB directly instead of the server's URL.
+type HLTB struct{}
+
+// SearchFirstWithDetails returns the game recorded for name, or hltb.ErrNoResults
+func (HLTB) SearchFirstWithDetails(name string) (*hltb.Game, error) {
+	var game hltb.Game
+	if !readFixture("hltb/"+url.QueryEscape(strings.ToLower(strings.TrimSpace(name)))+".json", &game) {
+		return nil, hltb.ErrNoResults
+	}
+	return &game, nil
+}
+
+// ----- Helpers -----
+
+// serveFixture writes the named fixture, or fallback if there is none
+func serveFixture(w http.ResponseWriter, name, fallback string) {
+	body, err := fs.ReadFile(fixtures, "fixtures/"+name)
+	if err != nil {
+		body = []byte(fallback)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// readFixture decodes the named fixture into v, reporting whether it exists
+func readFixture(name string, v any) bool {
+	body, err := fs.ReadFile(fixtures, "fixtures/"+name)
+	return err == nil && json.Unmarshal(body, v) == nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// number parses CheapShark's numeric strings, treating anything else as zero
+func number(v any) float64 {
+	s, _ := v.(string)
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
@@ -0,0 +1,13 @@
+// Package logattr holds log attributes needed by packages that utils itself imports,
+// such as tracing, so that every package can log them the same way
+package logattr
+
+import "log/slog"
+
+// KeyError is the attribute key for errors in every package's log lines
+const KeyError = "error"
+
+// Error is the attribute for an error, so every package logs errors under the same key
+func Error(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
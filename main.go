@@ -1,51 +1,155 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"steam_bot/bot"
 	"steam_bot/config"
-	"steam_bot/templates"
-
-	"github.com/PaulSonOfLars/gotgbot/v2"
-	"github.com/PaulSonOfLars/gotgbot/v2/ext"
-	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
-	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+	"steam_bot/logattr"
+	"steam_bot/metrics"
+	"steam_bot/steam"
+	"steam_bot/store"
+	"steam_bot/tracing"
+	"steam_bot/utils"
 )
 
 func main() {
 	cfg := config.LoadConfig()
 
-	b, updater, dispatcher, err := bot.StartBot(cfg)
+	logger, err := utils.NewLogger(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		log.Fatal("Failed to set up logging:", err)
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Updates are handled with contexts derived from requestCtx, so their upstream
+	// API calls are only aborted if shutdown runs out of time
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	priceHistory, err := store.NewPriceHistory(cfg.PriceHistoryPath, store.HistoryPolicy{
+		FlushInterval: cfg.PriceHistoryFlushInterval,
+		MaxAge:        cfg.PriceHistoryMaxAge,
+		MaxApps:       cfg.PriceHistoryMaxApps,
+	})
+	if err != nil {
+		fatal("Failed to open price history", err)
+	}
+	defer priceHistory.Close()
+
+	caches, err := steam.NewCacheSet(steam.CacheConfig{
+		Backend:              cfg.CacheBackend,
+		Backends:             cfg.CacheBackends,
+		RedisURL:             cfg.RedisURL,
+		RedisKeyPrefix:       cfg.RedisKeyPrefix,
+		StaleWhileRevalidate: cfg.CacheStaleWhileRevalidate,
+		StaleOnError:         cfg.CacheStaleOnError,
+	})
 	if err != nil {
-		log.Fatal("Failed to start bot:", err)
+		fatal("Failed to set up caches", err)
 	}
 
-	dispatcher.AddHandler(handlers.NewInlineQuery(nil, bot.HandleInlineQuery))
-	dispatcher.AddHandler(handlers.NewCallback(nil, bot.NewCallbackQueryHandler(cfg)))
+	client := steam.NewClient(
+		steam.WithAPIKey(cfg.SteamAPIKey),
+		steam.WithDefaultCountry(cfg.DefaultCountry),
+		steam.WithCaches(caches),
+		steam.WithPriceHistory(priceHistory),
+	)
+	caches.RegisterMetrics(metrics.Default)
 
-	cmdFilter, err := message.Regex(`^/(` + templates.CommandKeys() + `)(@` + b.User.Username + `)?(\s|$)`)
+	health := bot.NewHealth(client)
+	b, updater, dispatcher, err := bot.StartBot(requestCtx, cfg, health)
 	if err != nil {
-		log.Fatal("Failed to compile command regex:", err)
+		fatal("Failed to start bot", err)
 	}
-	dispatcher.AddHandler(handlers.NewMessage(cmdFilter, bot.DynamicCmdHandler))
 
-	err = updater.StartPolling(b, &ext.PollingOpts{
-		DropPendingUpdates: true,
-		GetUpdatesOpts: &gotgbot.GetUpdatesOpts{
-			Timeout: 9,
-			RequestOpts: &gotgbot.RequestOpts{
-				Timeout: time.Second * 10,
-			},
-		},
+	traceExporter, err := tracing.Setup(tracing.Config{
+		Endpoint:    cfg.TracingEndpoint,
+		Headers:     cfg.TracingHeaders,
+		ServiceName: cfg.TracingServiceName,
+		SampleRatio: cfg.TracingSampleRatio,
 	})
 	if err != nil {
-		log.Fatal("Failed to start polling:", err)
+		fatal("Failed to set up tracing", err)
+	}
+
+	// Metrics share the health server when both use the same address
+	healthServer, err := bot.StartHealthServer(cfg.HealthAddr, health, cfg.MetricsAddr == cfg.HealthAddr)
+	if err != nil {
+		fatal("Failed to start health server", err)
+	}
+	defer healthServer.Close()
+
+	if cfg.MetricsAddr != "" && cfg.MetricsAddr != cfg.HealthAddr {
+		metricsServer, err := bot.StartMetricsServer(cfg.MetricsAddr)
+		if err != nil {
+			fatal("Failed to start metrics server", err)
+		}
+		defer metricsServer.Close()
+	}
+
+	prefs, err := store.NewPreferences(cfg.PreferencesPath)
+	if err != nil {
+		fatal("Failed to open preferences", err)
+	}
+	defer prefs.Close()
+
+	watchlist, err := store.NewWatchlist(cfg.WatchlistPath)
+	if err != nil {
+		fatal("Failed to open watchlist", err)
+	}
+	defer watchlist.Close()
+	watcher := bot.NewWatcher(watchlist, client, prefs)
+
+	if err := bot.AddHandlers(requestCtx, dispatcher, b, cfg, client, watcher, prefs); err != nil {
+		fatal("Failed to add handlers", err)
+	}
+
+	mode, err := bot.StartReceivingUpdates(b, updater, cfg, health)
+	if err != nil {
+		fatal("Failed to start receiving updates", err)
 	}
-	log.Printf("%s has been started...\n", b.User.Username)
+	slog.Info("Bot has been started", "username", b.User.Username, "mode", mode)
 
-	go bot.SendDealsRoutine(b, cfg.ChannelID)
+	channels, err := bot.OpenDealChannels(cfg)
+	if err != nil {
+		fatal("Failed to open deal channels", err)
+	}
+	defer bot.CloseDealChannels(channels)
+
+	var routines sync.WaitGroup
+	routines.Go(func() { bot.SendDealsRoutine(ctx, b, client, channels, health) })
+	routines.Go(func() { watcher.WatchlistRoutine(ctx, b, cfg.WatchlistInterval) })
+
+	<-ctx.Done()
+	stop() // a second signal kills the process immediately
+	slog.Info("Shutting down")
+
+	if err := bot.Shutdown(updater, &routines, cancelRequests, cfg.ShutdownTimeout, health); err != nil {
+		slog.Error("Error during shutdown", logattr.Error(err))
+	}
+
+	// Spans are flushed before the deferred closes flush the deal ledgers, watchlist,
+	// preferences and price history
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := traceExporter.Shutdown(flushCtx); err != nil {
+		slog.Error("Error flushing traces", logattr.Error(err))
+	}
+}
 
-	updater.Idle()
+// fatal logs msg with err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, logattr.Error(err))
+	os.Exit(1)
 }
@@ -1,33 +1,61 @@
 package steam
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
-	"steam_bot/utils"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"steam_bot/logattr"
+	"steam_bot/tracing"
+	"steam_bot/utils"
 
 	"github.com/rshero/hltb"
 )
 
-// ----- HLTB Client Singleton -----
+// ----- HLTB Client -----
 
-var (
-	hltbClient     *hltb.Client
-	hltbClientOnce sync.Once
-	hltbClientErr  error
-)
+// hltbHost labels HLTB requests in metrics; the client makes its own HTTP calls
+const hltbHost = "howlongtobeat.com"
+
+// lazyHltb creates the real HLTB client on first use, since creating it fetches a
+// search token from the site. Copies of a Client share it.
+type lazyHltb struct {
+	once   sync.Once
+	client *hltb.Client
+	err    error
+	done   atomic.Bool // set once client and err are assigned
+}
 
-func getHltbClient() (*hltb.Client, error) {
-	hltbClientOnce.Do(func() {
-		hltbClient, hltbClientErr = hltb.NewClientWithInit()
-		if hltbClientErr != nil {
-			log.Println("Error initializing HLTB client:", hltbClientErr)
+func (l *lazyHltb) get() (*hltb.Client, error) {
+	l.once.Do(func() {
+		l.client, l.err = hltb.NewClientWithInit()
+		if l.err != nil {
+			slog.Error("Error initializing HLTB client", logattr.Error(l.err))
 		}
+		l.done.Store(true)
 	})
-	return hltbClient, hltbClientErr
+	return l.client, l.err
+}
+
+// HltbClientStatus reports whether the client's HLTB client has been initialized,
+// which happens on its first HLTB lookup, and the error if initializing it failed.
+// A searcher set with WithHltbSearcher counts as initialized.
+func (c *Client) HltbClientStatus() (initialized bool, err error) {
+	if c.hltb != nil {
+		return true, nil
+	}
+	if !c.hltbDefault.done.Load() {
+		return false, nil
+	}
+	return c.hltbDefault.err == nil, c.hltbDefault.err
 }
 
 // ----- API Response Types -----
@@ -76,7 +104,11 @@ type ReleaseDate struct {
 }
 
 type PriceOverview struct {
-	FinalFormatted string `json:"final_formatted"`
+	Currency        string `json:"currency"`
+	Initial         int    `json:"initial"` // in cents
+	Final           int    `json:"final"`   // in cents
+	DiscountPercent int    `json:"discount_percent"`
+	FinalFormatted  string `json:"final_formatted"`
 }
 
 type PcRequirements struct {
@@ -193,7 +225,8 @@ type SteamSearchItem struct {
 	Name      string `json:"name"`
 	TinyImage string `json:"tiny_image"`
 	Price     struct {
-		Final int `json:"final"`
+		Currency string `json:"currency"`
+		Final    int    `json:"final"`
 	} `json:"price"`
 }
 
@@ -242,46 +275,140 @@ type SteamUserInfo struct {
 
 // ----- API Functions -----
 
-// GetCheapSharkDeals fetches current deals from CheapShark API
-func GetCheapSharkDeals() ([]CheapSharkDeal, error) {
-	apiURL := "https://www.cheapshark.com/api/1.0/deals?storeID=1&upperPrice=30&pageSize=10"
+// GetCheapSharkDeals fetches current deals matching the filter's query parameters from CheapShark API
+func (c *Client) GetCheapSharkDeals(ctx context.Context, filter DealFilter) (_ []CheapSharkDeal, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetCheapSharkDeals")
+	defer func() { span.Finish(err) }()
+
+	return c.fetchDealsPage(ctx, filter, 0)
+}
+
+// maxDealPages bounds how many pages GetCheapSharkDealsFor fetches in one call
+const maxDealPages = 5
+
+// GetCheapSharkDealsFor fetches the deals for several filters with their merged query.
+// The filters share its pages, so a broad filter can fill a page before a narrow one
+// gets the deals its own query would return. Further pages are fetched until every
+// filter has them, CheapShark runs out of deals, or maxDealPages pages were fetched.
+// Callers apply each filter's Match on the result.
+func (c *Client) GetCheapSharkDealsFor(ctx context.Context, filters ...DealFilter) (_ []CheapSharkDeal, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetCheapSharkDealsFor", tracing.Int("filters", int64(len(filters))))
+	defer func() { span.Finish(err) }()
+
+	merged := MergeDealFilters(filters...)
+	pageSize := merged.PageSize
+	if pageSize == 0 {
+		pageSize = maxDealsPageSize
+	}
 
 	var deals []CheapSharkDeal
-	if err := utils.HttpGetJSON(apiURL, &deals); err != nil {
-		return nil, fmt.Errorf("fetching deals: %w", err)
+	for page := 0; page < maxDealPages; page++ {
+		batch, err := c.fetchDealsPage(ctx, merged, page)
+		if err != nil {
+			if page > 0 {
+				// The earlier pages still serve most filters
+				slog.WarnContext(ctx, "Error fetching further deal pages", "page", page, logattr.Error(err))
+				break
+			}
+			return nil, err
+		}
+		deals = append(deals, batch...)
+
+		if len(batch) < pageSize || servesEveryFilter(filters, deals) {
+			break
+		}
 	}
 
+	span.SetAttributes(tracing.Int("deals", int64(len(deals))))
+	return deals, nil
+}
+
+// servesEveryFilter reports whether deals holds a full page of every filter's own query
+func servesEveryFilter(filters []DealFilter, deals []CheapSharkDeal) bool {
+	for _, f := range filters {
+		want := f.PageSize
+		if want == 0 {
+			want = maxDealsPageSize
+		}
+
+		got := 0
+		for _, deal := range deals {
+			if f.queryAccepts(deal) {
+				got++
+			}
+		}
+		if got < want {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchDealsPage fetches one page of the filter's query (internal, uncached)
+func (c *Client) fetchDealsPage(ctx context.Context, filter DealFilter, page int) ([]CheapSharkDeal, error) {
+	query := filter.Query()
+	if page > 0 {
+		query.Set("pageNumber", strconv.Itoa(page))
+	}
+	apiURL := c.cheapSharkURL + "/api/1.0/deals?" + query.Encode()
+
+	var deals []CheapSharkDeal
+	if err := c.http.GetJSON(ctx, apiURL, &deals); err != nil {
+		return nil, fmt.Errorf("fetching deals page %d: %w", page, err)
+	}
+
+	c.recordDealPrices(deals)
 	return deals, nil
 }
 
 // GetFullSteamAppDetails fetches complete app details from Steam API with caching
-func GetFullSteamAppDetails(appID string) (*SteamAppDetails, error) {
-	return appDetailsCache.GetOrFetch(appID, func() (*SteamAppDetails, error) {
-		return fetchSteamAppDetails(appID)
+func (c *Client) GetFullSteamAppDetails(ctx context.Context, appID string) (*SteamAppDetails, error) {
+	return c.GetFullSteamAppDetailsInRegion(ctx, appID, c.defaultCountry)
+}
+
+// GetFullSteamAppDetailsInRegion fetches complete app details priced for the given store country, with caching
+func (c *Client) GetFullSteamAppDetailsInRegion(ctx context.Context, appID, cc string) (_ *SteamAppDetails, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetFullSteamAppDetailsInRegion", tracing.String("app_id", appID), tracing.String("cc", cc))
+	defer func() { span.Finish(err) }()
+
+	key := regionKey(appID, cc)
+	return c.caches.appDetails.GetOrFetchContext(ctx, key, func(ctx context.Context) (*SteamAppDetails, error) {
+		return c.fetchSteamAppDetails(ctx, key.AppID, key.CC)
 	})
 }
 
 // fetchSteamAppDetails performs the actual API call (internal, uncached)
-func fetchSteamAppDetails(appID string) (*SteamAppDetails, error) {
-	apiURL := fmt.Sprintf("https://store.steampowered.com/api/appdetails?appids=%s&cc=in", appID)
+func (c *Client) fetchSteamAppDetails(ctx context.Context, appID, cc string) (*SteamAppDetails, error) {
+	apiURL := fmt.Sprintf("%s/api/appdetails?appids=%s&cc=%s", c.storeURL, url.QueryEscape(appID), url.QueryEscape(cc))
 
 	var response map[string]SteamAppDetailsResponse
-	if err := utils.HttpGetJSON(apiURL, &response); err != nil {
+	if err := c.http.GetJSON(ctx, apiURL, &response); err != nil {
 		return nil, fmt.Errorf("fetching app details: %w", err)
 	}
 
 	data, ok := response[appID]
 	if !ok || !data.Success {
-		return nil, fmt.Errorf("no details found for appID %s", appID)
+		return nil, fmt.Errorf("no details found for appID %s: %w", appID, ErrNotFound)
 	}
 
+	if !data.Data.IsFree {
+		c.recordSteamPrice(appID, cc, data.Data.PriceOverview)
+	}
 	return &data.Data, nil
 }
 
 // GetSteamAppInfo fetches app details and returns simplified AppInfo
 // This uses the cache internally via GetFullSteamAppDetails
-func GetSteamAppInfo(appID string) (AppInfo, error) {
-	details, err := GetFullSteamAppDetails(appID)
+func (c *Client) GetSteamAppInfo(ctx context.Context, appID string) (AppInfo, error) {
+	return c.GetSteamAppInfoInRegion(ctx, appID, c.defaultCountry)
+}
+
+// GetSteamAppInfoInRegion is GetSteamAppInfo with prices for the given store country
+func (c *Client) GetSteamAppInfoInRegion(ctx context.Context, appID, cc string) (_ AppInfo, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetSteamAppInfoInRegion", tracing.String("app_id", appID), tracing.String("cc", cc))
+	defer func() { span.Finish(err) }()
+
+	details, err := c.GetFullSteamAppDetailsInRegion(ctx, appID, cc)
 	if err != nil {
 		return AppInfo{Description: "No description available"}, err
 	}
@@ -289,29 +416,65 @@ func GetSteamAppInfo(appID string) (AppInfo, error) {
 	return details.ToAppInfo(), nil
 }
 
-// GetSteamAppReviews fetches review summary for an app
-func GetSteamAppReviews(appID string) (*SteamReviewSummary, error) {
-	apiURL := fmt.Sprintf("https://store.steampowered.com/appreviews/%s?json=1&num_per_page=0", appID)
+// GetSteamAppReviews fetches review summary for an app, with caching
+func (c *Client) GetSteamAppReviews(ctx context.Context, appID string) (_ *SteamReviewSummary, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetSteamAppReviews", tracing.String("app_id", appID))
+	defer func() { span.Finish(err) }()
+
+	return c.caches.reviews.GetOrFetchContext(ctx, appID, func(ctx context.Context) (*SteamReviewSummary, error) {
+		return c.fetchSteamAppReviews(ctx, appID)
+	})
+}
+
+// fetchSteamAppReviews performs the actual API call (internal, uncached)
+func (c *Client) fetchSteamAppReviews(ctx context.Context, appID string) (*SteamReviewSummary, error) {
+	apiURL := fmt.Sprintf("%s/appreviews/%s?json=1&num_per_page=0", c.storeURL, url.PathEscape(appID))
 
 	var response SteamReviewSummaryResponse
-	if err := utils.HttpGetJSON(apiURL, &response); err != nil {
+	if err := c.http.GetJSON(ctx, apiURL, &response); err != nil {
 		return nil, fmt.Errorf("fetching reviews: %w", err)
 	}
 
 	if response.Success != 1 {
-		return nil, fmt.Errorf("reviews unavailable for appID %s", appID)
+		return nil, fmt.Errorf("reviews unavailable for appID %s: %w", appID, ErrNotFound)
 	}
 
 	return &response.QuerySummary, nil
 }
 
-// SearchSteam searches the Steam store and returns up to 5 results
-func SearchSteam(query string) ([]SteamSearchItem, error) {
+// SearchKey identifies a cached store search
+type SearchKey struct {
+	Query string // normalized with normalizeQuery
+	CC    string
+}
+
+// String renders the key as "cc:query", e.g. for Redis keys
+func (k SearchKey) String() string {
+	return k.CC + ":" + k.Query
+}
+
+// SearchSteam searches the Steam store with prices for the given country and returns up to 5 results.
+// Results are cached briefly, so a query typed again (or by someone else) is answered at once.
+func (c *Client) SearchSteam(ctx context.Context, query, cc string) (_ []SteamSearchItem, err error) {
+	ctx, span := tracing.Start(ctx, "steam.SearchSteam", tracing.String("query", query), tracing.String("cc", cc))
+	defer func() { span.Finish(err) }()
+
+	if cc == "" {
+		cc = c.defaultCountry
+	}
+	key := SearchKey{Query: normalizeQuery(query), CC: strings.ToLower(cc)}
+	return c.caches.search.GetOrFetchContext(ctx, key, func(ctx context.Context) ([]SteamSearchItem, error) {
+		return c.searchSteam(ctx, key.Query, key.CC)
+	})
+}
+
+// searchSteam performs the actual API call (internal, uncached)
+func (c *Client) searchSteam(ctx context.Context, query, cc string) ([]SteamSearchItem, error) {
 	encodedQuery := url.QueryEscape(query)
-	apiURL := fmt.Sprintf("https://store.steampowered.com/api/storesearch/?term=%s&l=english&cc=US", encodedQuery)
+	apiURL := fmt.Sprintf("%s/api/storesearch/?term=%s&l=english&cc=%s", c.storeURL, encodedQuery, url.QueryEscape(cc))
 
 	var result SteamSearchResult
-	if err := utils.HttpGetJSON(apiURL, &result); err != nil {
+	if err := c.http.GetJSON(ctx, apiURL, &result); err != nil {
 		return nil, fmt.Errorf("searching steam: %w", err)
 	}
 
@@ -323,14 +486,54 @@ func SearchSteam(query string) ([]SteamSearchItem, error) {
 	return result.Items, nil
 }
 
-// GetHltbData fetches How Long To Beat data for a game
-func GetHltbData(searchTerm string) (*hltb.Game, error) {
-	client, err := getHltbClient()
+// GetHltbData fetches How Long To Beat data for a game, with caching by title
+func (c *Client) GetHltbData(ctx context.Context, searchTerm string) (_ *hltb.Game, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetHltbData", tracing.String("title", searchTerm))
+	defer func() { span.Finish(err) }()
+
+	game, err := c.caches.hltb.GetOrFetchContext(ctx, normalizeTitle(searchTerm), func(ctx context.Context) (*hltb.Game, error) {
+		return c.fetchHltbData(ctx, searchTerm)
+	})
+	if err != nil {
+		return &hltb.Game{}, err
+	}
+	return game, nil
+}
+
+// hltbSearcher returns the client's HLTB searcher, initializing the real client if none was set
+func (c *Client) hltbSearcher() (HltbSearcher, error) {
+	if c.hltb != nil {
+		return c.hltb, nil
+	}
+	client, err := c.hltbDefault.get()
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// fetchHltbData performs the actual HLTB search (internal, uncached)
+func (c *Client) fetchHltbData(ctx context.Context, searchTerm string) (*hltb.Game, error) {
+	searcher, err := c.hltbSearcher()
 	if err != nil {
 		return &hltb.Game{}, fmt.Errorf("hltb client error: %w", err)
 	}
 
-	game, err := client.SearchFirstWithDetails(searchTerm)
+	// The HLTB client can't be cancelled, so ctx only bounds the wait for a slot
+	if err := c.hltbLimiter.Wait(ctx, utils.PriorityFrom(ctx)); err != nil {
+		return &hltb.Game{}, fmt.Errorf("waiting for hltb: %w", err)
+	}
+
+	start := time.Now()
+	game, err := searcher.SearchFirstWithDetails(searchTerm)
+	if err == nil || errors.Is(err, hltb.ErrNoResults) {
+		utils.ObserveUpstream(hltbHost, "200", start)
+	} else {
+		utils.ObserveUpstream(hltbHost, "error", start)
+	}
+	if errors.Is(err, hltb.ErrNoResults) {
+		return &hltb.Game{}, fmt.Errorf("no hltb results for %q: %w", searchTerm, ErrNotFound)
+	}
 	if err != nil {
 		return &hltb.Game{}, fmt.Errorf("hltb search error: %w", err)
 	}
@@ -338,49 +541,71 @@ func GetHltbData(searchTerm string) (*hltb.Game, error) {
 	return game, nil
 }
 
+// normalizeQuery folds case and whitespace so equivalent searches share a cache entry
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// titleMarks are dropped from titles before HLTB lookups; store pages and HLTB disagree on them
+var titleMarks = strings.NewReplacer("™", "", "®", "", "©", "")
+
+// normalizeTitle maps the variants of a game title seen in Steam and CheapShark data to one cache key
+func normalizeTitle(title string) string {
+	return normalizeQuery(titleMarks.Replace(title))
+}
+
 // ----- Steam User API Functions -----
 
 // ResolveSteamVanityURL resolves a Steam vanity URL to a Steam ID
-func ResolveSteamVanityURL(apiKey, vanityURL string) (string, error) {
-	apiURL := fmt.Sprintf("https://api.steampowered.com/ISteamUser/ResolveVanityURL/v0001/?key=%s&vanityurl=%s",
-		apiKey, url.QueryEscape(vanityURL))
+func (c *Client) ResolveSteamVanityURL(ctx context.Context, vanityURL string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "steam.ResolveSteamVanityURL", tracing.String("vanity_url", vanityURL))
+	defer func() { span.Finish(err) }()
+
+	apiURL := fmt.Sprintf("%s/ISteamUser/ResolveVanityURL/v0001/?key=%s&vanityurl=%s",
+		c.webAPIURL, url.QueryEscape(c.apiKey), url.QueryEscape(vanityURL))
 
 	var response SteamVanityURLResponse
-	if err := utils.HttpGetJSON(apiURL, &response); err != nil {
+	if err := c.http.GetJSON(ctx, apiURL, &response); err != nil {
 		return "", fmt.Errorf("resolving vanity URL: %w", err)
 	}
 
 	if response.Response.Success != 1 {
-		return "", fmt.Errorf("user not found: %s", vanityURL)
+		return "", fmt.Errorf("user not found: %s: %w", vanityURL, ErrNotFound)
 	}
 
 	return response.Response.SteamID, nil
 }
 
 // GetSteamPlayerSummary fetches player summary for a Steam ID
-func GetSteamPlayerSummary(apiKey, steamID string) (*SteamPlayerSummary, error) {
-	apiURL := fmt.Sprintf("https://api.steampowered.com/ISteamUser/GetPlayerSummaries/v0002/?key=%s&steamids=%s",
-		apiKey, steamID)
+func (c *Client) GetSteamPlayerSummary(ctx context.Context, steamID string) (_ *SteamPlayerSummary, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetSteamPlayerSummary", tracing.String("steam_id", steamID))
+	defer func() { span.Finish(err) }()
+
+	apiURL := fmt.Sprintf("%s/ISteamUser/GetPlayerSummaries/v0002/?key=%s&steamids=%s",
+		c.webAPIURL, url.QueryEscape(c.apiKey), url.QueryEscape(steamID))
 
 	var response SteamPlayerSummariesResponse
-	if err := utils.HttpGetJSON(apiURL, &response); err != nil {
+	if err := c.http.GetJSON(ctx, apiURL, &response); err != nil {
 		return nil, fmt.Errorf("fetching player summary: %w", err)
 	}
 
 	if len(response.Response.Players) == 0 {
-		return nil, fmt.Errorf("no player found for steamID: %s", steamID)
+		return nil, fmt.Errorf("no player found for steamID: %s: %w", steamID, ErrNotFound)
 	}
 
 	return &response.Response.Players[0], nil
 }
 
 // GetSteamLevel fetches the Steam level for a player
-func GetSteamLevel(apiKey, steamID string) (int, error) {
-	apiURL := fmt.Sprintf("https://api.steampowered.com/IPlayerService/GetSteamLevel/v1/?key=%s&steamid=%s",
-		apiKey, steamID)
+func (c *Client) GetSteamLevel(ctx context.Context, steamID string) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetSteamLevel", tracing.String("steam_id", steamID))
+	defer func() { span.Finish(err) }()
+
+	apiURL := fmt.Sprintf("%s/IPlayerService/GetSteamLevel/v1/?key=%s&steamid=%s",
+		c.webAPIURL, url.QueryEscape(c.apiKey), url.QueryEscape(steamID))
 
 	var response SteamPlayerLevelResponse
-	if err := utils.HttpGetJSON(apiURL, &response); err != nil {
+	if err := c.http.GetJSON(ctx, apiURL, &response); err != nil {
 		return 0, fmt.Errorf("fetching steam level: %w", err)
 	}
 
@@ -388,12 +613,15 @@ func GetSteamLevel(apiKey, steamID string) (int, error) {
 }
 
 // GetSteamOwnedGamesCount fetches the number of games owned by a player
-func GetSteamOwnedGamesCount(apiKey, steamID string) (int, error) {
-	apiURL := fmt.Sprintf("https://api.steampowered.com/IPlayerService/GetOwnedGames/v1/?key=%s&steamid=%s&include_played_free_games=true",
-		apiKey, steamID)
+func (c *Client) GetSteamOwnedGamesCount(ctx context.Context, steamID string) (_ int, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetSteamOwnedGamesCount", tracing.String("steam_id", steamID))
+	defer func() { span.Finish(err) }()
+
+	apiURL := fmt.Sprintf("%s/IPlayerService/GetOwnedGames/v1/?key=%s&steamid=%s&include_played_free_games=true",
+		c.webAPIURL, url.QueryEscape(c.apiKey), url.QueryEscape(steamID))
 
 	var response SteamOwnedGamesResponse
-	if err := utils.HttpGetJSON(apiURL, &response); err != nil {
+	if err := c.http.GetJSON(ctx, apiURL, &response); err != nil {
 		return 0, fmt.Errorf("fetching owned games: %w", err)
 	}
 
@@ -401,19 +629,22 @@ func GetSteamOwnedGamesCount(apiKey, steamID string) (int, error) {
 }
 
 // GetSteamUserInfo fetches complete user info by username (vanity URL)
-func GetSteamUserInfo(apiKey, username string) (*SteamUserInfo, error) {
-	steamID, err := ResolveSteamVanityURL(apiKey, username)
+func (c *Client) GetSteamUserInfo(ctx context.Context, username string) (_ *SteamUserInfo, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetSteamUserInfo", tracing.String("vanity_url", username))
+	defer func() { span.Finish(err) }()
+
+	steamID, err := c.ResolveSteamVanityURL(ctx, username)
 	if err != nil {
 		return nil, err
 	}
 
-	summary, err := GetSteamPlayerSummary(apiKey, steamID)
+	summary, err := c.GetSteamPlayerSummary(ctx, steamID)
 	if err != nil {
 		return nil, err
 	}
 
-	level, _ := GetSteamLevel(apiKey, steamID)
-	gameCount, _ := GetSteamOwnedGamesCount(apiKey, steamID)
+	level, _ := c.GetSteamLevel(ctx, steamID)
+	gameCount, _ := c.GetSteamOwnedGamesCount(ctx, steamID)
 
 	return &SteamUserInfo{
 		Summary:   *summary,
@@ -1,183 +1,473 @@
 package steam
 
 import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/rshero/hltb"
 )
 
+// CacheInspector is the part of a cache that doesn't depend on its key and value
+// types, used to report on and manage every cache alike
+type CacheInspector interface {
+	// Name identifies the cache, e.g. in stats and admin commands
+	Name() string
+	// Stats returns the cache's counters since it was created
+	Stats() CacheStats
+	// Size returns the number of cached entries
+	Size() int
+	// Clear removes every entry
+	Clear()
+	// DeletePrefix removes every entry whose key, rendered as a string, starts with
+	// prefix, forgets the errors cached for such keys, and returns how many entries
+	// were removed
+	DeletePrefix(prefix string) int
+}
+
+// Cache is a key-value cache with expiring entries, kept in process by TTLCache
+// or shared between bot instances by RedisCache
+type Cache[K comparable, V any] interface {
+	CacheInspector
+
+	// Get returns the value for key if it is cached and not expired
+	Get(key K) (V, bool)
+	// Set stores a value with the cache's TTL
+	Set(key K, value V)
+	// Delete removes key, so the next lookup fetches it again, and reports whether it was cached
+	Delete(key K) bool
+	// GetOrFetch returns the cached value or fetches and caches it
+	GetOrFetch(key K, fetch func() (V, error)) (V, error)
+	// GetOrFetchContext is GetOrFetch with a context-aware fetch function
+	GetOrFetchContext(ctx context.Context, key K, fetch func(context.Context) (V, error)) (V, error)
+}
+
+// CacheStats counts a cache's lookups and removals
+type CacheStats struct {
+	Hits        uint64 // lookups answered with a fresh entry or a cached error
+	StaleHits   uint64 // lookups answered with an expired entry
+	Misses      uint64 // lookups that had to wait for the upstream
+	Evictions   uint64 // live entries removed to make room
+	Expirations uint64 // entries removed once past their TTL and stale retention
+}
+
+// HitRatio returns the share of lookups answered from the cache, stale or not
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.StaleHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.StaleHits) / float64(total)
+}
+
+// cacheCounters is the live, concurrently updated form of CacheStats
+type cacheCounters struct {
+	hits, staleHits, misses, evictions, expirations atomic.Uint64
+}
+
+func (c *cacheCounters) snapshot() CacheStats {
+	return CacheStats{
+		Hits:        c.hits.Load(),
+		StaleHits:   c.staleHits.Load(),
+		Misses:      c.misses.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
+
 // CacheEntry holds cached data with expiration time
 type CacheEntry[T any] struct {
 	Data      T
 	ExpiresAt time.Time
 }
 
-// TTLCache is a generic thread-safe cache with TTL support
-type TTLCache[K comparable, V any] struct {
-	mu       sync.RWMutex
-	data     map[K]CacheEntry[V]
-	ttl      time.Duration
-	maxSize  int
-	cleanupN int // number of oldest items to remove on cleanup
+// cacheSettings holds the options shared by every cache backend
+type cacheSettings struct {
+	name    string
+	ttl     time.Duration
+	maxSize int
+
+	// Negative caching of fetch errors, disabled when negativeTTL is 0
+	negativeTTL   time.Duration
+	cacheNegative func(error) bool
+
+	// Expired entries are kept around for the longer of these windows
+	staleWhileRevalidate time.Duration // serve expired entries while refreshing in the background
+	staleOnError         time.Duration // serve expired entries when a refresh fails
+
+	// Hot entries are refreshed in the background shortly before they expire
+	refreshAhead time.Duration
+	hotHits      int32
+}
+
+func defaultCacheSettings() cacheSettings {
+	return cacheSettings{
+		ttl:     10 * time.Minute, // default TTL
+		maxSize: 100,              // default max size
+	}
+}
+
+// retention returns how long expired entries are kept for stale serving
+func (s *cacheSettings) retention() time.Duration {
+	return max(s.staleWhileRevalidate, s.staleOnError)
 }
 
 // CacheOption is a functional option for configuring the cache
-type CacheOption[K comparable, V any] func(*TTLCache[K, V])
+type CacheOption[K comparable, V any] func(*cacheSettings)
+
+// WithName sets the name the cache is reported under
+func WithName[K comparable, V any](name string) CacheOption[K, V] {
+	return func(s *cacheSettings) {
+		s.name = name
+	}
+}
 
 // WithTTL sets the TTL for cache entries
 func WithTTL[K comparable, V any](ttl time.Duration) CacheOption[K, V] {
-	return func(c *TTLCache[K, V]) {
-		c.ttl = ttl
+	return func(s *cacheSettings) {
+		s.ttl = ttl
 	}
 }
 
 // WithMaxSize sets the maximum size of the cache
 func WithMaxSize[K comparable, V any](size int) CacheOption[K, V] {
-	return func(c *TTLCache[K, V]) {
-		c.maxSize = size
+	return func(s *cacheSettings) {
+		s.maxSize = size
 	}
 }
 
-// WithCleanupCount sets how many items to remove when cache is full
+// WithCleanupCount used to set how many entries were removed at once when the cache
+// was full.
+//
+// Deprecated: the cache now evicts one least recently used entry at a time, so
+// this option has no effect.
 func WithCleanupCount[K comparable, V any](n int) CacheOption[K, V] {
-	return func(c *TTLCache[K, V]) {
-		c.cleanupN = n
+	return func(*cacheSettings) {}
+}
+
+// WithNegativeCaching makes GetOrFetch remember errors accepted by cacheable (all
+// errors if nil) for ttl, so repeated lookups of a bad key don't hit the upstream
+func WithNegativeCaching[K comparable, V any](ttl time.Duration, cacheable func(error) bool) CacheOption[K, V] {
+	return func(s *cacheSettings) {
+		s.negativeTTL = ttl
+		s.cacheNegative = cacheable
 	}
 }
 
+// WithStaleWhileRevalidate makes GetOrFetch return entries that expired less than
+// window ago immediately, refreshing them in the background
+func WithStaleWhileRevalidate[K comparable, V any](window time.Duration) CacheOption[K, V] {
+	return func(s *cacheSettings) {
+		s.staleWhileRevalidate = window
+	}
+}
+
+// WithStaleOnError makes GetOrFetch return entries that expired less than window
+// ago when fetching a fresh value fails
+func WithStaleOnError[K comparable, V any](window time.Duration) CacheOption[K, V] {
+	return func(s *cacheSettings) {
+		s.staleOnError = window
+	}
+}
+
+// WithRefreshAhead refreshes entries looked up at least minHits times in the
+// background once they are within before of expiring, so hot keys never go cold
+func WithRefreshAhead[K comparable, V any](before time.Duration, minHits int) CacheOption[K, V] {
+	return func(s *cacheSettings) {
+		s.refreshAhead = before
+		s.hotHits = int32(minHits)
+	}
+}
+
+// cacheKeyString renders a key for backends that store string keys
+func cacheKeyString[K comparable](key K) string {
+	if s, ok := any(key).(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(key)
+}
+
+// ----- In-Memory Cache -----
+
+// TTLCache is a generic thread-safe cache with TTL support. When full it evicts the
+// least recently used entry; expired entries are found through a min-heap, so every
+// operation runs in constant or logarithmic time.
+type TTLCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	items    map[K]*cacheNode[K, V]
+	recency  cacheList[K, V]  // most recently used first
+	expiry   expiryHeap[K, V] // soonest expiry first
+	settings cacheSettings
+	stats    cacheCounters
+	loader   *cacheLoader[K, V]
+}
+
 // NewTTLCache creates a new TTL cache with the given options
 func NewTTLCache[K comparable, V any](opts ...CacheOption[K, V]) *TTLCache[K, V] {
 	cache := &TTLCache[K, V]{
-		data:     make(map[K]CacheEntry[V]),
-		ttl:      10 * time.Minute, // default TTL
-		maxSize:  100,              // default max size
-		cleanupN: 25,               // default cleanup count
+		items:    make(map[K]*cacheNode[K, V]),
+		settings: defaultCacheSettings(),
 	}
+	cache.recency.init()
+	cache.loader = newCacheLoader(&cache.settings, &cache.stats, cache.lookup, cache.Set)
 
 	for _, opt := range opts {
-		opt(cache)
+		opt(&cache.settings)
 	}
 
 	return cache
 }
 
-// Get retrieves a value from the cache. Returns the value and true if found and not expired.
-func (c *TTLCache[K, V]) Get(key K) (V, bool) {
-	c.mu.RLock()
-	entry, exists := c.data[key]
-	c.mu.RUnlock()
+// Configure applies options to an existing cache. Call it before the cache is in use.
+func (c *TTLCache[K, V]) Configure(opts ...CacheOption[K, V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	if !exists {
-		var zero V
-		return zero, false
+	for _, opt := range opts {
+		opt(&c.settings)
 	}
+}
 
-	if time.Now().After(entry.ExpiresAt) {
-		c.mu.Lock()
-		delete(c.data, key)
-		c.mu.Unlock()
+// Get retrieves a value from the cache. Returns the value and true if found and not expired.
+func (c *TTLCache[K, V]) Get(key K) (V, bool) {
+	now := time.Now()
+	entry, _ := c.lookup(key, now)
+	if entry == nil || now.After(entry.ExpiresAt) {
+		c.stats.misses.Add(1)
 		var zero V
 		return zero, false
 	}
 
+	c.stats.hits.Add(1)
 	return entry.Data, true
 }
 
-// Set stores a value in the cache with the configured TTL
-func (c *TTLCache[K, V]) Set(key K, value V) {
+// Name returns the name set with WithName
+func (c *TTLCache[K, V]) Name() string {
+	return c.settings.name
+}
+
+// Stats returns the cache's counters
+func (c *TTLCache[K, V]) Stats() CacheStats {
+	return c.stats.snapshot()
+}
+
+// lookup returns the entry for key, fresh or still within its stale retention, and
+// marks it as recently used. It also returns how many lookups found the entry fresh,
+// counting this one. Entries past their retention are removed.
+func (c *TTLCache[K, V]) lookup(key K, now time.Time) (*CacheEntry[V], int32) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// Clean up if at max size
-	if len(c.data) >= c.maxSize {
-		c.cleanupExpired()
-		// If still at max, remove oldest entries
-		if len(c.data) >= c.maxSize {
-			c.removeOldest()
-		}
+	node, exists := c.items[key]
+	if !exists {
+		return nil, 0
+	}
+	if now.After(node.entry.ExpiresAt.Add(c.settings.retention())) {
+		c.removeNode(node)
+		c.stats.expirations.Add(1)
+		return nil, 0
 	}
 
-	c.data[key] = CacheEntry[V]{
-		Data:      value,
-		ExpiresAt: time.Now().Add(c.ttl),
+	if now.Before(node.entry.ExpiresAt) {
+		node.hits++
 	}
+	c.recency.moveToFront(node)
+	return node.entry, node.hits
 }
 
-// GetOrFetch attempts to get from cache, or fetches using the provided function
-func (c *TTLCache[K, V]) GetOrFetch(key K, fetch func() (V, error)) (V, error) {
-	if cached, ok := c.Get(key); ok {
-		return cached, nil
-	}
+// Set stores a value in the cache with the configured TTL
+func (c *TTLCache[K, V]) Set(key K, value V) {
+	c.loader.forget(key)
 
-	value, err := fetch()
-	if err != nil {
-		var zero V
-		return zero, err
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &CacheEntry[V]{
+		Data:      value,
+		ExpiresAt: time.Now().Add(c.settings.ttl),
 	}
 
-	c.Set(key, value)
-	return value, nil
-}
+	if node, exists := c.items[key]; exists {
+		node.entry = entry
+		node.hits = 0
+		heap.Fix(&c.expiry, node.heapIndex)
+		c.recency.moveToFront(node)
+		return
+	}
 
-// cleanupExpired removes all expired entries (must be called with lock held)
-func (c *TTLCache[K, V]) cleanupExpired() {
-	now := time.Now()
-	for key, entry := range c.data {
-		if now.After(entry.ExpiresAt) {
-			delete(c.data, key)
+	// Make room: drop entries past their retention first, then the least recently used
+	c.removeExpired(time.Now())
+	for len(c.items) >= c.settings.maxSize {
+		lru := c.recency.back()
+		if lru == nil {
+			break
 		}
+		c.removeNode(lru)
+		c.stats.evictions.Add(1)
 	}
+
+	node := &cacheNode[K, V]{key: key, entry: entry}
+	c.items[key] = node
+	c.recency.pushFront(node)
+	heap.Push(&c.expiry, node)
 }
 
-// removeOldest removes the oldest entries (must be called with lock held)
-func (c *TTLCache[K, V]) removeOldest() {
-	type keyExpiry struct {
-		key       K
-		expiresAt time.Time
-	}
+// Delete removes key from the cache and reports whether it was cached
+func (c *TTLCache[K, V]) Delete(key K) bool {
+	c.loader.forget(key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	entries := make([]keyExpiry, 0, len(c.data))
-	for k, v := range c.data {
-		entries = append(entries, keyExpiry{key: k, expiresAt: v.ExpiresAt})
+	node, exists := c.items[key]
+	if exists {
+		c.removeNode(node)
 	}
+	return exists
+}
+
+// DeletePrefix removes every entry whose key, rendered as a string, starts with
+// prefix, along with any errors cached for such keys
+func (c *TTLCache[K, V]) DeletePrefix(prefix string) int {
+	c.loader.forgetPrefix(prefix)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// Sort by expiry time (soonest first = oldest)
-	for i := 0; i < len(entries)-1; i++ {
-		for j := i + 1; j < len(entries); j++ {
-			if entries[i].expiresAt.After(entries[j].expiresAt) {
-				entries[i], entries[j] = entries[j], entries[i]
-			}
+	removed := 0
+	for key, node := range c.items {
+		if strings.HasPrefix(cacheKeyString(key), prefix) {
+			c.removeNode(node)
+			removed++
 		}
 	}
+	return removed
+}
+
+// GetOrFetch attempts to get from cache, or fetches using the provided function.
+// Concurrent calls for the same key share a single fetch.
+func (c *TTLCache[K, V]) GetOrFetch(key K, fetch func() (V, error)) (V, error) {
+	return c.GetOrFetchContext(context.Background(), key, func(context.Context) (V, error) {
+		return fetch()
+	})
+}
+
+// GetOrFetchContext is GetOrFetch with a context-aware fetch function. Foreground
+// fetches get ctx; background refreshes get a detached copy of it with background
+// priority, so they outlive the request that triggered them.
+func (c *TTLCache[K, V]) GetOrFetchContext(ctx context.Context, key K, fetch func(context.Context) (V, error)) (V, error) {
+	return c.loader.getOrFetch(ctx, key, fetch)
+}
 
-	// Remove the oldest entries
-	removeCount := min(c.cleanupN, len(entries))
-	for i := range removeCount {
-		delete(c.data, entries[i].key)
+// removeExpired removes all entries past their stale retention (must be called with lock held)
+func (c *TTLCache[K, V]) removeExpired(now time.Time) {
+	cutoff := now.Add(-c.settings.retention())
+	for c.expiry.expiredBefore(cutoff) {
+		c.removeNode(c.expiry.peek())
+		c.stats.expirations.Add(1)
 	}
 }
 
+// removeNode drops a node from the map, recency list and expiry heap (must be called with lock held)
+func (c *TTLCache[K, V]) removeNode(node *cacheNode[K, V]) {
+	delete(c.items, node.key)
+	c.recency.remove(node)
+	heap.Remove(&c.expiry, node.heapIndex)
+}
+
 // Size returns the current number of items in the cache
 func (c *TTLCache[K, V]) Size() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return len(c.data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
 }
 
 // Clear removes all entries from the cache
 func (c *TTLCache[K, V]) Clear() {
+	c.loader.clear()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.data = make(map[K]CacheEntry[V])
+	c.items = make(map[K]*cacheNode[K, V])
+	c.recency.init()
+	c.expiry = nil
 }
 
-// Global cache instance for Steam app details
-var appDetailsCache = NewTTLCache[string, *SteamAppDetails](
-	WithTTL[string, *SteamAppDetails](15*time.Minute),
-	WithMaxSize[string, *SteamAppDetails](200),
-	WithCleanupCount[string, *SteamAppDetails](50),
-)
+// ----- Cache Sets -----
+
+// CacheSet holds the caches a Client looks up, built by NewCacheSet
+type CacheSet struct {
+	appDetails     Cache[RegionKey, *SteamAppDetails]  // Steam app details, keyed by app and store country
+	regionalPrices Cache[RegionKey, RegionalPrice]     // per-region prices fetched through filters=price_overview
+	exchangeRates  Cache[string, map[string]float64]   // currency exchange rates keyed by base currency
+	stores         Cache[string, map[string]Store]     // CheapShark's store catalogue, which rarely changes
+	reviews        Cache[string, *SteamReviewSummary]  // review summaries keyed by app ID
+	hltb           Cache[string, *hltb.Game]           // HLTB results keyed by normalized title
+	search         Cache[SearchKey, []SteamSearchItem] // store searches keyed by normalized query and country
+}
+
+// appDetailsCacheOptions configures the app details cache, serving expired details
+// for staleWhileRevalidate while refreshing and for staleOnError when Steam is down
+func appDetailsCacheOptions(staleWhileRevalidate, staleOnError time.Duration) []CacheOption[RegionKey, *SteamAppDetails] {
+	return []CacheOption[RegionKey, *SteamAppDetails]{
+		WithTTL[RegionKey, *SteamAppDetails](15 * time.Minute),
+		WithMaxSize[RegionKey, *SteamAppDetails](200),
+		// Unknown or delisted app IDs are remembered briefly instead of re-queried on every lookup
+		WithNegativeCaching[RegionKey, *SteamAppDetails](2*time.Minute, func(err error) bool {
+			return errors.Is(err, ErrNotFound)
+		}),
+		WithStaleWhileRevalidate[RegionKey, *SteamAppDetails](staleWhileRevalidate),
+		WithStaleOnError[RegionKey, *SteamAppDetails](staleOnError),
+		WithRefreshAhead[RegionKey, *SteamAppDetails](2*time.Minute, 3),
+	}
+}
+
+var regionalPriceCacheOptions = []CacheOption[RegionKey, RegionalPrice]{
+	WithTTL[RegionKey, RegionalPrice](30 * time.Minute),
+	WithMaxSize[RegionKey, RegionalPrice](1000),
+}
+
+var exchangeRatesCacheOptions = []CacheOption[string, map[string]float64]{
+	WithTTL[string, map[string]float64](12 * time.Hour),
+	WithMaxSize[string, map[string]float64](10),
+	WithStaleOnError[string, map[string]float64](72 * time.Hour),
+}
+
+var storesCacheOptions = []CacheOption[string, map[string]Store]{
+	WithTTL[string, map[string]Store](24 * time.Hour),
+	WithMaxSize[string, map[string]Store](1),
+	WithStaleOnError[string, map[string]Store](7 * 24 * time.Hour),
+}
+
+var reviewsCacheOptions = []CacheOption[string, *SteamReviewSummary]{
+	WithTTL[string, *SteamReviewSummary](3 * time.Hour),
+	WithMaxSize[string, *SteamReviewSummary](1000),
+	WithNegativeCaching[string, *SteamReviewSummary](10*time.Minute, func(err error) bool {
+		return errors.Is(err, ErrNotFound)
+	}),
+	WithStaleOnError[string, *SteamReviewSummary](24 * time.Hour),
+}
+
+// Playtimes barely change once a game is out, so HLTB results are kept for a week
+var hltbCacheOptions = []CacheOption[string, *hltb.Game]{
+	WithTTL[string, *hltb.Game](7 * 24 * time.Hour),
+	WithMaxSize[string, *hltb.Game](2000),
+	// Games HLTB doesn't know stay unknown for a while
+	WithNegativeCaching[string, *hltb.Game](24*time.Hour, func(err error) bool {
+		return errors.Is(err, ErrNotFound)
+	}),
+	WithStaleOnError[string, *hltb.Game](30 * 24 * time.Hour),
+}
 
-// GetAppDetailsCache returns the global app details cache
-func GetAppDetailsCache() *TTLCache[string, *SteamAppDetails] {
-	return appDetailsCache
+// Search results carry prices, so they are only kept long enough to absorb repeated inline typing
+var searchCacheOptions = []CacheOption[SearchKey, []SteamSearchItem]{
+	WithTTL[SearchKey, []SteamSearchItem](10 * time.Minute),
+	WithMaxSize[SearchKey, []SteamSearchItem](2000),
+	WithStaleOnError[SearchKey, []SteamSearchItem](time.Hour),
 }
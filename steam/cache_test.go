@@ -0,0 +1,240 @@
+package steam
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"steam_bot/metrics"
+)
+
+func TestTTLCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewTTLCache[string, int](WithMaxSize[string, int](2))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a") // b is now the least recently used
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("expected %s to be cached", key)
+		}
+	}
+	if c.Size() != 2 {
+		t.Errorf("Size() = %d, want 2", c.Size())
+	}
+}
+
+func TestTTLCacheDropsExpiredBeforeLive(t *testing.T) {
+	c := NewTTLCache[string, int](WithMaxSize[string, int](2), WithTTL[string, int](time.Millisecond))
+	c.Set("old", 1)
+	time.Sleep(2 * time.Millisecond)
+
+	c.Configure(WithTTL[string, int](time.Hour))
+	c.Set("a", 2)
+	c.Set("b", 3)
+
+	if _, ok := c.Get("a"); !ok {
+		t.Error("expected a to survive; the expired entry should have been dropped instead")
+	}
+	if c.Size() != 2 {
+		t.Errorf("Size() = %d, want 2", c.Size())
+	}
+}
+
+func TestTTLCacheRefreshesHotEntriesAhead(t *testing.T) {
+	c := NewTTLCache[string, int](
+		WithTTL[string, int](100*time.Millisecond),
+		WithRefreshAhead[string, int](50*time.Millisecond, 3),
+	)
+	c.Set("hot", 1)
+	c.Set("cold", 1)
+
+	refreshed := make(chan struct{})
+	refresh := func() (int, error) {
+		defer close(refreshed)
+		return 2, nil
+	}
+
+	// Three lookups make an entry hot; Get counts too
+	c.Get("hot")
+	c.Get("hot")
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := c.GetOrFetch("hot", refresh); v != 1 {
+		t.Errorf("hot lookup = %d, want the cached 1 while refreshing", v)
+	}
+	if v, _ := c.GetOrFetch("cold", func() (int, error) { return 2, nil }); v != 1 {
+		t.Errorf("cold lookup = %d, want the cached 1", v)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("hot entry was not refreshed")
+	}
+	time.Sleep(10 * time.Millisecond) // the refresh stores its value after returning
+
+	if v, _ := c.Get("hot"); v != 2 {
+		t.Errorf("hot entry = %d, want it refreshed to 2", v)
+	}
+	if v, _ := c.Get("cold"); v != 1 {
+		t.Errorf("cold entry = %d, want it left alone", v)
+	}
+
+	// Replacing an entry starts its count over
+	c.Set("hot", 3)
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := c.GetOrFetch("hot", func() (int, error) { return 4, nil }); v != 3 {
+		t.Errorf("lookup = %d, want the new entry served", v)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := c.Get("hot"); v != 3 {
+		t.Errorf("entry = %d, want no refresh after a single lookup", v)
+	}
+}
+
+func TestTTLCacheIgnoresCleanupCount(t *testing.T) {
+	c := NewTTLCache(WithMaxSize[string, int](2), WithCleanupCount[string, int](25))
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	if c.Size() != 2 {
+		t.Errorf("Size() = %d, want one entry evicted at a time", c.Size())
+	}
+}
+
+// Cache sizes to benchmark; per-operation cost should stay flat as they grow
+var benchCacheSizes = []int{1_000, 10_000, 100_000}
+
+func newBenchCache(size int) *TTLCache[string, int] {
+	c := NewTTLCache[string, int](
+		WithTTL[string, int](time.Hour),
+		WithMaxSize[string, int](size),
+	)
+	for i := range size {
+		c.Set(strconv.Itoa(i), i)
+	}
+	return c
+}
+
+func BenchmarkTTLCacheGet(b *testing.B) {
+	for _, size := range benchCacheSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			c := newBenchCache(size)
+			keys := benchKeys(size, size)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.IntN(len(keys))
+				for pb.Next() {
+					c.Get(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkTTLCacheSetFull measures inserts into a full cache, where every Set evicts
+func BenchmarkTTLCacheSetFull(b *testing.B) {
+	for _, size := range benchCacheSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			c := newBenchCache(size)
+			keys := benchKeys(size*4, size*4)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.IntN(len(keys))
+				for pb.Next() {
+					c.Set(keys[i%len(keys)], i)
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkTTLCacheContended runs a 90/10 read/write mix over a full cache from many
+// goroutines and reports tail latency per operation. Since every operation holds
+// the lock, the p99 and max latencies bound how long the lock is held and waited on.
+func BenchmarkTTLCacheContended(b *testing.B) {
+	for _, size := range benchCacheSizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			c := newBenchCache(size)
+			keys := benchKeys(size*2, size*2)
+
+			var mu sync.Mutex
+			var latencies []time.Duration
+
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				local := make([]time.Duration, 0, 1024)
+				i := rand.IntN(len(keys))
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					start := time.Now()
+					if i%10 == 0 {
+						c.Set(key, i)
+					} else {
+						c.Get(key)
+					}
+					local = append(local, time.Since(start))
+					i++
+				}
+
+				mu.Lock()
+				latencies = append(latencies, local...)
+				mu.Unlock()
+			})
+			b.StopTimer()
+
+			if len(latencies) == 0 {
+				return
+			}
+			slices.Sort(latencies)
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns/op")
+			b.ReportMetric(float64(latencies[len(latencies)*999/1000].Nanoseconds()), "p999-ns/op")
+		})
+	}
+}
+
+// benchKeys returns n keys drawn from a keyspace of the given size, in random order
+func benchKeys(n, keyspace int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = strconv.Itoa(rand.IntN(keyspace))
+	}
+	return keys
+}
+
+func TestCacheSetRegisterMetricsReportsItsOwnCaches(t *testing.T) {
+	set := newMemoryCacheSet()
+	set.reviews.Set("620", &SteamReviewSummary{})
+	set.reviews.Get("620")
+
+	registry := metrics.NewRegistry()
+	set.RegisterMetrics(registry)
+
+	var out strings.Builder
+	if err := registry.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`steam_bot_cache_entries{cache="reviews"} 1`,
+		`steam_bot_cache_entries{cache="app_details"} 0`,
+		`steam_bot_cache_hits_total{cache="reviews"} 1`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("metrics are missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package steam
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"steam_bot/logattr"
+	"steam_bot/tracing"
+	"steam_bot/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backgroundRefreshTimeout bounds refreshes that run after the caller has been answered
+const backgroundRefreshTimeout = 30 * time.Second
+
+// negativeEntry is a cached fetch error
+type negativeEntry struct {
+	err       error
+	expiresAt time.Time
+}
+
+// inflightFetch is a fetch in progress that concurrent lookups of the same key wait on
+type inflightFetch[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// cacheLoader implements GetOrFetch on top of a cache backend: concurrent fetches
+// of a key are coalesced, errors can be cached, and expired entries can be served
+// while refreshing or when the upstream fails
+type cacheLoader[K comparable, V any] struct {
+	settings *cacheSettings
+	stats    *cacheCounters
+	lookup   func(key K, now time.Time) (*CacheEntry[V], int32) // fresh or within stale retention, and its fresh hits
+	store    func(key K, value V)
+
+	mu       sync.Mutex
+	inflight map[K]*inflightFetch[V]
+	negative map[K]negativeEntry
+}
+
+func newCacheLoader[K comparable, V any](settings *cacheSettings, stats *cacheCounters, lookup func(K, time.Time) (*CacheEntry[V], int32), store func(K, V)) *cacheLoader[K, V] {
+	return &cacheLoader[K, V]{
+		settings: settings,
+		stats:    stats,
+		lookup:   lookup,
+		store:    store,
+		inflight: make(map[K]*inflightFetch[V]),
+		negative: make(map[K]negativeEntry),
+	}
+}
+
+// Lookup outcomes recorded on cache spans
+const (
+	lookupHit      = "hit"
+	lookupStale    = "stale"
+	lookupNegative = "negative"
+	lookupMiss     = "miss"
+)
+
+func (l *cacheLoader[K, V]) getOrFetch(ctx context.Context, key K, fetch func(context.Context) (V, error)) (V, error) {
+	ctx, span := tracing.Start(ctx, "cache.GetOrFetch")
+	if span.IsRecording() {
+		span.SetAttributes(tracing.String("cache.name", l.settings.name), tracing.String("cache.key", cacheKeyString(key)))
+	}
+
+	value, outcome, err := l.load(ctx, key, fetch)
+	span.SetAttributes(tracing.String("cache.result", outcome))
+	span.Finish(err)
+	return value, err
+}
+
+// load returns key's value and how the lookup was answered
+func (l *cacheLoader[K, V]) load(ctx context.Context, key K, fetch func(context.Context) (V, error)) (V, string, error) {
+	for {
+		now := time.Now()
+		entry, hits := l.lookup(key, now)
+
+		if entry != nil {
+			switch {
+			case now.Before(entry.ExpiresAt):
+				if l.settings.refreshAhead > 0 && hits >= l.settings.hotHits && entry.ExpiresAt.Sub(now) < l.settings.refreshAhead {
+					l.refreshInBackground(ctx, key, fetch)
+				}
+				l.stats.hits.Add(1)
+				return entry.Data, lookupHit, nil
+			case now.Before(entry.ExpiresAt.Add(l.settings.staleWhileRevalidate)):
+				l.refreshInBackground(ctx, key, fetch)
+				l.stats.staleHits.Add(1)
+				return entry.Data, lookupStale, nil
+			}
+		}
+
+		l.mu.Lock()
+		if err, ok := l.getNegative(key); ok {
+			l.mu.Unlock()
+			l.stats.hits.Add(1)
+			var zero V
+			return zero, lookupNegative, err
+		}
+
+		call, waiting := l.inflight[key]
+		if !waiting {
+			call = &inflightFetch[V]{done: make(chan struct{})}
+			l.inflight[key] = call
+		}
+		l.mu.Unlock()
+
+		if !waiting {
+			l.runFetch(ctx, key, call, fetch)
+		} else {
+			<-call.done
+			// The fetch was cancelled by its caller's context, not ours; try again
+			if isContextErr(call.err) && ctx.Err() == nil {
+				continue
+			}
+		}
+
+		if call.err != nil && entry != nil && l.serveStaleOn(call.err) && time.Now().Before(entry.ExpiresAt.Add(l.settings.staleOnError)) {
+			l.stats.staleHits.Add(1)
+			return entry.Data, lookupStale, nil
+		}
+		l.stats.misses.Add(1)
+		return call.value, lookupMiss, call.err
+	}
+}
+
+// refreshInBackground starts a refresh of key unless one is already running
+func (l *cacheLoader[K, V]) refreshInBackground(ctx context.Context, key K, fetch func(context.Context) (V, error)) {
+	l.mu.Lock()
+	if _, busy := l.inflight[key]; busy {
+		l.mu.Unlock()
+		return
+	}
+	call := &inflightFetch[V]{done: make(chan struct{})}
+	l.inflight[key] = call
+	l.mu.Unlock()
+
+	bgCtx := utils.WithPriority(context.WithoutCancel(ctx), utils.PriorityBackground)
+	bgCtx, cancel := context.WithTimeout(bgCtx, backgroundRefreshTimeout)
+
+	go func() {
+		defer cancel()
+		l.runFetch(bgCtx, key, call, fetch)
+		if call.err != nil {
+			slog.ErrorContext(bgCtx, "Error refreshing cache entry", "cache", l.settings.name, "key", cacheKeyString(key), logattr.Error(call.err))
+		}
+	}()
+}
+
+// runFetch performs a fetch for key, stores the result and releases any waiters
+func (l *cacheLoader[K, V]) runFetch(ctx context.Context, key K, call *inflightFetch[V], fetch func(context.Context) (V, error)) {
+	defer func() {
+		l.mu.Lock()
+		delete(l.inflight, key)
+		l.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.err = fetch(ctx)
+	if call.err == nil {
+		l.store(key, call.value)
+		return
+	}
+
+	if l.settings.negativeTTL > 0 && l.isNegative(call.err) {
+		l.mu.Lock()
+		l.setNegative(key, call.err)
+		l.mu.Unlock()
+	}
+}
+
+// forget drops any cached error for key
+func (l *cacheLoader[K, V]) forget(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.negative, key)
+}
+
+// forgetPrefix drops the cached errors of every key that, rendered as a string,
+// starts with prefix
+func (l *cacheLoader[K, V]) forgetPrefix(prefix string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key := range l.negative {
+		if strings.HasPrefix(cacheKeyString(key), prefix) {
+			delete(l.negative, key)
+		}
+	}
+}
+
+// clear drops every cached error
+func (l *cacheLoader[K, V]) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.negative = make(map[K]negativeEntry)
+}
+
+// isNegative reports whether err should be cached as a negative result
+func (l *cacheLoader[K, V]) isNegative(err error) bool {
+	return !isContextErr(err) && (l.settings.cacheNegative == nil || l.settings.cacheNegative(err))
+}
+
+// serveStaleOn reports whether a stale entry may stand in for a fetch that failed
+// with err. Errors that are negatively cached are answers, not outages.
+func (l *cacheLoader[K, V]) serveStaleOn(err error) bool {
+	return l.settings.staleOnError > 0 && !(l.settings.negativeTTL > 0 && l.isNegative(err))
+}
+
+// getNegative returns the cached error for key, if any (must be called with lock held)
+func (l *cacheLoader[K, V]) getNegative(key K) (error, bool) {
+	entry, ok := l.negative[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(l.negative, key)
+		return nil, false
+	}
+	return entry.err, true
+}
+
+// setNegative caches a fetch error for key (must be called with lock held)
+func (l *cacheLoader[K, V]) setNegative(key K, err error) {
+	if len(l.negative) >= l.settings.maxSize {
+		now := time.Now()
+		for k, entry := range l.negative {
+			if now.After(entry.expiresAt) {
+				delete(l.negative, k)
+			}
+		}
+		// Still full: evict an arbitrary entry, they are short-lived anyway
+		for k := range l.negative {
+			if len(l.negative) < l.settings.maxSize {
+				break
+			}
+			delete(l.negative, k)
+		}
+	}
+
+	l.negative[key] = negativeEntry{err: err, expiresAt: time.Now().Add(l.settings.negativeTTL)}
+}
+
+// isContextErr reports whether err comes from a cancelled or expired context
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,240 @@
+package steam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingFetch returns a fetch that counts its calls and blocks until release is
+// closed, then returns value. started is closed when the first call begins.
+func blockingFetch(value int, calls *atomic.Int32, started, release chan struct{}) func(context.Context) (int, error) {
+	var once sync.Once
+	return func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		once.Do(func() { close(started) })
+		select {
+		case <-release:
+			return value, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func TestGetOrFetchCoalescesConcurrentFetches(t *testing.T) {
+	c := NewTTLCache[string, int]()
+
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	fetch := blockingFetch(42, &calls, started, release)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	results := make([]int, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Go(func() { results[i], errs[i] = c.GetOrFetchContext(context.Background(), "portal", fetch) })
+	}
+
+	<-started
+	time.Sleep(20 * time.Millisecond) // let the other callers join the fetch
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+	for i := range callers {
+		if results[i] != 42 || errs[i] != nil {
+			t.Errorf("caller %d got %d, %v; want 42", i, results[i], errs[i])
+		}
+	}
+	if stats := c.Stats(); stats.Misses != callers {
+		t.Errorf("stats = %+v, want every caller counted as a miss", stats)
+	}
+
+	// Later lookups are answered from the cache
+	if v, err := c.GetOrFetchContext(context.Background(), "portal", fetch); v != 42 || err != nil || calls.Load() != 1 {
+		t.Errorf("cached lookup = %d, %v after %d fetches; want 42 from the cache", v, err, calls.Load())
+	}
+}
+
+func TestGetOrFetchFetchesKeysIndependently(t *testing.T) {
+	c := NewTTLCache[string, int]()
+
+	var calls atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 10 {
+		key := fmt.Sprint("app", i%5)
+		wg.Go(func() {
+			v, err := c.GetOrFetch(key, func() (int, error) {
+				calls.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				return len(key), nil
+			})
+			if v != len(key) || err != nil {
+				t.Errorf("%s = %d, %v", key, v, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 5 {
+		t.Errorf("fetched %d times, want once per key (5)", n)
+	}
+}
+
+func TestGetOrFetchRetriesWhenSharedFetchIsCancelled(t *testing.T) {
+	c := NewTTLCache[string, int]()
+
+	var calls atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+	fetch := blockingFetch(42, &calls, started, release)
+
+	// The first caller gives up; the fetch it started is cancelled with it
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrFetchContext(leaderCtx, "portal", fetch)
+		leaderDone <- err
+	}()
+	<-started
+
+	waiterDone := make(chan int, 1)
+	go func() {
+		v, err := c.GetOrFetchContext(context.Background(), "portal", fetch)
+		if err != nil {
+			t.Errorf("waiter got %v, want a value from its own fetch", err)
+		}
+		waiterDone <- v
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancelLeader()
+	if err := <-leaderDone; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader got %v, want context.Canceled", err)
+	}
+	close(release)
+
+	if v := <-waiterDone; v != 42 {
+		t.Errorf("waiter got %d, want 42", v)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fetched %d times, want the cancelled fetch and the waiter's retry", n)
+	}
+}
+
+func TestGetOrFetchCachesErrorsForNegativeTTL(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	c := NewTTLCache[string, int](WithNegativeCaching[string, int](ttl, func(err error) bool {
+		return errors.Is(err, ErrNotFound)
+	}))
+
+	var calls atomic.Int32
+	notFound := func() (int, error) {
+		calls.Add(1)
+		return 0, fmt.Errorf("app 999999: %w", ErrNotFound)
+	}
+
+	for range 3 {
+		if _, err := c.GetOrFetch("999999", notFound); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetOrFetch = %v, want ErrNotFound", err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fetched %d times within the negative TTL, want 1", n)
+	}
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("stats = %+v, want the cached errors counted as hits", stats)
+	}
+
+	time.Sleep(ttl + 10*time.Millisecond)
+	if _, err := c.GetOrFetch("999999", notFound); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetOrFetch = %v, want ErrNotFound", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fetched %d times, want a new fetch once the negative TTL passed", n)
+	}
+
+	// Storing a value replaces the cached error
+	c.Set("999999", 7)
+	if v, err := c.GetOrFetch("999999", notFound); v != 7 || err != nil {
+		t.Errorf("GetOrFetch = %d, %v after Set, want 7", v, err)
+	}
+}
+
+func TestGetOrFetchDoesNotCacheOtherErrors(t *testing.T) {
+	c := NewTTLCache[string, int](WithNegativeCaching[string, int](time.Hour, func(err error) bool {
+		return errors.Is(err, ErrNotFound)
+	}))
+
+	var calls atomic.Int32
+	fail := func(err error) func(context.Context) (int, error) {
+		return func(context.Context) (int, error) {
+			calls.Add(1)
+			return 0, err
+		}
+	}
+
+	for _, err := range []error{ErrUpstreamDown, ErrUpstreamDown, context.DeadlineExceeded, context.DeadlineExceeded} {
+		if _, got := c.GetOrFetchContext(context.Background(), "620", fail(err)); !errors.Is(got, err) {
+			t.Fatalf("GetOrFetch = %v, want %v", got, err)
+		}
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("fetched %d times, want every outage and timeout retried (4)", n)
+	}
+}
+
+func TestDeletePrefixForgetsCachedErrors(t *testing.T) {
+	negative := WithNegativeCaching[string, int](time.Hour, nil)
+	_, redis := startFakeRedis(t)
+
+	for _, tt := range []struct {
+		name  string
+		cache Cache[string, int]
+	}{
+		{"memory", NewTTLCache(negative)},
+		{"redis", NewRedisCache(redis, "test:", negative)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			notFound := func(context.Context) (int, error) {
+				calls.Add(1)
+				return 0, ErrNotFound
+			}
+
+			keys := []string{"620:us", "620:gb", "400:us"}
+			for _, key := range keys {
+				tt.cache.GetOrFetchContext(context.Background(), key, notFound)
+			}
+			tt.cache.DeletePrefix("620:")
+			for _, key := range keys {
+				tt.cache.GetOrFetchContext(context.Background(), key, notFound)
+			}
+
+			if n := calls.Load(); n != 5 {
+				t.Errorf("fetched %d times, want the 620 errors forgotten and the 400 one kept (5)", n)
+			}
+		})
+	}
+}
+
+func TestGetOrFetchServesStaleOnError(t *testing.T) {
+	c := NewTTLCache[string, int](
+		WithTTL[string, int](10*time.Millisecond),
+		WithStaleOnError[string, int](time.Hour),
+	)
+	c.Set("620", 1)
+	time.Sleep(20 * time.Millisecond)
+
+	v, err := c.GetOrFetch("620", func() (int, error) { return 0, ErrUpstreamDown })
+	if v != 1 || err != nil {
+		t.Errorf("GetOrFetch = %d, %v; want the stale 1 while the upstream is down", v, err)
+	}
+}
@@ -0,0 +1,42 @@
+package steam
+
+import "steam_bot/metrics"
+
+// ----- Cache Metrics -----
+
+// cacheStatFuncs lists the counters exported for every cache
+var cacheStatFuncs = []struct {
+	name, help string
+	value      func(CacheStats) uint64
+}{
+	{"steam_bot_cache_hits_total", "Lookups answered with a fresh entry or a cached error", func(s CacheStats) uint64 { return s.Hits }},
+	{"steam_bot_cache_stale_hits_total", "Lookups answered with an expired entry", func(s CacheStats) uint64 { return s.StaleHits }},
+	{"steam_bot_cache_misses_total", "Lookups that had to wait for the upstream", func(s CacheStats) uint64 { return s.Misses }},
+	{"steam_bot_cache_evictions_total", "Live entries removed to make room", func(s CacheStats) uint64 { return s.Evictions }},
+	{"steam_bot_cache_expirations_total", "Entries removed once past their TTL and stale retention", func(s CacheStats) uint64 { return s.Expirations }},
+}
+
+// RegisterMetrics exports the statistics of every cache in the set with r. Call it
+// once per registry.
+func (s *CacheSet) RegisterMetrics(r *metrics.Registry) {
+	labels := []string{"cache"}
+
+	for _, stat := range cacheStatFuncs {
+		r.NewCounterFunc(stat.name, stat.help, labels, func(report func(float64, ...string)) {
+			for _, c := range s.All() {
+				report(float64(stat.value(c.Stats())), c.Name())
+			}
+		})
+	}
+
+	r.NewGaugeFunc("steam_bot_cache_hit_ratio", "Share of lookups answered from the cache since startup", labels, func(report func(float64, ...string)) {
+		for _, c := range s.All() {
+			report(c.Stats().HitRatio(), c.Name())
+		}
+	})
+	r.NewGaugeFunc("steam_bot_cache_entries", "Entries currently cached", labels, func(report func(float64, ...string)) {
+		for _, c := range s.All() {
+			report(float64(c.Size()), c.Name())
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package steam
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"steam_bot/logattr"
+	"steam_bot/utils"
+	"time"
+)
+
+// ----- Cache Setup -----
+
+// Cache names, used to choose a backend per cache and to prefix Redis keys
+const (
+	CacheAppDetails     = "app_details"
+	CacheRegionalPrices = "regional_prices"
+	CacheExchangeRates  = "exchange_rates"
+	CacheStores         = "stores"
+	CacheReviews        = "reviews"
+	CacheHLTB           = "hltb"
+	CacheSearch         = "search"
+)
+
+// Cache backends
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+)
+
+// Default stale windows for app details, used by clients created without a CacheSet
+const (
+	defaultStaleWhileRevalidate = time.Hour
+	defaultStaleOnError         = 24 * time.Hour
+)
+
+// CacheConfig chooses where each cache keeps its entries
+type CacheConfig struct {
+	Backend        string            // default for every cache, memory if empty
+	Backends       map[string]string // overrides by cache name
+	RedisURL       string
+	RedisKeyPrefix string
+
+	// How long expired app details are served while refreshing and when Steam is down
+	StaleWhileRevalidate time.Duration
+	StaleOnError         time.Duration
+}
+
+// newMemoryCacheSet builds in-memory caches with the default stale windows
+func newMemoryCacheSet() *CacheSet {
+	set, err := NewCacheSet(CacheConfig{
+		StaleWhileRevalidate: defaultStaleWhileRevalidate,
+		StaleOnError:         defaultStaleOnError,
+	})
+	if err != nil {
+		// In-memory caches can't fail to build
+		panic(err)
+	}
+	return set
+}
+
+// NewCacheSet builds every cache on the backend cfg selects for it
+func NewCacheSet(cfg CacheConfig) (*CacheSet, error) {
+	var redisClient *utils.RedisClient
+	redis := func() (*utils.RedisClient, error) {
+		if redisClient != nil {
+			return redisClient, nil
+		}
+		if cfg.RedisURL == "" {
+			return nil, fmt.Errorf("redis cache backend requires a Redis URL")
+		}
+
+		client, err := utils.NewRedisClient(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+
+		// Lookups fall back to the upstream while Redis is down, so don't refuse to start
+		ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+		defer cancel()
+		if err := client.Ping(ctx); err != nil {
+			slog.Error("Error reaching Redis, caches will miss until it is up", logattr.Error(err))
+		}
+
+		redisClient = client
+		return client, nil
+	}
+
+	var set CacheSet
+	var err error
+	if set.appDetails, err = newCache(cfg, CacheAppDetails, redis, appDetailsCacheOptions(cfg.StaleWhileRevalidate, cfg.StaleOnError)...); err != nil {
+		return nil, err
+	}
+	if set.regionalPrices, err = newCache(cfg, CacheRegionalPrices, redis, regionalPriceCacheOptions...); err != nil {
+		return nil, err
+	}
+	if set.exchangeRates, err = newCache(cfg, CacheExchangeRates, redis, exchangeRatesCacheOptions...); err != nil {
+		return nil, err
+	}
+	if set.stores, err = newCache(cfg, CacheStores, redis, storesCacheOptions...); err != nil {
+		return nil, err
+	}
+	if set.reviews, err = newCache(cfg, CacheReviews, redis, reviewsCacheOptions...); err != nil {
+		return nil, err
+	}
+	if set.hltb, err = newCache(cfg, CacheHLTB, redis, hltbCacheOptions...); err != nil {
+		return nil, err
+	}
+	if set.search, err = newCache(cfg, CacheSearch, redis, searchCacheOptions...); err != nil {
+		return nil, err
+	}
+	return &set, nil
+}
+
+// newCache builds the named cache on the backend cfg selects for it
+func newCache[K comparable, V any](cfg CacheConfig, name string, redis func() (*utils.RedisClient, error), opts ...CacheOption[K, V]) (Cache[K, V], error) {
+	backend := cmp.Or(cfg.Backends[name], cfg.Backend, CacheBackendMemory)
+	opts = append(slices.Clip(opts), WithName[K, V](name))
+
+	switch backend {
+	case CacheBackendMemory:
+		return NewTTLCache(opts...), nil
+	case CacheBackendRedis:
+		client, err := redis()
+		if err != nil {
+			return nil, fmt.Errorf("setting up %s cache: %w", name, err)
+		}
+		return NewRedisCache(client, cfg.RedisKeyPrefix+":"+name+":", opts...), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q for %s cache (expected %s or %s)", backend, name, CacheBackendMemory, CacheBackendRedis)
+	}
+}
+
+// ----- Cache Inspection -----
+
+// All returns every cache in the set
+func (s *CacheSet) All() []CacheInspector {
+	return []CacheInspector{s.appDetails, s.regionalPrices, s.exchangeRates, s.stores, s.reviews, s.hltb, s.search}
+}
+
+// Lookup returns the cache with the given name
+func (s *CacheSet) Lookup(name string) (CacheInspector, bool) {
+	for _, c := range s.All() {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// DropApp removes everything cached for appID in every region, so the next lookup
+// fetches it from Steam again. It returns how many entries were removed.
+func (s *CacheSet) DropApp(appID string) int {
+	prefix := RegionKey{AppID: appID}.String() // "appID:", matching every country
+	removed := s.appDetails.DeletePrefix(prefix) + s.regionalPrices.DeletePrefix(prefix)
+	if s.reviews.Delete(appID) {
+		removed++
+	}
+	return removed
+}
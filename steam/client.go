@@ -0,0 +1,144 @@
+package steam
+
+import (
+	"strings"
+
+	"steam_bot/store"
+	"steam_bot/utils"
+
+	"github.com/rshero/hltb"
+)
+
+// ----- Client -----
+
+// Default upstream base URLs, without trailing slashes
+const (
+	DefaultStoreURL         = "https://store.steampowered.com"
+	DefaultWebAPIURL        = "https://api.steampowered.com"
+	DefaultCheapSharkURL    = "https://www.cheapshark.com"
+	DefaultExchangeRatesURL = "https://open.er-api.com"
+)
+
+// Client looks up games, prices and users from Steam, CheapShark, HLTB and the
+// exchange rate API. Create one with NewClient; it is safe for concurrent use.
+type Client struct {
+	storeURL         string
+	webAPIURL        string
+	cheapSharkURL    string
+	exchangeRatesURL string
+
+	http           *utils.Client
+	apiKey         string // Steam Web API key, for the user lookups
+	defaultCountry string // store country used when no region is requested
+	caches         *CacheSet
+	hltbLimiter    *utils.Limiter
+	hltb           HltbSearcher        // nil uses hltbDefault
+	hltbDefault    *lazyHltb           // real HLTB client, created on first use
+	history        *store.PriceHistory // receives every price observed (nil disables recording)
+}
+
+// HltbSearcher looks games up on How Long To Beat, as *hltb.Client does
+type HltbSearcher interface {
+	SearchFirstWithDetails(name string) (*hltb.Game, error)
+}
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// WithStoreURL sets the Steam storefront base URL
+func WithStoreURL(u string) ClientOption {
+	return func(c *Client) { c.storeURL = strings.TrimSuffix(u, "/") }
+}
+
+// WithWebAPIURL sets the Steam Web API base URL
+func WithWebAPIURL(u string) ClientOption {
+	return func(c *Client) { c.webAPIURL = strings.TrimSuffix(u, "/") }
+}
+
+// WithCheapSharkURL sets the CheapShark API base URL. Store images and deal links
+// still point at the real site.
+func WithCheapSharkURL(u string) ClientOption {
+	return func(c *Client) { c.cheapSharkURL = strings.TrimSuffix(u, "/") }
+}
+
+// WithExchangeRatesURL sets the exchange rate API base URL
+func WithExchangeRatesURL(u string) ClientOption {
+	return func(c *Client) { c.exchangeRatesURL = strings.TrimSuffix(u, "/") }
+}
+
+// WithHTTPClient sets the client used for upstream requests, replacing the shared
+// one with the per-host rate limits
+func WithHTTPClient(h *utils.Client) ClientOption {
+	return func(c *Client) { c.http = h }
+}
+
+// WithAPIKey sets the Steam Web API key used by the user lookups
+func WithAPIKey(key string) ClientOption {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithDefaultCountry sets the store country used when no region is requested
+func WithDefaultCountry(cc string) ClientOption {
+	return func(c *Client) {
+		if cc != "" {
+			c.defaultCountry = strings.ToLower(cc)
+		}
+	}
+}
+
+// WithCaches sets the caches the client looks up, e.g. ones shared with another client
+func WithCaches(s *CacheSet) ClientOption {
+	return func(c *Client) { c.caches = s }
+}
+
+// WithHltbLimiter sets the limiter HLTB searches wait on
+func WithHltbLimiter(l *utils.Limiter) ClientOption {
+	return func(c *Client) { c.hltbLimiter = l }
+}
+
+// WithHltbSearcher sets what HLTB lookups go through, replacing the real HLTB client
+func WithHltbSearcher(s HltbSearcher) ClientOption {
+	return func(c *Client) { c.hltb = s }
+}
+
+// WithPriceHistory enables recording every observed price into h
+func WithPriceHistory(h *store.PriceHistory) ClientOption {
+	return func(c *Client) { c.history = h }
+}
+
+// NewClient creates a client for the real upstreams, with in-memory caches and the
+// shared rate limits, adjusted by opts
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
+		storeURL:         DefaultStoreURL,
+		webAPIURL:        DefaultWebAPIURL,
+		cheapSharkURL:    DefaultCheapSharkURL,
+		exchangeRatesURL: DefaultExchangeRatesURL,
+		http:             httpClient,
+		defaultCountry:   "us",
+		hltbLimiter:      hltbLimiter,
+		hltbDefault:      &lazyHltb{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.caches == nil {
+		c.caches = newMemoryCacheSet()
+	}
+	return c
+}
+
+// DefaultCountry returns the store country used when no region is requested
+func (c *Client) DefaultCountry() string {
+	return c.defaultCountry
+}
+
+// Caches returns the caches the client looks up
+func (c *Client) Caches() *CacheSet {
+	return c.caches
+}
+
+// PriceHistory returns the history prices are recorded into, or nil if recording is disabled
+func (c *Client) PriceHistory() *store.PriceHistory {
+	return c.history
+}
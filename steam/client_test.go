@@ -0,0 +1,172 @@
+package steam
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"steam_bot/internal/fakeupstream"
+	"steam_bot/store"
+	"steam_bot/utils"
+)
+
+// startFakeUpstream returns a client whose every upstream is a fresh fake server
+func startFakeUpstream(t *testing.T, opts ...ClientOption) (*fakeupstream.Server, *Client) {
+	t.Helper()
+
+	srv := fakeupstream.Start()
+	t.Cleanup(srv.Close)
+
+	client := NewClient(append([]ClientOption{
+		WithStoreURL(srv.URL()),
+		WithWebAPIURL(srv.URL()),
+		WithCheapSharkURL(srv.URL()),
+		WithExchangeRatesURL(srv.URL()),
+		WithHTTPClient(utils.NewClient(utils.WithMaxAttempts(1))),
+		WithAPIKey(fakeupstream.APIKey),
+	}, opts...)...)
+	return srv, client
+}
+
+func TestSearchSteamAgainstFakeStore(t *testing.T) {
+	srv, client := startFakeUpstream(t)
+	ctx := context.Background()
+
+	results, err := client.SearchSteam(ctx, "  Portal ", "us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("got %d results, want the first 5", len(results))
+	}
+	if results[0].ID != 620 || results[0].Name != "Portal 2" || results[0].Price.Final != 8200 {
+		t.Errorf("first result = %+v, want Portal 2 at 8200", results[0])
+	}
+
+	// The same search, typed differently, is answered from the cache
+	if _, err := client.SearchSteam(ctx, "portal", "US"); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests("/api/storesearch/"); n != 1 {
+		t.Errorf("store was searched %d times, want 1", n)
+	}
+
+	results, err = client.SearchSteam(ctx, "no such game", "us")
+	if err != nil || len(results) != 0 {
+		t.Errorf("search without matches = %v, %v; want no results and no error", results, err)
+	}
+}
+
+func TestGetSteamUserInfoAgainstFakeWebAPI(t *testing.T) {
+	_, client := startFakeUpstream(t)
+	ctx := context.Background()
+
+	info, err := client.GetSteamUserInfo(ctx, "gabelogannewell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Summary.SteamID != "76561197960287930" || info.Summary.PersonaName != "Rabscuttle" || info.Summary.CountryCode != "US" {
+		t.Errorf("summary = %+v", info.Summary)
+	}
+	if info.Level != 26 || info.GameCount != 224 {
+		t.Errorf("level, games = %d, %d; want 26, 224", info.Level, info.GameCount)
+	}
+
+	if _, err := client.GetSteamUserInfo(ctx, "nobody-has-this-name"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrNotFound", err)
+	}
+
+	// A rejected key is a failure of its own, not a missing user
+	_, wrongKey := startFakeUpstream(t, WithAPIKey("wrong-key"))
+	_, err = wrongKey.GetSteamUserInfo(ctx, "gabelogannewell")
+	var httpErr *utils.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != 403 || errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong key: err = %v, want a 403", err)
+	}
+}
+
+func TestGetCheapSharkDealsAgainstFakeAPI(t *testing.T) {
+	history, err := store.NewPriceHistory("", store.HistoryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, client := startFakeUpstream(t, WithPriceHistory(history))
+
+	deals, err := client.GetCheapSharkDeals(context.Background(), DefaultDealFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var titles []string
+	for _, deal := range deals {
+		titles = append(titles, deal.Title)
+	}
+	// Steam deals up to $30, in CheapShark's order
+	want := []string{"Portal 2", "Portal", "Untitled Goose Game"}
+	if !slices.Equal(titles, want) {
+		t.Errorf("titles = %q, want %q", titles, want)
+	}
+
+	// Deals for Steam apps are recorded as US prices
+	if regions := history.Regions("620"); !slices.Equal(regions, []string{cheapSharkRegion}) {
+		t.Errorf("recorded regions for 620 = %q, want %q", regions, cheapSharkRegion)
+	}
+
+	// Other stores' deals stay out of the Steam price series
+	allStores := DefaultDealFilter
+	allStores.StoreIDs = nil
+	allStores.MaxPrice = 0
+	if _, err := client.GetCheapSharkDeals(context.Background(), allStores); err != nil {
+		t.Fatal(err)
+	}
+	if regions := history.Regions("292030"); len(regions) != 0 {
+		t.Errorf("recorded regions for the GOG deal = %q, want none", regions)
+	}
+	if regions := history.Regions("837470"); !slices.Equal(regions, []string{cheapSharkRegion}) {
+		t.Errorf("recorded regions for 837470 = %q, want %q", regions, cheapSharkRegion)
+	}
+
+	srv.Fail("/api/1.0/deals", 503)
+	if _, err := client.GetCheapSharkDeals(context.Background(), DefaultDealFilter); !errors.Is(err, ErrUpstreamDown) {
+		t.Errorf("err = %v, want ErrUpstreamDown", err)
+	}
+}
+
+func TestGetCheapSharkDealsForServesNarrowFilters(t *testing.T) {
+	srv, client := startFakeUpstream(t)
+
+	// The broad filter's page holds no Hollow Knight (store 25) deal
+	broad := DealFilter{PageSize: 3}
+	narrow := DealFilter{StoreIDs: []string{"25"}, PageSize: 1}
+
+	deals, err := client.GetCheapSharkDealsFor(context.Background(), broad, narrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var matched []string
+	for _, deal := range deals {
+		if narrow.Match(deal) && narrow.queryAccepts(deal) {
+			matched = append(matched, deal.Title)
+		}
+	}
+	if !slices.Equal(matched, []string{"Hollow Knight"}) {
+		t.Errorf("narrow filter got %q, want the deal its own query returns", matched)
+	}
+	if n := srv.Requests("/api/1.0/deals"); n != 2 {
+		t.Errorf("fetched %d pages, want 2", n)
+	}
+}
+
+func TestGetCheapSharkDealsForStopsWhenServed(t *testing.T) {
+	srv, client := startFakeUpstream(t)
+
+	deals, err := client.GetCheapSharkDealsFor(context.Background(), DealFilter{StoreIDs: []string{"1"}, PageSize: 2}, DealFilter{StoreIDs: []string{"1"}, PageSize: 1, MaxPrice: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deals) != 3 || srv.Requests("/api/1.0/deals") != 1 {
+		t.Errorf("got %d deals in %d pages, want 3 in 1", len(deals), srv.Requests("/api/1.0/deals"))
+	}
+}
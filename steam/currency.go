@@ -0,0 +1,47 @@
+package steam
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"steam_bot/tracing"
+)
+
+// exchangeRatesResponse is the open.er-api.com latest-rates payload
+type exchangeRatesResponse struct {
+	Result   string             `json:"result"`
+	BaseCode string             `json:"base_code"`
+	Rates    map[string]float64 `json:"rates"`
+}
+
+// GetExchangeRates returns how many units of each currency one unit of base buys (cached)
+func (c *Client) GetExchangeRates(ctx context.Context, base string) (_ map[string]float64, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetExchangeRates", tracing.String("currency", base))
+	defer func() { span.Finish(err) }()
+
+	base = strings.ToUpper(base)
+	return c.caches.exchangeRates.GetOrFetchContext(ctx, base, func(ctx context.Context) (map[string]float64, error) {
+		apiURL := c.exchangeRatesURL + "/v6/latest/" + url.PathEscape(base)
+
+		var response exchangeRatesResponse
+		if err := c.http.GetJSON(ctx, apiURL, &response); err != nil {
+			return nil, fmt.Errorf("fetching exchange rates: %w", err)
+		}
+		if response.Result != "success" || len(response.Rates) == 0 {
+			return nil, fmt.Errorf("no exchange rates for %s", base)
+		}
+
+		return response.Rates, nil
+	})
+}
+
+// ConvertCurrency converts amount from one currency into base using rates from GetExchangeRates(base)
+func ConvertCurrency(amount float64, from string, rates map[string]float64) (float64, bool) {
+	rate, ok := rates[strings.ToUpper(from)]
+	if !ok || rate == 0 {
+		return 0, false
+	}
+	return amount / rate, true
+}
@@ -0,0 +1,216 @@
+package steam
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// steamRatingTiers orders CheapShark's steamRatingText values from worst to best
+var steamRatingTiers = []string{
+	"Overwhelmingly Negative",
+	"Very Negative",
+	"Negative",
+	"Mostly Negative",
+	"Mixed",
+	"Mostly Positive",
+	"Positive",
+	"Very Positive",
+	"Overwhelmingly Positive",
+}
+
+// steamRatingRank returns the position of a rating text in steamRatingTiers, or -1 if unknown
+func steamRatingRank(rating string) int {
+	for i, tier := range steamRatingTiers {
+		if strings.EqualFold(tier, rating) {
+			return i
+		}
+	}
+	return -1
+}
+
+// DealFilter describes which CheapShark deals are worth posting.
+// Zero values disable the corresponding check. AAAOnly follows CheapShark's own AAA
+// definition (retail price above $29) so it can be sent as the API's AAA flag;
+// dealRating measures how good a deal is, not whether the game is AAA, and is
+// filtered on by MinDealRating.
+type DealFilter struct {
+	StoreIDs       []string `json:"store_ids,omitempty"`        // CheapShark store IDs to query (empty = all stores)
+	PageSize       int      `json:"page_size,omitempty"`        // number of deals requested per poll
+	MinSavings     float64  `json:"min_savings,omitempty"`      // minimum discount in percent
+	MinPrice       float64  `json:"min_price,omitempty"`        // minimum sale price in USD
+	MaxPrice       float64  `json:"max_price,omitempty"`        // maximum sale price in USD
+	MinMetacritic  int      `json:"min_metacritic,omitempty"`   // minimum Metacritic score
+	MinSteamRating string   `json:"min_steam_rating,omitempty"` // minimum steamRatingText tier, e.g. "Very Positive"
+	MinDealRating  float64  `json:"min_deal_rating,omitempty"`  // minimum CheapShark deal rating (0-10)
+	AAAOnly        bool     `json:"aaa_only,omitempty"`         // only deals with a retail price above $29, as CheapShark's AAA flag
+	ExcludedTitles []string `json:"excluded_titles,omitempty"`  // case-insensitive title substrings to skip
+	ExcludedAppIDs []string `json:"excluded_app_ids,omitempty"` // Steam app IDs to skip
+}
+
+// DefaultDealFilter matches the bot's historical behaviour: Steam deals up to $30
+var DefaultDealFilter = DealFilter{
+	StoreIDs: []string{"1"},
+	PageSize: 10,
+	MaxPrice: 30,
+}
+
+// Validate reports filter settings that would silently disable a check
+func (f DealFilter) Validate() error {
+	if f.MinSteamRating != "" && steamRatingRank(f.MinSteamRating) < 0 {
+		return fmt.Errorf("unknown min_steam_rating %q (expected one of %s)", f.MinSteamRating, strings.Join(steamRatingTiers, ", "))
+	}
+	return nil
+}
+
+// Query builds the CheapShark /deals query parameters for the filter.
+// Checks the API cannot express are left to Match.
+func (f DealFilter) Query() url.Values {
+	q := url.Values{}
+
+	if len(f.StoreIDs) > 0 {
+		q.Set("storeID", strings.Join(f.StoreIDs, ","))
+	}
+	if f.PageSize > 0 {
+		q.Set("pageSize", strconv.Itoa(f.PageSize))
+	}
+	if f.MinPrice > 0 {
+		q.Set("lowerPrice", formatFloat(f.MinPrice))
+	}
+	if f.MaxPrice > 0 {
+		q.Set("upperPrice", formatFloat(f.MaxPrice))
+	}
+	if f.MinMetacritic > 0 {
+		q.Set("metacritic", strconv.Itoa(f.MinMetacritic))
+	}
+	if f.AAAOnly {
+		q.Set("AAA", "1")
+	}
+
+	return q
+}
+
+// Match reports whether a deal passes every configured check
+func (f DealFilter) Match(deal CheapSharkDeal) bool {
+	if f.MinSavings > 0 && parseFloat(deal.Savings) < f.MinSavings {
+		return false
+	}
+
+	salePrice := parseFloat(deal.SalePrice)
+	if f.MinPrice > 0 && salePrice < f.MinPrice {
+		return false
+	}
+	if f.MaxPrice > 0 && salePrice > f.MaxPrice {
+		return false
+	}
+
+	if f.MinMetacritic > 0 && int(parseFloat(deal.Metacritic)) < f.MinMetacritic {
+		return false
+	}
+
+	if f.MinSteamRating != "" && steamRatingRank(deal.SteamRating) < steamRatingRank(f.MinSteamRating) {
+		return false
+	}
+
+	if f.MinDealRating > 0 && parseFloat(deal.DealRating) < f.MinDealRating {
+		return false
+	}
+
+	if f.AAAOnly && parseFloat(deal.NormalPrice) <= 29 {
+		return false
+	}
+
+	for _, appID := range f.ExcludedAppIDs {
+		if deal.SteamAppID == appID {
+			return false
+		}
+	}
+
+	title := strings.ToLower(deal.Title)
+	for _, excluded := range f.ExcludedTitles {
+		if excluded != "" && strings.Contains(title, strings.ToLower(excluded)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// maxDealsPageSize is the largest pageSize CheapShark accepts
+const maxDealsPageSize = 60
+
+// queryAccepts reports whether a deal passes the checks Query sends to CheapShark,
+// i.e. whether the filter's own query could return it
+func (f DealFilter) queryAccepts(deal CheapSharkDeal) bool {
+	if len(f.StoreIDs) > 0 && !slices.Contains(f.StoreIDs, deal.StoreID) {
+		return false
+	}
+	api := DealFilter{MinPrice: f.MinPrice, MaxPrice: f.MaxPrice, MinMetacritic: f.MinMetacritic, AAAOnly: f.AAAOnly}
+	return api.Match(deal)
+}
+
+// MergeDealFilters returns a single query for the given filters: every deal any of
+// their own queries would return matches it, in the same order. Its page size is
+// capped by CheapShark, though, so one page may hold fewer of a narrow filter's
+// deals than the filter's own query would return; GetCheapSharkDealsFor fetches
+// further pages for such filters. Callers apply each filter's Match on the result.
+func MergeDealFilters(filters ...DealFilter) DealFilter {
+	if len(filters) == 0 {
+		return DefaultDealFilter
+	}
+
+	merged := DealFilter{
+		MinPrice:      filters[0].MinPrice,
+		MaxPrice:      filters[0].MaxPrice,
+		MinMetacritic: filters[0].MinMetacritic,
+		AAAOnly:       true,
+	}
+
+	stores := make(map[string]bool)
+	allStores := false
+
+	for _, f := range filters {
+		if len(f.StoreIDs) == 0 {
+			allStores = true
+		}
+		for _, id := range f.StoreIDs {
+			if !stores[id] {
+				stores[id] = true
+				merged.StoreIDs = append(merged.StoreIDs, id)
+			}
+		}
+
+		if f.PageSize == 0 {
+			// CheapShark's default page is the maximum, capped below
+			merged.PageSize += maxDealsPageSize
+		} else {
+			merged.PageSize += f.PageSize
+		}
+		merged.MinPrice = min(merged.MinPrice, f.MinPrice)
+		merged.MinMetacritic = min(merged.MinMetacritic, f.MinMetacritic)
+		if f.MaxPrice == 0 || merged.MaxPrice == 0 {
+			merged.MaxPrice = 0
+		} else {
+			merged.MaxPrice = max(merged.MaxPrice, f.MaxPrice)
+		}
+		merged.AAAOnly = merged.AAAOnly && f.AAAOnly
+	}
+
+	if allStores {
+		merged.StoreIDs = nil
+	}
+	merged.PageSize = min(merged.PageSize, maxDealsPageSize)
+
+	return merged
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
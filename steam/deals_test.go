@@ -0,0 +1,182 @@
+package steam
+
+import (
+	"net/url"
+	"testing"
+)
+
+// portal2Deal is a deal as CheapShark reports it
+var portal2Deal = CheapSharkDeal{
+	Title:       "Portal 2",
+	DealID:      "portal2",
+	StoreID:     "1",
+	SalePrice:   "0.99",
+	NormalPrice: "9.99",
+	Savings:     "90.090090",
+	Metacritic:  "95",
+	SteamRating: "Overwhelmingly Positive",
+	SteamAppID:  "620",
+	DealRating:  "9.4",
+}
+
+func TestDealFilterMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter DealFilter
+		want   bool
+	}{
+		{"zero filter", DealFilter{}, true},
+		{"default filter", DefaultDealFilter, true},
+		{"savings met", DealFilter{MinSavings: 90}, true},
+		{"savings missed", DealFilter{MinSavings: 95}, false},
+		{"price in range", DealFilter{MinPrice: 0.99, MaxPrice: 0.99}, true},
+		{"price below min", DealFilter{MinPrice: 1}, false},
+		{"price above max", DealFilter{MaxPrice: 0.5}, false},
+		{"metacritic met", DealFilter{MinMetacritic: 95}, true},
+		{"metacritic missed", DealFilter{MinMetacritic: 96}, false},
+		{"rating tier below", DealFilter{MinSteamRating: "Very Positive"}, true},
+		{"rating tier equal, any case", DealFilter{MinSteamRating: "overwhelmingly positive"}, true},
+		{"deal rating met", DealFilter{MinDealRating: 9.4}, true},
+		{"deal rating missed", DealFilter{MinDealRating: 9.5}, false},
+		{"AAA retail price", DealFilter{AAAOnly: true}, false},
+		{"excluded app", DealFilter{ExcludedAppIDs: []string{"400", "620"}}, false},
+		{"excluded title, any case", DealFilter{ExcludedTitles: []string{"portal"}}, false},
+		{"empty excluded title", DealFilter{ExcludedTitles: []string{""}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(portal2Deal); got != tt.want {
+				t.Errorf("Match = %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	// A deal rated below the tier fails it
+	mixed := portal2Deal
+	mixed.SteamRating = "Mixed"
+	if (DealFilter{MinSteamRating: "Mostly Positive"}).Match(mixed) {
+		t.Error("Mixed deal matched a Mostly Positive minimum")
+	}
+
+	// AAA is decided by the retail price
+	aaa := portal2Deal
+	aaa.NormalPrice = "59.99"
+	if !(DealFilter{AAAOnly: true}).Match(aaa) {
+		t.Error("$59.99 deal did not match AAAOnly")
+	}
+}
+
+func TestDealFilterQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter DealFilter
+		want   url.Values
+	}{
+		{"zero filter", DealFilter{}, url.Values{}},
+		{"default filter", DefaultDealFilter, url.Values{
+			"storeID": {"1"}, "pageSize": {"10"}, "upperPrice": {"30"},
+		}},
+		{"every API parameter", DealFilter{
+			StoreIDs:      []string{"1", "7"},
+			PageSize:      60,
+			MinPrice:      2.5,
+			MaxPrice:      20,
+			MinMetacritic: 80,
+			AAAOnly:       true,
+		}, url.Values{
+			"storeID": {"1,7"}, "pageSize": {"60"}, "lowerPrice": {"2.5"}, "upperPrice": {"20"}, "metacritic": {"80"}, "AAA": {"1"},
+		}},
+		{"checks only Match applies", DealFilter{
+			MinSavings:     50,
+			MinSteamRating: "Positive",
+			MinDealRating:  8,
+			ExcludedTitles: []string{"Portal"},
+			ExcludedAppIDs: []string{"620"},
+		}, url.Values{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Query(); got.Encode() != tt.want.Encode() {
+				t.Errorf("Query = %s, want %s", got.Encode(), tt.want.Encode())
+			}
+		})
+	}
+}
+
+func TestDealFilterValidate(t *testing.T) {
+	for _, rating := range []string{"", "Very Positive", "mixed"} {
+		if err := (DealFilter{MinSteamRating: rating}).Validate(); err != nil {
+			t.Errorf("Validate(%q) = %v, want nil", rating, err)
+		}
+	}
+	for _, rating := range []string{"Very Postive", "very positive ", "good"} {
+		if err := (DealFilter{MinSteamRating: rating}).Validate(); err == nil {
+			t.Errorf("Validate(%q) = nil, want an error", rating)
+		}
+	}
+}
+
+func TestMergeDealFilters(t *testing.T) {
+	budget := DealFilter{StoreIDs: []string{"1", "7"}, PageSize: 10, MaxPrice: 5, MinSavings: 75}
+	aaa := DealFilter{StoreIDs: []string{"1"}, PageSize: 20, MinPrice: 10, MinMetacritic: 80, AAAOnly: true}
+
+	tests := []struct {
+		name    string
+		filters []DealFilter
+		want    DealFilter
+	}{
+		{"no filters", nil, DefaultDealFilter},
+		{"one filter keeps its API parameters", []DealFilter{aaa},
+			DealFilter{StoreIDs: []string{"1"}, PageSize: 20, MinPrice: 10, MinMetacritic: 80, AAAOnly: true}},
+		{"stores are combined, pages added", []DealFilter{budget, aaa},
+			DealFilter{StoreIDs: []string{"1", "7"}, PageSize: 30}},
+		{"any filter without stores queries all", []DealFilter{budget, {PageSize: 5, MaxPrice: 3}},
+			DealFilter{PageSize: 15, MaxPrice: 5}},
+		{"price range widens", []DealFilter{{MinPrice: 5, MaxPrice: 10, PageSize: 1}, {MinPrice: 2, MaxPrice: 20, PageSize: 1}},
+			DealFilter{MinPrice: 2, MaxPrice: 20, PageSize: 2}},
+		{"AAA only if every filter is", []DealFilter{aaa, {AAAOnly: true, MinMetacritic: 70, PageSize: 1}},
+			DealFilter{MinMetacritic: 70, AAAOnly: true, PageSize: 21}},
+		{"default page size takes the maximum", []DealFilter{budget, {StoreIDs: []string{"1"}}},
+			DealFilter{StoreIDs: []string{"1", "7"}, PageSize: maxDealsPageSize}},
+		{"default page size first", []DealFilter{{StoreIDs: []string{"1"}}, budget},
+			DealFilter{StoreIDs: []string{"1", "7"}, PageSize: maxDealsPageSize}},
+		{"pages are capped", []DealFilter{{PageSize: 40}, {PageSize: 40}},
+			DealFilter{PageSize: maxDealsPageSize}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeDealFilters(tt.filters...)
+			if got.Query().Encode() != tt.want.Query().Encode() {
+				t.Errorf("merged query = %s, want %s", got.Query().Encode(), tt.want.Query().Encode())
+			}
+		})
+	}
+}
+
+// TestMergeDealFiltersFetchesEveryAcceptedDeal checks the merged query returns every
+// deal a filter's own query would, for filters whose checks the API can express
+func TestMergeDealFiltersFetchesEveryAcceptedDeal(t *testing.T) {
+	deals := []CheapSharkDeal{
+		portal2Deal,
+		{DealID: "witcher", StoreID: "7", SalePrice: "7.99", NormalPrice: "39.99", Metacritic: "92"},
+		{DealID: "goose", StoreID: "1", SalePrice: "4.99", NormalPrice: "19.99", Metacritic: "80"},
+		{DealID: "eldenring", StoreID: "1", SalePrice: "35.99", NormalPrice: "59.99", Metacritic: "94"},
+	}
+	filters := []DealFilter{
+		{StoreIDs: []string{"1"}, MaxPrice: 5},
+		{StoreIDs: []string{"7"}, MinPrice: 5, MinMetacritic: 90},
+		{StoreIDs: []string{"1"}, AAAOnly: true, MinMetacritic: 90},
+	}
+	merged := MergeDealFilters(filters...)
+
+	for _, deal := range deals {
+		for _, f := range filters {
+			if f.queryAccepts(deal) && !merged.queryAccepts(deal) {
+				t.Errorf("deal %s passes %+v but not the merged query %+v", deal.DealID, f, merged)
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package steam
+
+import "steam_bot/utils"
+
+// Error kinds returned by the API functions, matched with errors.Is
+var (
+	ErrRateLimited  = utils.ErrRateLimited
+	ErrNotFound     = utils.ErrNotFound
+	ErrUpstreamDown = utils.ErrUpstreamDown
+)
@@ -0,0 +1,103 @@
+package steam
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"steam_bot/tracing"
+)
+
+// ----- CheapShark Game Types -----
+
+// CheapSharkGameSummary is a game search result from CheapShark's /games endpoint
+type CheapSharkGameSummary struct {
+	GameID         string `json:"gameID"`
+	SteamAppID     string `json:"steamAppID"`
+	Cheapest       string `json:"cheapest"`
+	CheapestDealID string `json:"cheapestDealID"`
+	External       string `json:"external"`
+	Thumb          string `json:"thumb"`
+}
+
+// CheapSharkGameDeal is one store's current offer for a game
+type CheapSharkGameDeal struct {
+	StoreID     string `json:"storeID"`
+	DealID      string `json:"dealID"`
+	Price       string `json:"price"`
+	RetailPrice string `json:"retailPrice"`
+	Savings     string `json:"savings"`
+}
+
+// CheapSharkGame holds current offers and the all-time low for a game
+type CheapSharkGame struct {
+	GameID string `json:"-"`
+	Info   struct {
+		Title      string `json:"title"`
+		SteamAppID string `json:"steamAppID"`
+		Thumb      string `json:"thumb"`
+	} `json:"info"`
+	CheapestPriceEver struct {
+		Price string `json:"price"`
+		Date  int64  `json:"date"`
+	} `json:"cheapestPriceEver"`
+	Deals []CheapSharkGameDeal `json:"deals"`
+}
+
+// CheapestDeal returns the lowest-priced current offer
+func (g *CheapSharkGame) CheapestDeal() (CheapSharkGameDeal, bool) {
+	if len(g.Deals) == 0 {
+		return CheapSharkGameDeal{}, false
+	}
+
+	cheapest := g.Deals[0]
+	for _, deal := range g.Deals[1:] {
+		if parseFloat(deal.Price) < parseFloat(cheapest.Price) {
+			cheapest = deal
+		}
+	}
+	return cheapest, true
+}
+
+// HistoricalLow returns the all-time lowest price in USD
+func (g *CheapSharkGame) HistoricalLow() float64 {
+	return parseFloat(g.CheapestPriceEver.Price)
+}
+
+// ----- CheapShark Game API Functions -----
+
+// FindCheapSharkGameID returns CheapShark's game ID for a Steam app
+func (c *Client) FindCheapSharkGameID(ctx context.Context, steamAppID string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "steam.FindCheapSharkGameID", tracing.String("app_id", steamAppID))
+	defer func() { span.Finish(err) }()
+
+	apiURL := c.cheapSharkURL + "/api/1.0/games?steamAppID=" + url.QueryEscape(steamAppID)
+
+	var results []CheapSharkGameSummary
+	if err := c.http.GetJSON(ctx, apiURL, &results); err != nil {
+		return "", fmt.Errorf("looking up game: %w", err)
+	}
+
+	for _, r := range results {
+		if r.SteamAppID == steamAppID {
+			return r.GameID, nil
+		}
+	}
+	return "", fmt.Errorf("no CheapShark game found for appID %s: %w", steamAppID, ErrNotFound)
+}
+
+// GetCheapSharkGame fetches current offers and price history for a CheapShark game ID
+func (c *Client) GetCheapSharkGame(ctx context.Context, gameID string) (_ *CheapSharkGame, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetCheapSharkGame", tracing.String("game_id", gameID))
+	defer func() { span.Finish(err) }()
+
+	apiURL := c.cheapSharkURL + "/api/1.0/games?id=" + url.QueryEscape(gameID)
+
+	var game CheapSharkGame
+	if err := c.http.GetJSON(ctx, apiURL, &game); err != nil {
+		return nil, fmt.Errorf("fetching game %s: %w", gameID, err)
+	}
+	game.GameID = gameID
+
+	return &game, nil
+}
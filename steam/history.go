@@ -0,0 +1,61 @@
+package steam
+
+import (
+	"log/slog"
+	"time"
+
+	"steam_bot/logattr"
+	"steam_bot/store"
+	"steam_bot/utils"
+)
+
+// cheapSharkRegion is the region CheapShark prices (USD) are recorded under
+const cheapSharkRegion = "us"
+
+// steamStoreID is CheapShark's ID for the Steam store
+const steamStoreID = "1"
+
+// recordSteamPrice stores a price_overview from a Steam appdetails response
+func (c *Client) recordSteamPrice(appID, region string, p PriceOverview) {
+	if c.history == nil || p.Final <= 0 {
+		return
+	}
+
+	err := c.history.Record(appID, region, store.PricePoint{
+		Time:     time.Now(),
+		Price:    float64(p.Final) / 100,
+		Regular:  float64(p.Initial) / 100,
+		Currency: p.Currency,
+		Discount: p.DiscountPercent,
+	})
+	if err != nil {
+		slog.Error("Error recording price history", utils.LogKeyAppID, appID, "region", region, logattr.Error(err))
+	}
+}
+
+// recordDealPrices stores the USD prices of CheapShark's Steam deals. Other stores'
+// prices for the same app would skew the Steam series, so they are skipped.
+func (c *Client) recordDealPrices(deals []CheapSharkDeal) {
+	if c.history == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, deal := range deals {
+		if deal.StoreID != steamStoreID || deal.SteamAppID == "" {
+			continue
+		}
+
+		err := c.history.Record(deal.SteamAppID, cheapSharkRegion, store.PricePoint{
+			Time:     now,
+			Price:    parseFloat(deal.SalePrice),
+			Regular:  parseFloat(deal.NormalPrice),
+			Currency: "USD",
+			Discount: int(parseFloat(deal.Savings)),
+		})
+		if err != nil {
+			slog.Error("Error recording price history", utils.LogKeyAppID, deal.SteamAppID, "region", cheapSharkRegion, logattr.Error(err))
+			return
+		}
+	}
+}
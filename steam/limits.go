@@ -0,0 +1,22 @@
+package steam
+
+import "steam_bot/utils"
+
+// ----- Upstream Rate Limits -----
+
+// Limiters shared by every Client that keeps the defaults, one per upstream. Background
+// jobs mark their contexts with utils.WithPriority so interactive requests go first.
+var (
+	// The storefront throttles appdetails at roughly 200 requests per 5 minutes
+	steamStoreLimiter  = utils.NewLimiter(200.0/300, 20)
+	steamWebAPILimiter = utils.NewLimiter(1, 10)
+	cheapSharkLimiter  = utils.NewLimiter(1, 5)
+	hltbLimiter        = utils.NewLimiter(0.5, 3)
+)
+
+// httpClient is the default for clients created without WithHTTPClient
+var httpClient = utils.NewClient(
+	utils.WithRateLimit("store.steampowered.com", steamStoreLimiter),
+	utils.WithRateLimit("api.steampowered.com", steamWebAPILimiter),
+	utils.WithRateLimit("www.cheapshark.com", cheapSharkLimiter),
+)
@@ -0,0 +1,105 @@
+package steam
+
+import "time"
+
+// ----- Cache Bookkeeping -----
+
+// cacheNode is a TTLCache entry linked into both the recency list and the expiry heap
+type cacheNode[K comparable, V any] struct {
+	key   K
+	entry *CacheEntry[V]
+	hits  int32 // lookups that found entry fresh, for refresh-ahead
+
+	prev, next *cacheNode[K, V]
+	heapIndex  int
+}
+
+// cacheList is an intrusive doubly linked list of nodes, most recently used first
+type cacheList[K comparable, V any] struct {
+	root cacheNode[K, V] // sentinel; root.next is the head, root.prev the tail
+	len  int
+}
+
+func (l *cacheList[K, V]) init() {
+	l.root.next = &l.root
+	l.root.prev = &l.root
+	l.len = 0
+}
+
+// pushFront inserts n at the head of the list
+func (l *cacheList[K, V]) pushFront(n *cacheNode[K, V]) {
+	n.prev = &l.root
+	n.next = l.root.next
+	l.root.next.prev = n
+	l.root.next = n
+	l.len++
+}
+
+// remove unlinks n from the list
+func (l *cacheList[K, V]) remove(n *cacheNode[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	n.prev, n.next = nil, nil
+	l.len--
+}
+
+// moveToFront marks n as the most recently used node
+func (l *cacheList[K, V]) moveToFront(n *cacheNode[K, V]) {
+	if l.root.next == n {
+		return
+	}
+	l.remove(n)
+	l.pushFront(n)
+}
+
+// back returns the least recently used node, or nil if the list is empty
+func (l *cacheList[K, V]) back() *cacheNode[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+// expiryHeap orders nodes by expiry, soonest first (implements heap.Interface)
+type expiryHeap[K comparable, V any] []*cacheNode[K, V]
+
+func (h expiryHeap[K, V]) Len() int { return len(h) }
+
+func (h expiryHeap[K, V]) Less(i, j int) bool {
+	return h[i].entry.ExpiresAt.Before(h[j].entry.ExpiresAt)
+}
+
+func (h expiryHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *expiryHeap[K, V]) Push(x any) {
+	n := x.(*cacheNode[K, V])
+	n.heapIndex = len(*h)
+	*h = append(*h, n)
+}
+
+func (h *expiryHeap[K, V]) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	old[len(old)-1] = nil
+	n.heapIndex = -1
+	*h = old[:len(old)-1]
+	return n
+}
+
+// peek returns the node expiring soonest, or nil if the heap is empty
+func (h expiryHeap[K, V]) peek() *cacheNode[K, V] {
+	if len(h) == 0 {
+		return nil
+	}
+	return h[0]
+}
+
+// expiredBefore reports whether the soonest-expiring node expired before t
+func (h expiryHeap[K, V]) expiredBefore(t time.Time) bool {
+	n := h.peek()
+	return n != nil && n.entry.ExpiresAt.Before(t)
+}
@@ -0,0 +1,263 @@
+package steam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"steam_bot/logattr"
+	"steam_bot/utils"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redisOpTimeout bounds each Redis round trip; a slow cache is treated as a miss
+const redisOpTimeout = 2 * time.Second
+
+// redisSizeInterval is how often Size recounts the keys under a cache's prefix.
+// Counting scans every one of them, so it isn't done on each metrics scrape.
+const redisSizeInterval = 5 * time.Minute
+
+// ----- Redis Cache -----
+
+// RedisCache is a cache stored in Redis, so bot instances share entries and keep
+// them across restarts. Values are stored as JSON. Redis errors are logged and
+// treated as misses, so an unreachable Redis only costs upstream requests; while
+// it is down the client fails fast instead of waiting out redisOpTimeout.
+type RedisCache[K comparable, V any] struct {
+	client   *utils.RedisClient
+	prefix   string // prepended to every key
+	settings cacheSettings
+	stats    cacheCounters
+	loader   *cacheLoader[K, V]
+
+	sizeMu    sync.Mutex
+	size      int       // entries at the last count
+	countedAt time.Time // when size was last counted
+	counting  bool
+}
+
+// redisEntry is the stored form of a cache entry
+type redisEntry[V any] struct {
+	Data      V         `json:"data"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewRedisCache creates a cache storing its entries under keys starting with prefix.
+// WithMaxSize is ignored; Redis' own eviction policy applies.
+func NewRedisCache[K comparable, V any](client *utils.RedisClient, prefix string, opts ...CacheOption[K, V]) *RedisCache[K, V] {
+	cache := &RedisCache[K, V]{
+		client:   client,
+		prefix:   prefix,
+		settings: defaultCacheSettings(),
+	}
+	cache.loader = newCacheLoader(&cache.settings, &cache.stats, cache.lookup, cache.Set)
+
+	for _, opt := range opts {
+		opt(&cache.settings)
+	}
+
+	return cache
+}
+
+func (c *RedisCache[K, V]) key(key K) string {
+	return c.prefix + cacheKeyString(key)
+}
+
+// Get retrieves a value from the cache. Returns the value and true if found and not expired.
+func (c *RedisCache[K, V]) Get(key K) (V, bool) {
+	now := time.Now()
+	entry, _ := c.lookup(key, now)
+	if entry == nil || now.After(entry.ExpiresAt) {
+		c.stats.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+
+	c.stats.hits.Add(1)
+	return entry.Data, true
+}
+
+// Name returns the name set with WithName
+func (c *RedisCache[K, V]) Name() string {
+	return c.settings.name
+}
+
+// Stats returns this process's counters for the cache. Redis evicts and expires
+// keys itself, so Evictions and Expirations stay at zero.
+func (c *RedisCache[K, V]) Stats() CacheStats {
+	return c.stats.snapshot()
+}
+
+// lookup returns the stored entry for key, fresh or within its stale retention.
+// Lookups aren't counted per entry, so refresh-ahead never applies to Redis caches.
+func (c *RedisCache[K, V]) lookup(key K, now time.Time) (*CacheEntry[V], int32) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	data, ok, err := c.client.Get(ctx, c.key(key))
+	if err != nil {
+		logRedisError("Error reading cache entry", "key", c.key(key), err)
+		return nil, 0
+	}
+	if !ok {
+		return nil, 0
+	}
+
+	var stored redisEntry[V]
+	if err := json.Unmarshal(data, &stored); err != nil {
+		slog.Error("Error decoding cache entry", "key", c.key(key), logattr.Error(err))
+		return nil, 0
+	}
+	if now.After(stored.ExpiresAt.Add(c.settings.retention())) {
+		return nil, 0
+	}
+
+	return &CacheEntry[V]{Data: stored.Data, ExpiresAt: stored.ExpiresAt}, 0
+}
+
+// Set stores a value in the cache with the configured TTL. Redis keeps it for the
+// stale retention on top of that.
+func (c *RedisCache[K, V]) Set(key K, value V) {
+	c.loader.forget(key)
+
+	// Keep markup such as pc_requirements byte-for-byte instead of \u003c-escaping it
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(redisEntry[V]{Data: value, ExpiresAt: time.Now().Add(c.settings.ttl)}); err != nil {
+		slog.Error("Error encoding cache entry", "key", c.key(key), logattr.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	if err := c.client.Set(ctx, c.key(key), buf.Bytes(), c.settings.ttl+c.settings.retention()); err != nil {
+		logRedisError("Error writing cache entry", "key", c.key(key), err)
+	}
+}
+
+// Delete removes key from the cache and reports whether it was cached
+func (c *RedisCache[K, V]) Delete(key K) bool {
+	c.loader.forget(key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	n, err := c.client.Del(ctx, c.key(key))
+	if err != nil {
+		logRedisError("Error deleting cache entry", "key", c.key(key), err)
+	}
+	return n > 0
+}
+
+// DeletePrefix removes every entry whose key, rendered as a string, starts with
+// prefix, along with the errors this process cached for such keys
+func (c *RedisCache[K, V]) DeletePrefix(prefix string) int {
+	c.loader.forgetPrefix(prefix)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	removed := 0
+	err := c.client.Scan(ctx, c.prefix+redisGlobEscaper.Replace(prefix)+"*", func(keys []string) error {
+		n, err := c.client.Del(ctx, keys...)
+		removed += int(n)
+		return err
+	})
+	if err != nil {
+		logRedisError("Error deleting cache entries", "pattern", c.prefix+prefix+"*", err)
+	}
+
+	c.sizeMu.Lock()
+	c.size = max(c.size-removed, 0)
+	c.sizeMu.Unlock()
+	return removed
+}
+
+// redisGlobEscaper escapes the characters SCAN MATCH treats as wildcards
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// GetOrFetch attempts to get from cache, or fetches using the provided function.
+// Concurrent calls for the same key in this process share a single fetch.
+func (c *RedisCache[K, V]) GetOrFetch(key K, fetch func() (V, error)) (V, error) {
+	return c.GetOrFetchContext(context.Background(), key, func(context.Context) (V, error) {
+		return fetch()
+	})
+}
+
+// GetOrFetchContext is GetOrFetch with a context-aware fetch function
+func (c *RedisCache[K, V]) GetOrFetchContext(ctx context.Context, key K, fetch func(context.Context) (V, error)) (V, error) {
+	return c.loader.getOrFetch(ctx, key, fetch)
+}
+
+// Size returns the number of entries stored under the cache's prefix as of the last
+// count, which is refreshed in the background at most every redisSizeInterval. It is
+// 0 until the first count finishes.
+func (c *RedisCache[K, V]) Size() int {
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+
+	if !c.counting && time.Since(c.countedAt) >= redisSizeInterval {
+		c.counting = true
+		go c.countEntries()
+	}
+	return c.size
+}
+
+// countEntries scans the keys under the cache's prefix to update Size
+func (c *RedisCache[K, V]) countEntries() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	size := 0
+	err := c.client.Scan(ctx, c.prefix+"*", func(keys []string) error {
+		size += len(keys)
+		return nil
+	})
+
+	c.sizeMu.Lock()
+	defer c.sizeMu.Unlock()
+
+	// A failed count isn't retried before the next interval either
+	c.counting = false
+	c.countedAt = time.Now()
+	if err != nil {
+		logRedisError("Error counting cache entries", "pattern", c.prefix+"*", err)
+		return
+	}
+	c.size = size
+}
+
+// Clear removes all entries stored under the cache's prefix
+func (c *RedisCache[K, V]) Clear() {
+	c.loader.clear()
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	err := c.client.Scan(ctx, c.prefix+"*", func(keys []string) error {
+		_, err := c.client.Del(ctx, keys...)
+		return err
+	})
+	if err != nil {
+		logRedisError("Error clearing cache entries", "pattern", c.prefix+"*", err)
+		return
+	}
+
+	c.sizeMu.Lock()
+	c.size = 0
+	c.sizeMu.Unlock()
+}
+
+// logRedisError logs a failed cache operation. Operations skipped while Redis is
+// known to be down aren't logged; the client reports the outage once.
+func logRedisError(msg, attr, value string, err error) {
+	if errors.Is(err, utils.ErrRedisUnavailable) {
+		return
+	}
+	slog.Error(msg, attr, value, logattr.Error(err))
+}
@@ -0,0 +1,178 @@
+package steam
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"steam_bot/internal/fakeredis"
+	"steam_bot/utils"
+)
+
+func startFakeRedis(t *testing.T) (*fakeredis.Server, *utils.RedisClient) {
+	t.Helper()
+
+	srv, err := fakeredis.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	client, err := utils.NewRedisClient(srv.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return srv, client
+}
+
+func TestRedisCacheRoundTripsAppDetails(t *testing.T) {
+	srv, client := startFakeRedis(t)
+	c := NewRedisCache(client, "test:app_details:",
+		WithTTL[RegionKey, *SteamAppDetails](15*time.Minute),
+		WithStaleOnError[RegionKey, *SteamAppDetails](time.Hour),
+	)
+
+	want := &SteamAppDetails{
+		Name:           "Portal 2",
+		AppType:        "game",
+		HeaderImage:    "https://cdn.example/620/header.jpg",
+		PriceOverview:  PriceOverview{Currency: "USD", Initial: 999, Final: 199, DiscountPercent: 80, FinalFormatted: "$1.99"},
+		PcRequirements: json.RawMessage(`{"minimum":"<strong>OS:</strong> Windows 7"}`),
+		Metacritic:     Metacritic{Score: 95},
+		Categories:     []Category{{ID: 2, Description: "Single-player"}},
+		Genres:         []Genre{{ID: "1", Description: "Action"}},
+		Developers:     []string{"Valve"},
+		ReleaseDate:    ReleaseDate{Date: "18 Apr, 2011"},
+	}
+	key := regionKey("620", "US")
+	c.Set(key, want)
+
+	got, ok := c.Get(key)
+	if !ok {
+		t.Fatal("expected a hit")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+
+	if keys := srv.Keys(); !reflect.DeepEqual(keys, []string{"test:app_details:620:us"}) {
+		t.Errorf("stored keys = %v", keys)
+	}
+	// Redis keeps the entry for its TTL plus the stale window
+	if ttl := srv.TTL("test:app_details:620:us"); ttl <= time.Hour || ttl > 75*time.Minute {
+		t.Errorf("Redis TTL = %v, want 1h15m", ttl)
+	}
+
+	srv.FastForward(2 * time.Hour)
+	if _, ok := c.Get(key); ok {
+		t.Error("expected a miss once Redis expired the key")
+	}
+}
+
+func TestRedisCacheSharedBetweenInstances(t *testing.T) {
+	_, client := startFakeRedis(t)
+	a := NewRedisCache[string, int](client, "test:")
+	b := NewRedisCache[string, int](client, "test:")
+
+	if _, err := a.GetOrFetch("k", func() (int, error) { return 42, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := b.GetOrFetch("k", func() (int, error) {
+		t.Error("second instance should be served from Redis")
+		return 0, nil
+	})
+	if err != nil || got != 42 {
+		t.Errorf("GetOrFetch() = %d, %v, want 42", got, err)
+	}
+}
+
+func TestRedisCacheServesStaleOnError(t *testing.T) {
+	_, client := startFakeRedis(t)
+	c := NewRedisCache(client, "test:",
+		WithTTL[string, string](time.Millisecond),
+		WithStaleOnError[string, string](time.Hour),
+	)
+	c.Set("k", "stale")
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("k"); ok {
+		t.Error("Get() should not return expired entries")
+	}
+
+	got, err := c.GetOrFetch("k", func() (string, error) { return "", ErrUpstreamDown })
+	if err != nil || got != "stale" {
+		t.Errorf("GetOrFetch() = %q, %v, want the stale value", got, err)
+	}
+}
+
+func TestRedisCacheClearKeepsOtherPrefixes(t *testing.T) {
+	srv, client := startFakeRedis(t)
+	a := NewRedisCache[string, int](client, "test:a:")
+	b := NewRedisCache[string, int](client, "test:b:")
+	a.Set("1", 1)
+	a.Set("2", 2)
+	b.Set("1", 1)
+
+	a.countEntries()
+	if a.Size() != 2 {
+		t.Errorf("Size() = %d, want 2", a.Size())
+	}
+	a.Clear()
+
+	if keys := srv.Keys(); !reflect.DeepEqual(keys, []string{"test:b:1"}) {
+		t.Errorf("keys after Clear() = %v, want only test:b:1", keys)
+	}
+	if a.Size() != 0 {
+		t.Errorf("Size() after Clear() = %d, want 0", a.Size())
+	}
+}
+
+func TestRedisCacheFallsBackWhenRedisIsDown(t *testing.T) {
+	srv, client := startFakeRedis(t)
+	c := NewRedisCache[string, int](client, "test:")
+	srv.Close()
+
+	got, err := c.GetOrFetch("k", func() (int, error) { return 7, nil })
+	if err != nil || got != 7 {
+		t.Errorf("GetOrFetch() = %d, %v, want the fetched value", got, err)
+	}
+
+	_, err = c.GetOrFetch("missing", func() (int, error) { return 0, ErrNotFound })
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetOrFetch() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRedisCacheSizeIsCountedInBackground(t *testing.T) {
+	_, client := startFakeRedis(t)
+	c := NewRedisCache[string, int](client, "test:")
+	c.Set("1", 1)
+	c.Set("2", 2)
+
+	// The first call starts a count and reports none yet
+	if n := c.Size(); n != 0 {
+		t.Errorf("Size() before the first count = %d, want 0", n)
+	}
+	deadline := time.Now().Add(time.Second)
+	for c.Size() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Size() = %d, want 2 once counted", c.Size())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Later calls report the last count instead of scanning again
+	c.Set("3", 3)
+	time.Sleep(20 * time.Millisecond)
+	if n := c.Size(); n != 2 {
+		t.Errorf("Size() = %d, want the count of 2 reused", n)
+	}
+	if removed := c.DeletePrefix("1"); removed != 1 || c.Size() != 1 {
+		t.Errorf("DeletePrefix() = %d, Size() = %d; want 1 and 1", removed, c.Size())
+	}
+}
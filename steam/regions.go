@@ -0,0 +1,199 @@
+package steam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+
+	"steam_bot/logattr"
+	"steam_bot/tracing"
+	"steam_bot/utils"
+)
+
+// maxBatchAppIDs limits how many app IDs are sent in one appdetails price request
+const maxBatchAppIDs = 50
+
+// RegionKey identifies a cached per-region lookup
+type RegionKey struct {
+	AppID string
+	CC    string
+}
+
+func regionKey(appID, cc string) RegionKey {
+	return RegionKey{AppID: appID, CC: strings.ToLower(cc)}
+}
+
+// String renders the key as "appID:cc", e.g. for Redis keys
+func (k RegionKey) String() string {
+	return k.AppID + ":" + k.CC
+}
+
+// RegionalPrice is an app's store price in one country
+type RegionalPrice struct {
+	CC        string
+	Available bool // false if the app is free or not sold in the region
+	Price     PriceOverview
+}
+
+// priceOnlyResponse is an appdetails entry requested with filters=price_overview.
+// Steam returns "data": [] instead of an object for free or unavailable apps.
+type priceOnlyResponse struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// maxRegionalPriceFetches limits how many countries GetRegionalPrices fetches at
+// once. The store's rate limiter paces them too; this keeps one app's lookup from
+// taking the whole burst.
+const maxRegionalPriceFetches = 4
+
+// GetRegionalPrices returns the app's price in every given country, in the order
+// given. Countries are looked up in parallel through the per-(appID, cc) cache, so
+// concurrent lookups of the same region share one fetch.
+func (c *Client) GetRegionalPrices(ctx context.Context, appID string, ccs []string) (_ []RegionalPrice, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetRegionalPrices", tracing.String("app_id", appID), tracing.Int("regions", int64(len(ccs))))
+	defer func() { span.Finish(err) }()
+
+	results := make([]RegionalPrice, len(ccs))
+	errs := make([]error, len(ccs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxRegionalPriceFetches)
+
+	for i, cc := range ccs {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i], errs[i] = c.getRegionalPrice(ctx, appID, cc)
+		})
+	}
+	wg.Wait()
+
+	prices := make([]RegionalPrice, 0, len(ccs))
+	var lastErr error
+	for i, cc := range ccs {
+		if errs[i] != nil {
+			slog.ErrorContext(ctx, "Error fetching regional price", utils.LogKeyAppID, appID, "country", cc, logattr.Error(errs[i]))
+			lastErr = errs[i]
+			continue
+		}
+		prices = append(prices, results[i])
+	}
+
+	if len(prices) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return prices, nil
+}
+
+// getRegionalPrice returns the app's price in one country
+func (c *Client) getRegionalPrice(ctx context.Context, appID, cc string) (RegionalPrice, error) {
+	key := regionKey(appID, cc)
+	return c.caches.regionalPrices.GetOrFetchContext(ctx, key, func(ctx context.Context) (RegionalPrice, error) {
+		fetched, err := c.fetchPricesInRegion(ctx, []string{appID}, key.CC)
+		if err != nil {
+			return RegionalPrice{}, err
+		}
+		return fetched[appID], nil
+	})
+}
+
+// GetPricesInRegion returns the prices of several apps in one country. Uncached
+// apps are fetched together through the batched appids=...&filters=price_overview form.
+func (c *Client) GetPricesInRegion(ctx context.Context, appIDs []string, cc string) (_ map[string]RegionalPrice, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetPricesInRegion", tracing.Int("apps", int64(len(appIDs))), tracing.String("cc", cc))
+	defer func() { span.Finish(err) }()
+
+	cc = strings.ToLower(cc)
+	prices := make(map[string]RegionalPrice, len(appIDs))
+
+	var missing []string
+	for _, appID := range appIDs {
+		if price, ok := c.caches.regionalPrices.Get(regionKey(appID, cc)); ok {
+			prices[appID] = price
+		} else {
+			missing = append(missing, appID)
+		}
+	}
+
+	for start := 0; start < len(missing); start += maxBatchAppIDs {
+		batch := missing[start:min(start+maxBatchAppIDs, len(missing))]
+
+		fetched, err := c.fetchPricesInRegion(ctx, batch, cc)
+		if err != nil {
+			return prices, err
+		}
+		for appID, price := range fetched {
+			c.caches.regionalPrices.Set(regionKey(appID, cc), price)
+			prices[appID] = price
+		}
+	}
+
+	return prices, nil
+}
+
+func (c *Client) fetchPricesInRegion(ctx context.Context, appIDs []string, cc string) (map[string]RegionalPrice, error) {
+	apiURL := fmt.Sprintf("%s/api/appdetails?appids=%s&filters=price_overview&cc=%s",
+		c.storeURL, url.QueryEscape(strings.Join(appIDs, ",")), url.QueryEscape(cc))
+
+	var response map[string]priceOnlyResponse
+	if err := c.http.GetJSON(ctx, apiURL, &response); err != nil {
+		return nil, fmt.Errorf("fetching %s prices: %w", cc, err)
+	}
+
+	prices := make(map[string]RegionalPrice, len(appIDs))
+	for _, appID := range appIDs {
+		price := RegionalPrice{CC: cc}
+
+		entry, ok := response[appID]
+		if ok && entry.Success {
+			var data struct {
+				PriceOverview *PriceOverview `json:"price_overview"`
+			}
+			// Free apps come back as an empty array, which fails to decode into the struct
+			if json.Unmarshal(entry.Data, &data) == nil && data.PriceOverview != nil {
+				price.Available = true
+				price.Price = *data.PriceOverview
+				c.recordSteamPrice(appID, cc, price.Price)
+			}
+		}
+
+		prices[appID] = price
+	}
+
+	return prices, nil
+}
+
+// storeCountries are the ISO 3166-1 countries the store can be browsed from. Steam
+// doesn't sell in Cuba, Iran, North Korea or Syria, so they are left out.
+var storeCountries = func() map[string]bool {
+	const codes = `ad ae af ag ai al am ao aq ar as at au aw ax az
+		ba bb bd be bf bg bh bi bj bl bm bn bo bq br bs bt bv bw by bz
+		ca cc cd cf cg ch ci ck cl cm cn co cr cv cw cx cy cz
+		de dj dk dm do dz ec ee eg eh er es et fi fj fk fm fo fr
+		ga gb gd ge gf gg gh gi gl gm gn gp gq gr gs gt gu gw gy
+		hk hm hn hr ht hu id ie il im in io iq is it je jm jo jp
+		ke kg kh ki km kn kr kw ky kz la lb lc li lk lr ls lt lu lv ly
+		ma mc md me mf mg mh mk ml mm mn mo mp mq mr ms mt mu mv mw mx my mz
+		na nc ne nf ng ni nl no np nr nu nz om
+		pa pe pf pg ph pk pl pm pn pr ps pt pw py qa re ro rs ru rw
+		sa sb sc sd se sg sh si sj sk sl sm sn so sr ss st sv sx sz
+		tc td tf tg th tj tk tl tm tn to tr tt tv tw tz
+		ua ug um us uy uz va vc ve vg vi vn vu wf ws ye yt za zm zw`
+
+	countries := make(map[string]bool)
+	for _, cc := range strings.Fields(codes) {
+		countries[cc] = true
+	}
+	return countries
+}()
+
+// IsStoreCountry reports whether cc is a country code the Steam store accepts
+func IsStoreCountry(cc string) bool {
+	return storeCountries[strings.ToLower(cc)]
+}
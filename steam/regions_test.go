@@ -0,0 +1,195 @@
+package steam
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"steam_bot/utils"
+)
+
+// regionServer answers price_overview requests for app 620 in the requested country's
+// currency, as a free app in cn. It counts the requests for each country and how many
+// were in flight at once.
+type regionServer struct {
+	*httptest.Server
+
+	gate    chan struct{} // requests wait for it to be closed, if set
+	failing map[string]bool
+
+	mu       sync.Mutex
+	requests map[string]int
+	inflight int
+	peak     int
+}
+
+func startRegionServer(t *testing.T, gate chan struct{}, failing ...string) (*regionServer, *Client) {
+	t.Helper()
+
+	s := &regionServer{gate: gate, failing: make(map[string]bool), requests: make(map[string]int)}
+	for _, cc := range failing {
+		s.failing[cc] = true
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cc := r.URL.Query().Get("cc")
+		s.mu.Lock()
+		s.requests[cc]++
+		s.inflight++
+		s.peak = max(s.peak, s.inflight)
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			s.inflight--
+			s.mu.Unlock()
+		}()
+
+		if s.gate != nil {
+			<-s.gate
+		}
+		if s.failing[cc] {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if cc == "cn" {
+			fmt.Fprint(w, `{"620":{"success":true,"data":[]}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"620":{"success":true,"data":{"price_overview":{"currency":"%s","final":999}}}}`, cc)
+	}))
+	t.Cleanup(s.Close)
+
+	client := NewClient(
+		WithStoreURL(s.URL),
+		WithHTTPClient(utils.NewClient(utils.WithMaxAttempts(1))),
+	)
+	return s, client
+}
+
+func (s *regionServer) count(cc string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[cc]
+}
+
+func (s *regionServer) inFlight() (now, peak int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inflight, s.peak
+}
+
+func TestGetRegionalPricesKeepsOrderAndCaches(t *testing.T) {
+	srv, client := startRegionServer(t, nil)
+	ctx := context.Background()
+	ccs := []string{"US", "gb", "cn", "br"}
+
+	for range 2 {
+		prices, err := client.GetRegionalPrices(ctx, "620", ccs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prices) != len(ccs) {
+			t.Fatalf("got %d prices, want %d", len(prices), len(ccs))
+		}
+		for i, want := range []string{"us", "gb", "cn", "br"} {
+			if prices[i].CC != want {
+				t.Errorf("prices[%d].CC = %q, want %q", i, prices[i].CC, want)
+			}
+			if available := want != "cn"; prices[i].Available != available {
+				t.Errorf("%s available = %t, want %t", want, prices[i].Available, available)
+			}
+		}
+		if prices[0].Price.Currency != "us" {
+			t.Errorf("us price = %+v, want the one fetched for us", prices[0].Price)
+		}
+	}
+
+	for _, cc := range []string{"us", "gb", "cn", "br"} {
+		if n := srv.count(cc); n != 1 {
+			t.Errorf("%s fetched %d times, want once and then cached", cc, n)
+		}
+	}
+}
+
+func TestGetRegionalPricesFetchesInParallel(t *testing.T) {
+	gate := make(chan struct{})
+	srv, client := startRegionServer(t, gate)
+	ccs := []string{"us", "gb", "de", "fr", "br", "jp", "au", "ca"}
+
+	done := make(chan error)
+	go func() {
+		_, err := client.GetRegionalPrices(context.Background(), "620", ccs)
+		done <- err
+	}()
+	waitInFlight(t, srv, maxRegionalPriceFetches, done)
+
+	close(gate)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, peak := srv.inFlight(); peak != maxRegionalPriceFetches {
+		t.Errorf("peak concurrent fetches = %d, want %d", peak, maxRegionalPriceFetches)
+	}
+	for _, cc := range ccs {
+		if n := srv.count(cc); n != 1 {
+			t.Errorf("%s fetched %d times, want once", cc, n)
+		}
+	}
+}
+
+func TestGetRegionalPricesSharesFetchesInFlight(t *testing.T) {
+	gate := make(chan struct{})
+	srv, client := startRegionServer(t, gate)
+
+	results := make(chan error)
+	lookup := func() {
+		_, err := client.GetRegionalPrices(context.Background(), "620", []string{"us"})
+		results <- err
+	}
+	go lookup()
+	waitInFlight(t, srv, 1, results)
+	go lookup()
+
+	close(gate)
+	for range 2 {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := srv.count("us"); n != 1 {
+		t.Errorf("us fetched %d times, want one fetch shared by both lookups", n)
+	}
+}
+
+// waitInFlight waits until n requests are held at the server's gate, failing if a
+// lookup finishes first
+func waitInFlight(t *testing.T, srv *regionServer, n int, done <-chan error) {
+	t.Helper()
+	for now, _ := srv.inFlight(); now < n; now, _ = srv.inFlight() {
+		select {
+		case err := <-done:
+			t.Fatalf("lookup finished before %d fetches were in flight: %v", n, err)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestGetRegionalPricesSkipsFailedCountries(t *testing.T) {
+	_, client := startRegionServer(t, nil, "gb")
+	ctx := context.Background()
+
+	prices, err := client.GetRegionalPrices(ctx, "620", []string{"us", "gb", "br"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 2 || prices[0].CC != "us" || prices[1].CC != "br" {
+		t.Errorf("prices = %+v, want us and br", prices)
+	}
+
+	if _, err := client.GetRegionalPrices(ctx, "620", []string{"gb"}); err == nil {
+		t.Error("every country failed but there was no error")
+	}
+}
@@ -0,0 +1,85 @@
+package steam
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"steam_bot/tracing"
+)
+
+// ----- Store Types -----
+
+// Store is an entry of CheapShark's store catalogue
+type Store struct {
+	StoreID   string `json:"storeID"`
+	StoreName string `json:"storeName"`
+	IsActive  int    `json:"isActive"`
+	Images    struct {
+		Banner string `json:"banner"`
+		Logo   string `json:"logo"`
+		Icon   string `json:"icon"`
+	} `json:"images"`
+}
+
+// Active reports whether CheapShark still tracks deals for the store
+func (s Store) Active() bool {
+	return s.IsActive == 1
+}
+
+// IconURL returns the absolute URL of the store's icon
+func (s Store) IconURL() string {
+	if s.Images.Icon == "" {
+		return ""
+	}
+	return DefaultCheapSharkURL + s.Images.Icon
+}
+
+// LogoURL returns the absolute URL of the store's logo
+func (s Store) LogoURL() string {
+	if s.Images.Logo == "" {
+		return ""
+	}
+	return DefaultCheapSharkURL + s.Images.Logo
+}
+
+// ----- Store API Functions -----
+
+// GetStores returns CheapShark's store catalogue keyed by store ID (cached)
+func (c *Client) GetStores(ctx context.Context) (_ map[string]Store, err error) {
+	ctx, span := tracing.Start(ctx, "steam.GetStores")
+	defer func() { span.Finish(err) }()
+
+	return c.caches.stores.GetOrFetchContext(ctx, "stores", func(ctx context.Context) (map[string]Store, error) {
+		return c.fetchStores(ctx)
+	})
+}
+
+// GetStore looks up a single store by ID. Unknown stores return a placeholder named after the ID.
+func (c *Client) GetStore(ctx context.Context, storeID string) Store {
+	stores, err := c.GetStores(ctx)
+	if err == nil {
+		if store, ok := stores[storeID]; ok {
+			return store
+		}
+	}
+	return Store{StoreID: storeID, StoreName: "Store #" + storeID, IsActive: 1}
+}
+
+func (c *Client) fetchStores(ctx context.Context) (map[string]Store, error) {
+	var list []Store
+	if err := c.http.GetJSON(ctx, c.cheapSharkURL+"/api/1.0/stores", &list); err != nil {
+		return nil, fmt.Errorf("fetching stores: %w", err)
+	}
+
+	stores := make(map[string]Store, len(list))
+	for _, s := range list {
+		stores[s.StoreID] = s
+	}
+	return stores, nil
+}
+
+// DealRedirectURL returns CheapShark's redirect link that forwards to the deal on its real store
+func DealRedirectURL(dealID string) string {
+	return DefaultCheapSharkURL + "/redirect?dealID=" + url.QueryEscape(dealID)
+}
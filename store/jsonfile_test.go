@@ -0,0 +1,128 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fileStores opens each store kept in a JSON file and reports how many records it loaded
+var fileStores = []struct {
+	name string
+	open func(path string) (records int, err error)
+}{
+	{"ledger", func(path string) (int, error) {
+		l, err := NewFileLedger(path, DefaultRetention)
+		if err != nil {
+			return 0, err
+		}
+		return l.Len(), nil
+	}},
+	{"watchlist", func(path string) (int, error) {
+		w, err := NewWatchlist(path)
+		if err != nil {
+			return 0, err
+		}
+		return len(w.All()), nil
+	}},
+	{"preferences", func(path string) (int, error) {
+		p, err := NewPreferences(path)
+		if err != nil {
+			return 0, err
+		}
+		return len(p.countries), nil
+	}},
+	{"price history", func(path string) (int, error) {
+		h, err := NewPriceHistory(path, HistoryPolicy{})
+		if err != nil {
+			return 0, err
+		}
+		return h.Len(), nil
+	}},
+}
+
+func TestStoresOpenMissingAndEmptyFiles(t *testing.T) {
+	for _, store := range fileStores {
+		for _, tt := range []struct {
+			name    string
+			content *string // nil leaves the file missing
+		}{
+			{"missing", nil},
+			{"empty", new(string)},
+			{"null", ptr("null")},
+			{"empty object", ptr("{}")},
+		} {
+			t.Run(store.name+"/"+tt.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "data", "store.json")
+				if tt.content != nil {
+					writeTestFile(t, path, *tt.content)
+				}
+
+				records, err := store.open(path)
+				if err != nil || records != 0 {
+					t.Errorf("open = %d records, %v; want an empty store", records, err)
+				}
+			})
+		}
+	}
+}
+
+func TestStoresRejectCorruptFiles(t *testing.T) {
+	for _, store := range fileStores {
+		for _, tt := range []struct {
+			name    string
+			content string
+		}{
+			{"truncated", `{"1001": `},
+			{"not json", "garbage"},
+			{"wrong shape", `[1, 2, 3]`},
+		} {
+			t.Run(store.name+"/"+tt.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "store.json")
+				writeTestFile(t, path, tt.content)
+
+				if _, err := store.open(path); err == nil || !strings.Contains(err.Error(), path) {
+					t.Errorf("open = %v, want an error naming %s", err, path)
+				}
+			})
+		}
+	}
+}
+
+func TestSaveJSONLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nested", "store.json")
+
+	for i := range 3 {
+		if err := saveJSON(path, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got map[string]int
+	if err := loadJSON(path, &got); err != nil || got["n"] != 2 {
+		t.Errorf("loaded %v, %v; want the last save", got, err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only store.json", len(entries))
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DealLedger records which deals have already been posted
+type DealLedger interface {
+	// Has reports whether the deal has been recorded
+	Has(dealID string) bool
+	// Mark records the deal as sent at the given time
+	Mark(dealID string, at time.Time) error
+	// Len returns the number of recorded deals
+	Len() int
+	// Seeded reports whether the ledger has been seeded with the deals current on the first run
+	Seeded() bool
+	// MarkSeeded records that the first run has seeded the ledger, even if it matched no deals
+	MarkSeeded() error
+	// Prune applies the ledger's retention policy and returns how many entries were removed
+	Prune() (int, error)
+	// Close flushes pending state and releases resources
+	Close() error
+}
+
+// RetentionPolicy controls how long ledger entries are kept
+type RetentionPolicy struct {
+	MaxAge     time.Duration // entries older than this are dropped (0 = keep forever)
+	MaxEntries int           // keep at most this many newest entries (0 = unlimited)
+}
+
+// DefaultRetention keeps a month of history capped at 200 entries
+var DefaultRetention = RetentionPolicy{
+	MaxAge:     30 * 24 * time.Hour,
+	MaxEntries: 200,
+}
+
+// NewDealLedger creates a ledger for the given backend ("memory" or "file")
+func NewDealLedger(backend, path string, policy RetentionPolicy) (DealLedger, error) {
+	switch backend {
+	case "", "file":
+		return NewFileLedger(path, policy)
+	case "memory":
+		return NewMemoryLedger(policy), nil
+	default:
+		return nil, fmt.Errorf("unknown ledger backend %q", backend)
+	}
+}
+
+// ----- Memory Ledger -----
+
+// MemoryLedger is a DealLedger that lives only for the lifetime of the process
+type MemoryLedger struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+	policy  RetentionPolicy
+	seeded  bool
+}
+
+// NewMemoryLedger creates an empty in-memory ledger
+func NewMemoryLedger(policy RetentionPolicy) *MemoryLedger {
+	return &MemoryLedger{
+		entries: make(map[string]time.Time),
+		policy:  policy,
+	}
+}
+
+func (l *MemoryLedger) Has(dealID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, exists := l.entries[dealID]
+	return exists
+}
+
+func (l *MemoryLedger) Mark(dealID string, at time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[dealID] = at
+	return nil
+}
+
+func (l *MemoryLedger) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.entries)
+}
+
+func (l *MemoryLedger) Seeded() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.seeded
+}
+
+func (l *MemoryLedger) MarkSeeded() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seeded = true
+	return nil
+}
+
+func (l *MemoryLedger) Prune() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return pruneEntries(l.entries, l.policy, time.Now()), nil
+}
+
+func (l *MemoryLedger) Close() error {
+	return nil
+}
+
+// ----- File Ledger -----
+
+// seededKey marks a seeded ledger in its file. It can't clash with a CheapShark
+// deal ID, which is URL-encoded.
+const seededKey = "#seeded"
+
+// FileLedger is a DealLedger persisted as a JSON file, rewritten atomically on every change
+type FileLedger struct {
+	*MemoryLedger
+	path string
+}
+
+// NewFileLedger opens (or creates) the ledger stored at path
+func NewFileLedger(path string, policy RetentionPolicy) (*FileLedger, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file ledger requires a path")
+	}
+
+	l := &FileLedger{
+		MemoryLedger: NewMemoryLedger(policy),
+		path:         path,
+	}
+
+	if err := loadJSON(path, &l.entries); err != nil {
+		return nil, fmt.Errorf("loading ledger: %w", err)
+	}
+	if l.entries == nil {
+		l.entries = make(map[string]time.Time)
+	}
+
+	// Files written before the marker existed were seeded if they hold any deals
+	_, marked := l.entries[seededKey]
+	delete(l.entries, seededKey)
+	l.seeded = marked || len(l.entries) > 0
+
+	return l, nil
+}
+
+func (l *FileLedger) Mark(dealID string, at time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[dealID] = at
+	return l.save()
+}
+
+func (l *FileLedger) MarkSeeded() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seeded = true
+	return l.save()
+}
+
+func (l *FileLedger) Prune() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	removed := pruneEntries(l.entries, l.policy, time.Now())
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, l.save()
+}
+
+func (l *FileLedger) Close() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.save()
+}
+
+// save writes the entries and the seeded marker (must be called with lock held)
+func (l *FileLedger) save() error {
+	data := l.entries
+	if l.seeded {
+		data = maps.Clone(l.entries)
+		data[seededKey] = time.Time{}
+	}
+	return saveJSON(l.path, data)
+}
+
+// pruneEntries removes entries violating the policy (must be called with lock held)
+func pruneEntries(entries map[string]time.Time, policy RetentionPolicy, now time.Time) int {
+	removed := 0
+
+	if policy.MaxAge > 0 {
+		cutoff := now.Add(-policy.MaxAge)
+		for id, t := range entries {
+			if t.Before(cutoff) {
+				delete(entries, id)
+				removed++
+			}
+		}
+	}
+
+	if policy.MaxEntries > 0 && len(entries) > policy.MaxEntries {
+		ids := make([]string, 0, len(entries))
+		for id := range entries {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return entries[ids[i]].Before(entries[ids[j]])
+		})
+
+		for _, id := range ids[:len(ids)-policy.MaxEntries] {
+			delete(entries, id)
+			removed++
+		}
+	}
+
+	return removed
+}
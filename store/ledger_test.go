@@ -0,0 +1,173 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileLedgerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent_deals.json")
+	sentAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	l, err := NewFileLedger(path, DefaultRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"deal-a", "deal-b"} {
+		if err := l.Mark(id, sentAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileLedger(path, DefaultRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Has("deal-a") || !reopened.Has("deal-b") || reopened.Has("deal-c") {
+		t.Error("reopened ledger lost or invented deals")
+	}
+	if got := reopened.entries["deal-a"]; !got.Equal(sentAt) {
+		t.Errorf("deal-a sent at %s, want %s", got, sentAt)
+	}
+}
+
+func TestFileLedgerSeededMarker(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		content    string // empty leaves the file missing
+		wantSeeded bool
+		wantLen    int
+	}{
+		{"new ledger", "", false, 0},
+		{"no deals", `{}`, false, 0},
+		{"deals without marker", `{"deal-a": "2026-05-01T12:00:00Z"}`, true, 1},
+		{"marker only", `{"#seeded": "0001-01-01T00:00:00Z"}`, true, 0},
+		{"marker and deals", `{"#seeded": "0001-01-01T00:00:00Z", "deal-a": "2026-05-01T12:00:00Z"}`, true, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sent_deals.json")
+			if tt.content != "" {
+				writeTestFile(t, path, tt.content)
+			}
+
+			l, err := NewFileLedger(path, DefaultRetention)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l.Seeded() != tt.wantSeeded || l.Len() != tt.wantLen {
+				t.Errorf("seeded, len = %t, %d; want %t, %d", l.Seeded(), l.Len(), tt.wantSeeded, tt.wantLen)
+			}
+			if l.Has(seededKey) {
+				t.Error("the marker was loaded as a deal")
+			}
+		})
+	}
+}
+
+func TestFileLedgerKeepsSeedingWithoutDeals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent_deals.json")
+
+	l, err := NewFileLedger(path, DefaultRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.MarkSeeded(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileLedger(path, DefaultRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Seeded() || reopened.Len() != 0 {
+		t.Errorf("seeded, len = %t, %d after reopening; want true, 0", reopened.Seeded(), reopened.Len())
+	}
+}
+
+func TestLedgerPrune(t *testing.T) {
+	now := time.Now()
+
+	for _, tt := range []struct {
+		name        string
+		policy      RetentionPolicy
+		wantRemoved int
+		wantKept    []string
+	}{
+		{"keep forever", RetentionPolicy{}, 0, []string{"old", "recent", "newest"}},
+		{"max age", RetentionPolicy{MaxAge: 48 * time.Hour}, 1, []string{"recent", "newest"}},
+		{"max entries", RetentionPolicy{MaxEntries: 1}, 2, []string{"newest"}},
+		{"both", RetentionPolicy{MaxAge: 48 * time.Hour, MaxEntries: 5}, 1, []string{"recent", "newest"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, backend := range []string{"memory", "file"} {
+				l, err := NewDealLedger(backend, filepath.Join(t.TempDir(), "sent_deals.json"), tt.policy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = l.Mark("old", now.Add(-72*time.Hour))
+				_ = l.Mark("recent", now.Add(-time.Hour))
+				_ = l.Mark("newest", now)
+
+				removed, err := l.Prune()
+				if err != nil || removed != tt.wantRemoved || l.Len() != len(tt.wantKept) {
+					t.Errorf("%s: Prune = %d, %v leaving %d; want %d removed", backend, removed, err, l.Len(), tt.wantRemoved)
+				}
+				for _, id := range tt.wantKept {
+					if !l.Has(id) {
+						t.Errorf("%s: %s was pruned", backend, id)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewDealLedgerRejectsBadConfig(t *testing.T) {
+	if _, err := NewDealLedger("sqlite", "sent_deals.db", DefaultRetention); err == nil {
+		t.Error("unknown backend accepted")
+	}
+	if _, err := NewDealLedger("file", "", DefaultRetention); err == nil {
+		t.Error("file ledger without a path accepted")
+	}
+}
+
+func TestFileLedgerConcurrentMarks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent_deals.json")
+	l, err := NewFileLedger(path, RetentionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Go(func() {
+			id := fmt.Sprintf("deal-%d", i)
+			if err := l.Mark(id, time.Now()); err != nil {
+				t.Error(err)
+			}
+			if !l.Has(id) {
+				t.Errorf("%s missing right after Mark", id)
+			}
+		})
+	}
+	wg.Go(func() {
+		if err := l.MarkSeeded(); err != nil {
+			t.Error(err)
+		}
+	})
+	wg.Wait()
+
+	reopened, err := NewFileLedger(path, RetentionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 20 || !reopened.Seeded() {
+		t.Errorf("reopened len, seeded = %d, %t; want every mark saved", reopened.Len(), reopened.Seeded())
+	}
+}
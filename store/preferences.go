@@ -0,0 +1,73 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Preferences stores per-user and per-chat settings keyed by Telegram ID,
+// optionally persisted to a JSON file. Users have positive IDs and group
+// chats negative ones, so both share one map without clashing.
+type Preferences struct {
+	mu        sync.RWMutex
+	countries map[int64]string
+	path      string
+}
+
+// NewPreferences loads the preferences stored at path. An empty path keeps them in memory only.
+func NewPreferences(path string) (*Preferences, error) {
+	p := &Preferences{
+		countries: make(map[int64]string),
+		path:      path,
+	}
+
+	if path != "" {
+		if err := loadJSON(path, &p.countries); err != nil {
+			return nil, fmt.Errorf("loading preferences: %w", err)
+		}
+		if p.countries == nil {
+			p.countries = make(map[int64]string)
+		}
+	}
+
+	return p, nil
+}
+
+// Country returns the Steam store country set for id
+func (p *Preferences) Country(id int64) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	cc, ok := p.countries[id]
+	return cc, ok
+}
+
+// SetCountry stores the Steam store country for id
+func (p *Preferences) SetCountry(id int64, cc string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.countries[id] = cc
+	return p.save()
+}
+
+// ClearCountry removes the Steam store country for id
+func (p *Preferences) ClearCountry(id int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.countries, id)
+	return p.save()
+}
+
+// Close flushes the preferences to disk
+func (p *Preferences) Close() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.save()
+}
+
+// save persists the preferences (must be called with lock held)
+func (p *Preferences) save() error {
+	if p.path == "" {
+		return nil
+	}
+	return saveJSON(p.path, p.countries)
+}
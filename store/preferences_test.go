@@ -0,0 +1,104 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestPreferencesRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+
+	p, err := NewPreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Users have positive IDs and group chats negative ones
+	for id, cc := range map[int64]string{1001: "in", 1002: "gb", -1001: "de"} {
+		if err := p.SetCountry(id, cc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.ClearCountry(1002); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewPreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		id     int64
+		wantCC string
+		wantOK bool
+	}{
+		{1001, "in", true},
+		{1002, "", false},
+		{-1001, "de", true},
+		{1003, "", false},
+	} {
+		if cc, ok := reopened.Country(tt.id); cc != tt.wantCC || ok != tt.wantOK {
+			t.Errorf("Country(%d) = %q, %t; want %q, %t", tt.id, cc, ok, tt.wantCC, tt.wantOK)
+		}
+	}
+}
+
+func TestPreferencesInMemory(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	p, err := NewPreferences("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetCountry(1001, "in"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if cc, _ := p.Country(1001); cc != "in" {
+		t.Errorf("Country = %q, want in", cc)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("in-memory preferences wrote %d files", len(entries))
+	}
+}
+
+func TestPreferencesConcurrentAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+	p, err := NewPreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for id := range int64(20) {
+		wg.Go(func() {
+			if err := p.SetCountry(id, "us"); err != nil {
+				t.Error(err)
+			}
+			if cc, ok := p.Country(id); !ok || cc != "us" {
+				t.Errorf("Country(%d) = %q, %t right after SetCountry", id, cc, ok)
+			}
+			if id%2 == 1 {
+				if err := p.ClearCountry(id); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	reopened, err := NewPreferences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := range int64(20) {
+		if _, ok := reopened.Country(id); ok != (id%2 == 0) {
+			t.Errorf("Country(%d) set = %t after reopening, want %t", id, ok, id%2 == 0)
+		}
+	}
+}
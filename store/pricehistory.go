@@ -0,0 +1,335 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"steam_bot/logattr"
+)
+
+// maxPricePoints caps how many points are kept per app and region
+const maxPricePoints = 500
+
+// resampleInterval records an unchanged price at most this often, so gaps in the
+// series reflect real price changes rather than missing observations
+const resampleInterval = 24 * time.Hour
+
+// PricePoint is one observed price, in major currency units
+type PricePoint struct {
+	Time     time.Time `json:"t"`
+	Price    float64   `json:"p"`
+	Regular  float64   `json:"r"`
+	Currency string    `json:"c,omitempty"`
+	Discount int       `json:"d,omitempty"` // percent
+}
+
+// OnSale reports whether the point was a discounted price
+func (p PricePoint) OnSale() bool {
+	return p.Discount > 0 || (p.Regular > 0 && p.Price < p.Regular)
+}
+
+// PriceStats summarizes the history of an app in one region
+type PriceStats struct {
+	Region       string
+	Currency     string
+	Current      PricePoint
+	Lowest       PricePoint
+	Average      float64 // time-weighted over the tracked period
+	Since        time.Time
+	LastSaleAt   time.Time // zero if never seen on sale
+	Observations int
+}
+
+// DaysSinceSale returns whole days since the app was last seen on sale, or -1 if never
+func (s PriceStats) DaysSinceSale(now time.Time) int {
+	if s.LastSaleAt.IsZero() {
+		return -1
+	}
+	return int(now.Sub(s.LastSaleAt).Hours() / 24)
+}
+
+// HistoryPolicy controls how often the history is written to disk and how much of it is kept
+type HistoryPolicy struct {
+	FlushInterval time.Duration // changes are written at most this often (0 = only on Close)
+	MaxAge        time.Duration // points older than this are dropped (0 = keep forever)
+	MaxApps       int           // keep at most this many apps, the most recently observed (0 = unlimited)
+}
+
+// DefaultHistoryPolicy writes changes every minute and keeps a year of 5000 apps
+var DefaultHistoryPolicy = HistoryPolicy{
+	FlushInterval: time.Minute,
+	MaxAge:        365 * 24 * time.Hour,
+	MaxApps:       5000,
+}
+
+// PriceHistory stores observed prices keyed by app ID and region, optionally persisted
+// to a JSON file. Observations are kept in memory and written in the background.
+type PriceHistory struct {
+	mu     sync.RWMutex
+	series map[string][]PricePoint
+	dirty  bool // series changed since the last flush
+
+	path    string
+	policy  HistoryPolicy
+	flushMu sync.Mutex // serializes file writes
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	closed  sync.Once
+}
+
+// NewPriceHistory loads the history stored at path. An empty path keeps it in memory only.
+func NewPriceHistory(path string, policy HistoryPolicy) (*PriceHistory, error) {
+	h := &PriceHistory{
+		series: make(map[string][]PricePoint),
+		path:   path,
+		policy: policy,
+		stop:   make(chan struct{}),
+	}
+
+	if path != "" {
+		if err := loadJSON(path, &h.series); err != nil {
+			return nil, fmt.Errorf("loading price history: %w", err)
+		}
+		if h.series == nil {
+			h.series = make(map[string][]PricePoint)
+		}
+	}
+	h.prune(time.Now())
+
+	if path != "" && policy.FlushInterval > 0 {
+		h.stopped.Add(1)
+		go h.flushLoop()
+	}
+
+	return h, nil
+}
+
+func priceKey(appID, region string) string {
+	return appID + ":" + strings.ToLower(region)
+}
+
+// Record adds an observation. Consecutive identical prices are only re-recorded once a day.
+func (h *PriceHistory) Record(appID, region string, point PricePoint) error {
+	if appID == "" || point.Price < 0 {
+		return nil
+	}
+	if point.Time.IsZero() {
+		point.Time = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := priceKey(appID, region)
+	points := h.series[key]
+
+	if n := len(points); n > 0 {
+		last := points[n-1]
+		if last.Price == point.Price && last.Discount == point.Discount &&
+			point.Time.Sub(last.Time) < resampleInterval {
+			return nil
+		}
+	}
+
+	points = append(points, point)
+	if len(points) > maxPricePoints {
+		points = slices.Delete(points, 0, len(points)-maxPricePoints)
+	}
+	h.series[key] = points
+	h.dirty = true
+
+	return nil
+}
+
+// Regions returns every region with recorded prices for the app, sorted
+func (h *PriceHistory) Regions(appID string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	prefix := appID + ":"
+	var regions []string
+	for key := range h.series {
+		if region, ok := strings.CutPrefix(key, prefix); ok {
+			regions = append(regions, region)
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// Stats summarizes the app's history in a region
+func (h *PriceHistory) Stats(appID, region string, now time.Time) (PriceStats, bool) {
+	h.mu.RLock()
+	points := h.series[priceKey(appID, region)]
+	h.mu.RUnlock()
+
+	if len(points) == 0 {
+		return PriceStats{}, false
+	}
+
+	stats := PriceStats{
+		Region:       strings.ToLower(region),
+		Currency:     points[len(points)-1].Currency,
+		Current:      points[len(points)-1],
+		Lowest:       points[0],
+		Since:        points[0].Time,
+		Observations: len(points),
+	}
+
+	var weighted, total float64
+	for i, p := range points {
+		if p.Price < stats.Lowest.Price {
+			stats.Lowest = p
+		}
+		if p.OnSale() {
+			stats.LastSaleAt = p.Time
+		}
+
+		// Each price holds until the next observation (or now for the latest one)
+		end := now
+		if i+1 < len(points) {
+			end = points[i+1].Time
+		}
+		if d := end.Sub(p.Time).Seconds(); d > 0 {
+			weighted += p.Price * d
+			total += d
+		}
+	}
+
+	if total > 0 {
+		stats.Average = weighted / total
+	} else {
+		stats.Average = stats.Current.Price
+	}
+	if stats.Current.OnSale() {
+		stats.LastSaleAt = now
+	}
+
+	return stats, true
+}
+
+// Len returns the number of apps with recorded prices
+func (h *PriceHistory) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.appSeen())
+}
+
+// Flush applies the retention policy and writes the history to disk if it changed
+func (h *PriceHistory) Flush() error {
+	if h.path == "" {
+		return nil
+	}
+
+	h.flushMu.Lock()
+	defer h.flushMu.Unlock()
+
+	h.prune(time.Now())
+
+	h.mu.Lock()
+	if !h.dirty {
+		h.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(h.series)
+	h.dirty = false
+	h.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", h.path, err)
+	}
+
+	if err := writeFile(h.path, data); err != nil {
+		h.mu.Lock()
+		h.dirty = true
+		h.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close stops the background writes and flushes the history to disk
+func (h *PriceHistory) Close() error {
+	h.closed.Do(func() { close(h.stop) })
+	h.stopped.Wait()
+	return h.Flush()
+}
+
+func (h *PriceHistory) flushLoop() {
+	defer h.stopped.Done()
+
+	ticker := time.NewTicker(h.policy.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := h.Flush(); err != nil {
+				slog.Error("Error saving price history", logattr.Error(err))
+			}
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// prune drops points older than MaxAge and the least recently observed apps beyond MaxApps
+func (h *PriceHistory) prune(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.policy.MaxAge > 0 {
+		cutoff := now.Add(-h.policy.MaxAge)
+		for key, points := range h.series {
+			i := sort.Search(len(points), func(i int) bool { return !points[i].Time.Before(cutoff) })
+			switch {
+			case i == len(points):
+				delete(h.series, key)
+			case i > 0:
+				h.series[key] = slices.Clone(points[i:])
+			default:
+				continue
+			}
+			h.dirty = true
+		}
+	}
+
+	seen := h.appSeen()
+	if h.policy.MaxApps <= 0 || len(seen) <= h.policy.MaxApps {
+		return
+	}
+
+	apps := make([]string, 0, len(seen))
+	for appID := range seen {
+		apps = append(apps, appID)
+	}
+	sort.Slice(apps, func(i, j int) bool { return seen[apps[i]].After(seen[apps[j]]) })
+
+	dropped := make(map[string]bool, len(apps)-h.policy.MaxApps)
+	for _, appID := range apps[h.policy.MaxApps:] {
+		dropped[appID] = true
+	}
+	for key := range h.series {
+		if appID, _, _ := strings.Cut(key, ":"); dropped[appID] {
+			delete(h.series, key)
+		}
+	}
+	h.dirty = true
+}
+
+// appSeen returns when each app was last observed in any region (must be called with lock held)
+func (h *PriceHistory) appSeen() map[string]time.Time {
+	seen := make(map[string]time.Time)
+	for key, points := range h.series {
+		appID, _, _ := strings.Cut(key, ":")
+		if last := points[len(points)-1].Time; last.After(seen[appID]) {
+			seen[appID] = last
+		}
+	}
+	return seen
+}
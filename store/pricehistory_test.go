@@ -0,0 +1,188 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriceHistoryWritesOnFlushOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	h, err := NewPriceHistory(path, HistoryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Record("620", "us", PricePoint{Price: 9.99}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Record wrote the file (stat: %v), want it left for the next flush", err)
+	}
+
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewPriceHistory(path, HistoryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats, ok := reopened.Stats("620", "us", time.Now()); !ok || stats.Current.Price != 9.99 {
+		t.Errorf("reopened stats = %+v, %t; want the point written on Close", stats, ok)
+	}
+}
+
+func TestPriceHistoryFlushesInBackground(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	h, err := NewPriceHistory(path, HistoryPolicy{FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	if err := h.Record("620", "us", PricePoint{Price: 9.99}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("history was not written within a second")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPriceHistoryRetention(t *testing.T) {
+	now := time.Now()
+	h, err := NewPriceHistory("", HistoryPolicy{MaxAge: 48 * time.Hour, MaxApps: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := func(appID, region string, age time.Duration, price float64) {
+		t.Helper()
+		if err := h.Record(appID, region, PricePoint{Time: now.Add(-age), Price: price}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record("620", "us", 72*time.Hour, 19.99) // too old
+	record("620", "us", time.Hour, 9.99)
+	record("400", "us", 30*time.Hour, 4.99) // least recently seen app
+	record("570", "us", 20*time.Hour, 0.99)
+	record("570", "gb", 2*time.Hour, 0.79)
+	record("730", "us", 96*time.Hour, 14.99) // only old points
+
+	h.prune(now)
+
+	if n := h.Len(); n != 2 {
+		t.Errorf("kept %d apps, want 2", n)
+	}
+	if stats, ok := h.Stats("620", "us", now); !ok || stats.Observations != 1 || stats.Lowest.Price != 9.99 {
+		t.Errorf("620 stats = %+v, %t; want only the recent point", stats, ok)
+	}
+	if regions := h.Regions("570"); len(regions) != 2 {
+		t.Errorf("570 regions = %v, want both kept", regions)
+	}
+	for _, appID := range []string{"400", "730"} {
+		if regions := h.Regions(appID); len(regions) != 0 {
+			t.Errorf("%s regions = %v, want the app dropped", appID, regions)
+		}
+	}
+}
+
+func TestPriceHistoryRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := start.Add(10 * 24 * time.Hour)
+
+	h, err := NewPriceHistory(path, HistoryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		region string
+		day    int
+		point  PricePoint
+	}{
+		{"us", 0, PricePoint{Price: 19.99, Regular: 19.99, Currency: "USD"}},
+		{"us", 0, PricePoint{Price: 19.99, Regular: 19.99, Currency: "USD"}}, // same day, not re-recorded
+		{"us", 4, PricePoint{Price: 4.99, Regular: 19.99, Currency: "USD", Discount: 75}},
+		{"us", 6, PricePoint{Price: 19.99, Regular: 19.99, Currency: "USD"}},
+		{"in", 2, PricePoint{Price: 499, Regular: 499, Currency: "INR"}},
+	} {
+		tt.point.Time = start.Add(time.Duration(tt.day) * 24 * time.Hour)
+		if err := h.Record("620", tt.region, tt.point); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewPriceHistory(path, HistoryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regions := reopened.Regions("620"); len(regions) != 2 || regions[0] != "in" || regions[1] != "us" {
+		t.Errorf("regions = %v, want [in us]", regions)
+	}
+	stats, ok := reopened.Stats("620", "us", now)
+	if !ok {
+		t.Fatal("no us stats after reopening")
+	}
+	if stats.Observations != 3 || stats.Currency != "USD" {
+		t.Errorf("stats = %+v, want 3 USD observations", stats)
+	}
+	if stats.Lowest.Price != 4.99 || stats.Lowest.Discount != 75 || !stats.Lowest.Time.Equal(start.Add(4*24*time.Hour)) {
+		t.Errorf("lowest = %+v, want the 75%% sale", stats.Lowest)
+	}
+	if days := stats.DaysSinceSale(now); days != 6 {
+		t.Errorf("days since sale = %d, want 6", days)
+	}
+}
+
+func TestPriceHistoryConcurrentAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	h, err := NewPriceHistory(path, HistoryPolicy{FlushInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for app := range 10 {
+		appID := fmt.Sprint(app)
+		wg.Go(func() {
+			for _, region := range []string{"us", "gb"} {
+				if err := h.Record(appID, region, PricePoint{Price: 9.99}); err != nil {
+					t.Error(err)
+				}
+				_, _ = h.Stats(appID, region, time.Now())
+			}
+		})
+		wg.Go(func() {
+			if err := h.Flush(); err != nil {
+				t.Error(err)
+			}
+			_ = h.Regions(appID)
+		})
+	}
+	wg.Wait()
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewPriceHistory(path, HistoryPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := reopened.Len(); n != 10 {
+		t.Errorf("reopened history has %d apps, want 10", n)
+	}
+}
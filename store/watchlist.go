@@ -0,0 +1,148 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MaxWatchesPerUser caps how many games a single user can watch
+const MaxWatchesPerUser = 50
+
+// ErrWatchlistFull is returned by Add when the user already watches MaxWatchesPerUser games
+var ErrWatchlistFull = errors.New("watchlist is full")
+
+// WatchEntry is a game a user wants to be alerted about
+type WatchEntry struct {
+	UserID         int64     `json:"user_id"`
+	AppID          string    `json:"app_id"`
+	GameID         string    `json:"game_id"` // CheapShark game ID
+	Title          string    `json:"title"`
+	TargetPrice    float64   `json:"target_price"`   // alert at or below this USD price (0 = any drop)
+	BaselinePrice  float64   `json:"baseline_price"` // cheapest price when the watch was added
+	LastPrice      float64   `json:"last_price"`
+	LastAlertPrice float64   `json:"last_alert_price"` // price of the last alert sent (0 = none pending)
+	AddedAt        time.Time `json:"added_at"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// Watchlist stores every user's watched games, optionally persisted to a JSON file
+type Watchlist struct {
+	mu      sync.RWMutex
+	entries map[int64][]WatchEntry
+	path    string
+}
+
+// NewWatchlist loads the watchlist stored at path. An empty path keeps it in memory only.
+func NewWatchlist(path string) (*Watchlist, error) {
+	w := &Watchlist{
+		entries: make(map[int64][]WatchEntry),
+		path:    path,
+	}
+
+	if path != "" {
+		if err := loadJSON(path, &w.entries); err != nil {
+			return nil, fmt.Errorf("loading watchlist: %w", err)
+		}
+		if w.entries == nil {
+			w.entries = make(map[int64][]WatchEntry)
+		}
+	}
+
+	return w, nil
+}
+
+// Add inserts or replaces the user's watch for entry.AppID
+func (w *Watchlist) Add(entry WatchEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	list := w.entries[entry.UserID]
+	idx := slices.IndexFunc(list, func(e WatchEntry) bool { return e.AppID == entry.AppID })
+	if idx >= 0 {
+		list[idx] = entry
+	} else {
+		if len(list) >= MaxWatchesPerUser {
+			return fmt.Errorf("%w (%d games)", ErrWatchlistFull, MaxWatchesPerUser)
+		}
+		w.entries[entry.UserID] = append(list, entry)
+	}
+
+	return w.save()
+}
+
+// Remove deletes the user's watch for appID, reporting whether it existed
+func (w *Watchlist) Remove(userID int64, appID string) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	list := w.entries[userID]
+	idx := slices.IndexFunc(list, func(e WatchEntry) bool { return e.AppID == appID })
+	if idx < 0 {
+		return false, nil
+	}
+
+	list = slices.Delete(list, idx, idx+1)
+	if len(list) == 0 {
+		delete(w.entries, userID)
+	} else {
+		w.entries[userID] = list
+	}
+
+	return true, w.save()
+}
+
+// UpdateCheck stores the result of a price check of entry: its last price, last
+// alert price and check time. The rest of the watch may have been changed by its
+// user meanwhile and is kept. Watches removed or added again meanwhile are ignored.
+func (w *Watchlist) UpdateCheck(entry WatchEntry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	list := w.entries[entry.UserID]
+	idx := slices.IndexFunc(list, func(e WatchEntry) bool { return e.AppID == entry.AppID })
+	if idx < 0 || !list[idx].AddedAt.Equal(entry.AddedAt) {
+		return nil
+	}
+	list[idx].LastPrice = entry.LastPrice
+	list[idx].LastAlertPrice = entry.LastAlertPrice
+	list[idx].CheckedAt = entry.CheckedAt
+
+	return w.save()
+}
+
+// List returns a copy of the user's watches
+func (w *Watchlist) List(userID int64) []WatchEntry {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return slices.Clone(w.entries[userID])
+}
+
+// All returns a copy of every watch across all users
+func (w *Watchlist) All() []WatchEntry {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var all []WatchEntry
+	for _, list := range w.entries {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// Close flushes the watchlist to disk
+func (w *Watchlist) Close() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.save()
+}
+
+// save persists the watchlist (must be called with lock held)
+func (w *Watchlist) save() error {
+	if w.path == "" {
+		return nil
+	}
+	return saveJSON(w.path, w.entries)
+}
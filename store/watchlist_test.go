@@ -0,0 +1,171 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchlistRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchlist.json")
+	addedAt := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	w, err := NewWatchlist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []WatchEntry{
+		{UserID: 1001, AppID: "620", GameID: "137", Title: "Portal 2", TargetPrice: 2, BaselinePrice: 9.99, AddedAt: addedAt},
+		{UserID: 1001, AppID: "400", Title: "Portal", AddedAt: addedAt},
+		{UserID: 1002, AppID: "620", Title: "Portal 2", AddedAt: addedAt},
+	}
+	for _, e := range entries {
+		if err := w.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if removed, err := w.Remove(1001, "400"); !removed || err != nil {
+		t.Fatalf("Remove = %t, %v", removed, err)
+	}
+	if removed, err := w.Remove(1001, "400"); removed || err != nil {
+		t.Errorf("second Remove = %t, %v; want nothing removed", removed, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewWatchlist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.List(1001); len(got) != 1 || got[0] != entries[0] {
+		t.Errorf("user 1001 watches %+v, want only %+v", got, entries[0])
+	}
+	if got := reopened.List(1002); len(got) != 1 || got[0] != entries[2] {
+		t.Errorf("user 1002 watches %+v, want only %+v", got, entries[2])
+	}
+}
+
+func TestWatchlistAdd(t *testing.T) {
+	w, err := NewWatchlist("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range MaxWatchesPerUser {
+		if err := w.Add(WatchEntry{UserID: 1001, AppID: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		entry   WatchEntry
+		wantErr error
+	}{
+		{"new game over the cap", WatchEntry{UserID: 1001, AppID: "new"}, ErrWatchlistFull},
+		{"existing game replaced", WatchEntry{UserID: 1001, AppID: "0", TargetPrice: 5}, nil},
+		{"another user", WatchEntry{UserID: 1002, AppID: "new"}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := w.Add(tt.entry); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Add = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	list := w.List(1001)
+	if len(list) != MaxWatchesPerUser || list[0].TargetPrice != 5 {
+		t.Errorf("user 1001 has %d watches, first %+v; want the cap with the first replaced", len(list), list[0])
+	}
+}
+
+func TestWatchlistUpdateCheck(t *testing.T) {
+	w, err := NewWatchlist("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addedAt := time.Now()
+	checked := WatchEntry{UserID: 1001, AppID: "620", TargetPrice: 5, AddedAt: addedAt}
+	if err := w.Add(checked); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user changes the target while the check runs
+	changed := checked
+	changed.TargetPrice = 3
+	if err := w.Add(changed); err != nil {
+		t.Fatal(err)
+	}
+
+	checked.LastPrice = 4.99
+	checked.CheckedAt = addedAt.Add(time.Hour)
+	if err := w.UpdateCheck(checked); err != nil {
+		t.Fatal(err)
+	}
+	got := w.List(1001)[0]
+	if got.TargetPrice != 3 || got.LastPrice != 4.99 || !got.CheckedAt.Equal(checked.CheckedAt) {
+		t.Errorf("watch = %+v, want the new target and the check result", got)
+	}
+
+	// A watch removed and added again is a new watch the old check doesn't apply to
+	if _, err := w.Remove(1001, "620"); err != nil {
+		t.Fatal(err)
+	}
+	readded := WatchEntry{UserID: 1001, AppID: "620", AddedAt: addedAt.Add(2 * time.Hour)}
+	if err := w.Add(readded); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.UpdateCheck(checked); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.List(1001)[0]; got != readded {
+		t.Errorf("watch = %+v, want the re-added watch untouched", got)
+	}
+}
+
+func TestWatchlistConcurrentAccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchlist.json")
+	w, err := NewWatchlist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for user := range int64(4) {
+		for app := range 5 {
+			wg.Go(func() {
+				entry := WatchEntry{UserID: user, AppID: fmt.Sprint(app)}
+				if err := w.Add(entry); err != nil {
+					t.Error(err)
+				}
+				_ = w.UpdateCheck(entry)
+				_ = w.All()
+			})
+		}
+	}
+	wg.Wait()
+
+	reopened, err := NewWatchlist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := reopened.All()
+	if len(all) != 20 {
+		t.Errorf("reopened watchlist has %d watches, want 20", len(all))
+	}
+	for user := range int64(4) {
+		apps := make([]string, 0, 5)
+		for _, e := range reopened.List(user) {
+			apps = append(apps, e.AppID)
+		}
+		slices.Sort(apps)
+		if !slices.Equal(apps, []string{"0", "1", "2", "3", "4"}) {
+			t.Errorf("user %d watches %v", user, apps)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package templates
 
 import (
+	"cmp"
 	"fmt"
+	"html"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -63,7 +68,7 @@ var InlineCommands = map[string]InlineCommand{
 // Commands maps command names to their responses (for /command handling)
 var Commands = map[string]string{
 	"start": "Welcome to <b>SteamBot</b>!\n\nUse the inline to search for Steam games and get detailed info.",
-	"help":  "<b>How to use SteamBot:</b>\n\n• Type <code>@steam_offersbot game name</code> in any chat to search\n• Click on a result to share game info\n• Use buttons to view details, requirements, and more",
+	"help":  "<b>How to use SteamBot:</b>\n\n• Type <code>@steam_offersbot game name</code> in any chat to search\n• Click on a result to share game info\n• Use buttons to view details, requirements, and more\n\n<b>Price alerts:</b>\n• <code>/watch appid|name [$price]</code> - get a private message when the game drops below a price\n• <code>/watchlist</code> - show your watched games\n• <code>/unwatch appid</code> - stop watching a game\n\n<b>Region:</b>\n• <code>/region cc</code> - show prices for your Steam store country (e.g. <code>/region us</code>)",
 }
 
 // CommandKeys returns all command names for regex pattern
@@ -75,39 +80,102 @@ func CommandKeys() string {
 	return strings.Join(keys, "|")
 }
 
-func FormatDealMessage(title, normalPrice, salePrice, inrPrice, rating, description, imageURL string, categories, genres []string) string {
+// DealPost holds the fields available to channel deal templates
+type DealPost struct {
+	Title       string
+	NormalPrice string
+	SalePrice   string
+	LocalPrice  string // in the user's or channel's store region
+	Savings     string
+	Rating      string
+	StoreName   string
+	StoreIcon   string
+	Description string
+	ImageURL    string
+	Categories  []string
+	Genres      []string
+}
+
+// DealTemplates maps template names usable in channel configuration to their formatters
+var DealTemplates = map[string]func(DealPost) string{
+	"default": FormatDealMessage,
+	"compact": FormatCompactDealMessage,
+}
+
+// FormatDealMessage renders a deal or search result with its price, store, rating and description
+func FormatDealMessage(p DealPost) string {
+	description := p.Description
 	if len(description) > 500 {
 		description = description[:500] + "..."
 	}
 
 	var msg strings.Builder
-	fmt.Fprintf(&msg, "🎮 <b>%s</b>\n", title)
+	fmt.Fprintf(&msg, "🎮 <b>%s</b>\n", p.Title)
 
-	if salePrice != "" {
-		fmt.Fprintf(&msg, "💸 <b>Price:</b> <code>$%s (was $%s)</code> / <code>%s</code>\n", salePrice, normalPrice, inrPrice)
+	if p.SalePrice != "" {
+		fmt.Fprintf(&msg, "💸 <b>Price:</b> <code>$%s (was $%s)</code>", p.SalePrice, p.NormalPrice)
+		if p.LocalPrice != "" {
+			fmt.Fprintf(&msg, " / <code>%s</code>", p.LocalPrice)
+		}
+		msg.WriteString("\n")
 	} else {
 		var price string
-		if inrPrice == "N/A" || inrPrice == "Free" || inrPrice == "To be announced" || inrPrice == "Coming soon" {
-			price = fmt.Sprintf("<code>%s</code>", inrPrice)
+		if p.LocalPrice == "N/A" || p.LocalPrice == "Free" || p.LocalPrice == "To be announced" || p.LocalPrice == "Coming soon" {
+			price = fmt.Sprintf("<code>%s</code>", p.LocalPrice)
 		} else {
-			price = fmt.Sprintf("<code>%s</code>", normalPrice)
-			if inrPrice != "" {
-				price += fmt.Sprintf(" / <code>%s</code>", inrPrice)
+			price = fmt.Sprintf("<code>%s</code>", p.NormalPrice)
+			if p.LocalPrice != "" {
+				price += fmt.Sprintf(" / <code>%s</code>", p.LocalPrice)
 			}
 		}
 		fmt.Fprintf(&msg, "💸 <b>Price:</b> %s\n", price)
 	}
 
-	if rating != "" {
-		fmt.Fprintf(&msg, "⭐ <b>Steam Rating:</b> <code>%s</code>\n", rating)
+	if p.StoreName != "" {
+		fmt.Fprintf(&msg, "🏬 <b>Store:</b> %s\n", html.EscapeString(p.StoreName))
 	}
 
-	fmt.Fprintf(&msg, "<a href='%s'>&#xad;</a>\n", imageURL)
+	if p.Rating != "" {
+		fmt.Fprintf(&msg, "⭐ <b>Steam Rating:</b> <code>%s</code>\n", p.Rating)
+	}
+
+	if image := firstNonEmpty(p.ImageURL, p.StoreIcon); image != "" {
+		fmt.Fprintf(&msg, "<a href='%s'>&#xad;</a>\n", image)
+	}
 	fmt.Fprintf(&msg, "<i>%s</i>", description)
 
 	return msg.String()
 }
 
+// FormatCompactDealMessage renders a deal as a short two-line post without description
+func FormatCompactDealMessage(p DealPost) string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "🎮 <b>%s</b>\n", p.Title)
+	fmt.Fprintf(&msg, "💸 <code>$%s</code> <s>$%s</s>", p.SalePrice, p.NormalPrice)
+	if savings, err := strconv.ParseFloat(p.Savings, 64); err == nil && savings > 0 {
+		fmt.Fprintf(&msg, " (-%.0f%%)", savings)
+	}
+	if p.StoreName != "" {
+		fmt.Fprintf(&msg, " · 🏬 %s", p.StoreName)
+	}
+	if p.Rating != "" {
+		fmt.Fprintf(&msg, " · ⭐ %s", p.Rating)
+	}
+	if image := firstNonEmpty(p.ImageURL, p.StoreIcon); image != "" {
+		fmt.Fprintf(&msg, "<a href='%s'>&#xad;</a>", image)
+	}
+	return msg.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 func FormatMoreDetails(title string, categories, genres []string, metacriticScore int, metacriticURL string, reviewDesc string, pos, neg, total int, mainStory, mainExtra, completionist float32, developers, publishers, platforms []string, releaseDate string) string {
 	var msg strings.Builder
 	msg.Grow(512)
@@ -249,6 +317,186 @@ func FormatSteamUserProfile(personaName, profileURL, avatar string, personaState
 	return msg.String()
 }
 
+// WatchItem is a watched game as shown in a user's watchlist
+type WatchItem struct {
+	AppID       string
+	Title       string
+	TargetPrice float64
+	LastPrice   float64
+}
+
+// FormatWatchlist renders a user's watched games
+func FormatWatchlist(items []WatchItem) string {
+	if len(items) == 0 {
+		return "Your watchlist is empty.\n\nUse <code>/watch appid|name [$price]</code> or the 🔔 Watch button to add games."
+	}
+
+	var msg strings.Builder
+	msg.Grow(64 * len(items))
+	msg.WriteString("🔔 <b>Your Watchlist</b>\n\n")
+
+	for _, item := range items {
+		fmt.Fprintf(&msg, "• <b>%s</b> (<code>%s</code>)\n", html.EscapeString(item.Title), item.AppID)
+		if item.LastPrice > 0 {
+			fmt.Fprintf(&msg, "  Now: <code>$%.2f</code>", item.LastPrice)
+		} else {
+			msg.WriteString("  Now: <code>N/A</code>")
+		}
+		if item.TargetPrice > 0 {
+			fmt.Fprintf(&msg, " · Target: <code>$%.2f</code>", item.TargetPrice)
+		} else {
+			msg.WriteString(" · Target: any drop")
+		}
+		msg.WriteString("\n")
+	}
+
+	return msg.String()
+}
+
+// FormatWatchAlert renders the private message sent when a watched game drops in price
+func FormatWatchAlert(title string, price, retailPrice, historicalLow float64, storeName string, isHistoricalLow bool, steamPrice string) string {
+	var msg strings.Builder
+	msg.Grow(256)
+
+	title = html.EscapeString(title)
+	if isHistoricalLow {
+		fmt.Fprintf(&msg, "🔥 <b>%s</b> is at its lowest price ever!\n\n", title)
+	} else {
+		fmt.Fprintf(&msg, "🔔 <b>%s</b> dropped in price!\n\n", title)
+	}
+
+	fmt.Fprintf(&msg, "💸 <b>Price:</b> <code>$%.2f</code>", price)
+	if retailPrice > price {
+		fmt.Fprintf(&msg, " (was <code>$%.2f</code>, -%.0f%%)", retailPrice, (1-price/retailPrice)*100)
+	}
+	msg.WriteString("\n")
+
+	if storeName != "" {
+		fmt.Fprintf(&msg, "🏬 <b>Store:</b> %s\n", html.EscapeString(storeName))
+	}
+	if historicalLow > 0 {
+		fmt.Fprintf(&msg, "📉 <b>Historical low:</b> <code>$%.2f</code>\n", historicalLow)
+	}
+	if steamPrice != "" {
+		fmt.Fprintf(&msg, "🎮 <b>On Steam:</b> <code>%s</code>\n", steamPrice)
+	}
+
+	return msg.String()
+}
+
+// PriceHistoryRegion summarizes an app's recorded prices in one region
+type PriceHistoryRegion struct {
+	Region        string
+	Currency      string
+	Current       float64
+	Regular       float64
+	Lowest        float64
+	LowestAt      time.Time
+	Average       float64
+	DaysSinceSale int // -1 if never seen on sale
+	Since         time.Time
+}
+
+// FormatPriceHistory renders current vs. all-time-low vs. average prices per region
+func FormatPriceHistory(title string, regions []PriceHistoryRegion) string {
+	var msg strings.Builder
+	msg.Grow(256 * (len(regions) + 1))
+	fmt.Fprintf(&msg, "📈 <b>%s - Price History</b>\n\n", title)
+
+	if len(regions) == 0 {
+		msg.WriteString("No prices recorded yet. Check back later!")
+		return msg.String()
+	}
+
+	for _, r := range regions {
+		fmt.Fprintf(&msg, "🌍 <b>%s</b> (%s)\n", strings.ToUpper(r.Region), r.Currency)
+		fmt.Fprintf(&msg, "• Current: <code>%.2f</code>", r.Current)
+		if r.Regular > r.Current {
+			fmt.Fprintf(&msg, " (-%.0f%%)", (1-r.Current/r.Regular)*100)
+		}
+		msg.WriteString("\n")
+		fmt.Fprintf(&msg, "• Lowest: <code>%.2f</code> on %s\n", r.Lowest, r.LowestAt.Format("02 Jan 2006"))
+		fmt.Fprintf(&msg, "• Average: <code>%.2f</code>\n", r.Average)
+
+		switch {
+		case r.DaysSinceSale < 0:
+			msg.WriteString("• Not seen on sale yet\n")
+		case r.DaysSinceSale == 0:
+			msg.WriteString("• On sale now\n")
+		default:
+			fmt.Fprintf(&msg, "• Last sale: %d days ago\n", r.DaysSinceSale)
+		}
+
+		if r.Current <= r.Lowest {
+			msg.WriteString("🔥 <i>This is the lowest price seen!</i>\n")
+		}
+		msg.WriteString("\n")
+	}
+
+	fmt.Fprintf(&msg, "<i>Tracking since %s</i>", regions[0].Since.Format("02 Jan 2006"))
+	return msg.String()
+}
+
+// RegionalPriceRow is one country's price for the regional comparison table
+type RegionalPriceRow struct {
+	Region       string
+	Available    bool
+	Native       string  // formatted price in local currency
+	Converted    float64 // price in the base currency
+	HasConverted bool
+	Discount     int
+}
+
+// FormatRegionalPrices renders a table of regional prices sorted from cheapest in the base currency
+func FormatRegionalPrices(title, baseCurrency string, rows []RegionalPriceRow) string {
+	var msg strings.Builder
+	msg.Grow(64 * (len(rows) + 2))
+	fmt.Fprintf(&msg, "🌍 <b>%s - Regional Prices</b>\n\n", title)
+
+	if len(rows) == 0 {
+		msg.WriteString("Regional prices are unavailable right now.")
+		return msg.String()
+	}
+
+	sorted := slices.Clone(rows)
+	slices.SortStableFunc(sorted, func(a, b RegionalPriceRow) int {
+		switch {
+		case a.HasConverted && b.HasConverted:
+			return cmp.Compare(a.Converted, b.Converted)
+		case a.HasConverted:
+			return -1
+		case b.HasConverted:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	msg.WriteString("<pre>")
+	for i, r := range sorted {
+		region := strings.ToUpper(r.Region)
+		if !r.Available {
+			fmt.Fprintf(&msg, "%-3s %-14s\n", region, "N/A")
+			continue
+		}
+
+		line := fmt.Sprintf("%-3s %-14s", region, r.Native)
+		if r.HasConverted {
+			line += fmt.Sprintf(" ≈ %9.2f %s", r.Converted, strings.ToUpper(baseCurrency))
+		}
+		if r.Discount > 0 {
+			line += fmt.Sprintf(" -%d%%", r.Discount)
+		}
+		if i == 0 && r.HasConverted {
+			line += " ⭐"
+		}
+		msg.WriteString(line + "\n")
+	}
+	msg.WriteString("</pre>")
+
+	return msg.String()
+}
+
 func personaStateToString(state int) string {
 	switch state {
 	case 0:
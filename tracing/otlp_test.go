@@ -0,0 +1,262 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"steam_bot/metrics"
+)
+
+// collector is a fake OTLP/HTTP endpoint that keeps every request it decodes
+type collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	requests []otlpRequest
+	headers  []http.Header
+}
+
+func startCollector(t *testing.T, status int) *collector {
+	t.Helper()
+
+	c := &collector{status: status}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding export: %v", err)
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.requests = append(c.requests, req)
+		c.headers = append(c.headers, r.Header.Clone())
+		w.WriteHeader(c.status)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// spans returns the spans of every export, in the order they arrived
+func (c *collector) spans() [][]otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var batches [][]otlpSpan
+	for _, req := range c.requests {
+		var batch []otlpSpan
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				batch = append(batch, ss.Spans...)
+			}
+		}
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// setup enables tracing against c and shuts it down when the test ends
+func setup(t *testing.T, c *collector, sampleRatio float64) *Exporter {
+	t.Helper()
+
+	e, err := Setup(Config{
+		Endpoint:    c.URL + "/v1/traces",
+		Headers:     map[string]string{"Authorization": "Bearer test"},
+		ServiceName: "steam_bot_test",
+		SampleRatio: sampleRatio,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = e.Shutdown(context.Background()) })
+	return e
+}
+
+func shutdown(t *testing.T, e *Exporter) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExportEncodesSpans(t *testing.T) {
+	c := startCollector(t, http.StatusOK)
+	e := setup(t, c, 1)
+
+	ctx, parent := Start(context.Background(), "parent", String("app_id", "620"))
+	_, child := Start(ctx, "child")
+	child.SetKind(KindClient)
+	child.SetAttributes(Int("deals", 3), Float("ratio", 0.5), Bool("cached", true))
+	child.Finish(errors.New("upstream failed"))
+	parent.End()
+	shutdown(t, e)
+
+	batches := c.spans()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("exported %v, want one batch of two spans", batches)
+	}
+	gotChild, gotParent := batches[0][0], batches[0][1]
+
+	hexID := regexp.MustCompile(`^[0-9a-f]+$`)
+	if len(gotParent.TraceID) != 32 || !hexID.MatchString(gotParent.TraceID) || len(gotParent.SpanID) != 16 {
+		t.Errorf("parent IDs = %q, %q; want 16 and 8 hex bytes", gotParent.TraceID, gotParent.SpanID)
+	}
+	if gotParent.ParentSpanID != "" || gotParent.Kind != KindInternal || gotParent.Status != (otlpStatus{}) {
+		t.Errorf("parent = %+v, want an internal root span with no status", gotParent)
+	}
+	if gotChild.TraceID != gotParent.TraceID || gotChild.ParentSpanID != gotParent.SpanID {
+		t.Errorf("child = %+v, want it in the parent's trace under the parent", gotChild)
+	}
+	if gotChild.Kind != KindClient || gotChild.Status != (otlpStatus{Code: statusError, Message: "upstream failed"}) {
+		t.Errorf("child kind, status = %d, %+v; want a failed client span", gotChild.Kind, gotChild.Status)
+	}
+	start, _ := strconv.ParseInt(gotChild.StartTimeUnixNano, 10, 64)
+	end, _ := strconv.ParseInt(gotChild.EndTimeUnixNano, 10, 64)
+	if start == 0 || end < start {
+		t.Errorf("child times = %s to %s", gotChild.StartTimeUnixNano, gotChild.EndTimeUnixNano)
+	}
+
+	attrs := map[string]map[string]any{}
+	for _, kv := range gotChild.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	want := map[string]map[string]any{
+		"deals":  {"intValue": "3"},
+		"ratio":  {"doubleValue": 0.5},
+		"cached": {"boolValue": true},
+	}
+	for key, value := range want {
+		if got := attrs[key]; !reflect.DeepEqual(got, value) {
+			t.Errorf("attribute %s = %v, want %v", key, got, value)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resource := c.requests[0].ResourceSpans[0].Resource
+	if len(resource.Attributes) != 1 || resource.Attributes[0].Value["stringValue"] != "steam_bot_test" {
+		t.Errorf("resource = %+v, want the service name", resource)
+	}
+	if h := c.headers[0]; h.Get("Authorization") != "Bearer test" || h.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v, want the configured ones and JSON", h)
+	}
+}
+
+func TestSamplingDecidesPerTrace(t *testing.T) {
+	c := startCollector(t, http.StatusOK)
+	e := setup(t, c, 0)
+
+	ctx, root := Start(context.Background(), "root")
+	if root != nil {
+		t.Fatal("root span recorded with a sample ratio of 0")
+	}
+	if _, child := Start(ctx, "child"); child != nil {
+		t.Error("child of an unsampled trace was recorded")
+	}
+	root.End()
+	shutdown(t, e)
+
+	if batches := c.spans(); len(batches) != 0 {
+		t.Errorf("exported %v, want nothing", batches)
+	}
+}
+
+func TestExportBatchesSpans(t *testing.T) {
+	c := startCollector(t, http.StatusOK)
+	e := setup(t, c, 1)
+
+	for range exportBatchSize + 1 {
+		_, span := Start(context.Background(), "span")
+		span.End()
+	}
+	shutdown(t, e)
+
+	batches := c.spans()
+	if len(batches) != 2 || len(batches[0]) != exportBatchSize || len(batches[1]) != 1 {
+		sizes := make([]int, len(batches))
+		for i, b := range batches {
+			sizes[i] = len(b)
+		}
+		t.Errorf("batch sizes = %v, want [%d 1]", sizes, exportBatchSize)
+	}
+}
+
+func TestShutdownFlushesPendingSpans(t *testing.T) {
+	c := startCollector(t, http.StatusOK)
+	e := setup(t, c, 1)
+
+	_, span := Start(context.Background(), "pending")
+	span.End()
+	// Well before exportInterval, so only Shutdown can have sent it
+	shutdown(t, e)
+
+	if batches := c.spans(); len(batches) != 1 || len(batches[0]) != 1 || batches[0][0].Name != "pending" {
+		t.Errorf("exported %v, want the pending span", batches)
+	}
+	if _, after := Start(context.Background(), "after"); after != nil {
+		t.Error("span recorded after Shutdown")
+	}
+}
+
+func TestFailedExportsAreCounted(t *testing.T) {
+	c := startCollector(t, http.StatusInternalServerError)
+	e := setup(t, c, 1)
+
+	before := droppedSpans(t, "export_failed")
+	for range 3 {
+		_, span := Start(context.Background(), "span")
+		span.End()
+	}
+	shutdown(t, e)
+
+	if len(c.spans()) != 1 {
+		t.Fatalf("made %d exports, want one", len(c.spans()))
+	}
+	if dropped := droppedSpans(t, "export_failed") - before; dropped != 3 {
+		t.Errorf("dropped %v spans, want 3", dropped)
+	}
+}
+
+// droppedSpans reads the dropped span counter for reason from the default registry
+func droppedSpans(t *testing.T, reason string) float64 {
+	t.Helper()
+
+	var out strings.Builder
+	if err := metrics.Default.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	prefix := `steam_bot_trace_spans_dropped_total{reason="` + reason + `"} `
+	for line := range strings.Lines(out.String()) {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), prefix); ok {
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+func TestSetupRejectsInvalidEndpoints(t *testing.T) {
+	for _, endpoint := range []string{"localhost:4318", "ftp://collector/v1/traces", "://"} {
+		if e, err := Setup(Config{Endpoint: endpoint}); err == nil {
+			_ = e.Shutdown(context.Background())
+			t.Errorf("Setup(%q) succeeded, want an error", endpoint)
+		}
+	}
+	if e, err := Setup(Config{}); e != nil || err != nil {
+		t.Errorf("Setup without an endpoint = %v, %v; want tracing left off", e, err)
+	}
+}
@@ -0,0 +1,205 @@
+// Package tracing records spans and exports them to an OpenTelemetry collector over
+// OTLP/HTTP. Until Setup enables it, Start returns a nil *Span, whose methods do
+// nothing, so instrumented code costs little more than the call.
+//
+// Traces start in this process: nothing the bot receives carries a trace context.
+// Outgoing requests pass theirs on in a W3C traceparent header (see Inject), so
+// upstreams that trace can attach their spans to the bot's.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mathrand "math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ----- Spans -----
+
+// Span kinds, as numbered by OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// statusError is OTLP's status code for a failed span; unset is zero
+const statusError = 2
+
+// Attr is a span attribute
+type Attr struct {
+	Key   string
+	Value any // string, int64, float64 or bool
+}
+
+// String returns a string attribute
+func String(key, value string) Attr { return Attr{Key: key, Value: value} }
+
+// Int returns an integer attribute
+func Int(key string, value int64) Attr { return Attr{Key: key, Value: value} }
+
+// Float returns a floating-point attribute
+func Float(key string, value float64) Attr { return Attr{Key: key, Value: value} }
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attr { return Attr{Key: key, Value: value} }
+
+// Span is one timed operation in a trace. A nil *Span is valid and records nothing.
+type Span struct {
+	tracer   *tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // zero for a root span
+	sampled  bool    // false for the marker of an unsampled trace
+
+	name  string
+	kind  int
+	start time.Time
+
+	mu            sync.Mutex
+	end           time.Time
+	attrs         []Attr
+	statusCode    int
+	statusMessage string
+}
+
+// IsRecording reports whether the span is being recorded, so callers can skip
+// computing attributes otherwise
+func (s *Span) IsRecording() bool {
+	return s != nil && s.sampled
+}
+
+// TraceID returns the span's trace ID in hex, or "" if it isn't recording
+func (s *Span) TraceID() string {
+	if !s.IsRecording() {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SetAttributes adds attrs to the span
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// SetKind sets the span kind, KindInternal by default
+func (s *Span) SetKind(kind int) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kind = kind
+}
+
+// RecordError marks the span failed with err; a nil err is ignored
+func (s *Span) RecordError(err error) {
+	if err == nil || !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusCode = statusError
+	s.statusMessage = err.Error()
+}
+
+// End finishes the span and queues it for export. Calls after the first are ignored.
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.exporter.enqueue(s)
+}
+
+// Finish records err, if any, and ends the span, for deferring with a named error result
+func (s *Span) Finish(err error) {
+	s.RecordError(err)
+	s.End()
+}
+
+// ----- Starting Spans -----
+
+// tracer creates spans for an exporter
+type tracer struct {
+	exporter    *Exporter
+	sampleRatio float64
+}
+
+// active is the tracer Start uses; nil while tracing is disabled
+var active atomic.Pointer[tracer]
+
+type spanKey struct{}
+
+// SpanFromContext returns the span started by the Start call that returned ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start begins a span named name as a child of the span in ctx, if any, and returns
+// a context carrying it. End the span when the operation finishes.
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	t := active.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, name: name, kind: KindInternal, start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		if !parent.sampled {
+			return ctx, nil
+		}
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+		span.sampled = true
+	} else {
+		span.sampled = t.sampleRatio >= 1 || mathrand.Float64() < t.sampleRatio
+		_, _ = rand.Read(span.traceID[:])
+		if !span.sampled {
+			// Mark the trace so its descendants aren't sampled on their own. The
+			// marker has IDs so upstreams are told not to sample it either.
+			_, _ = rand.Read(span.spanID[:])
+			return context.WithValue(ctx, spanKey{}, span), nil
+		}
+	}
+	_, _ = rand.Read(span.spanID[:])
+	span.attrs = attrs
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// ----- Propagation -----
+
+// traceparentHeader carries the trace context of a request, as defined by W3C Trace Context
+const traceparentHeader = "traceparent"
+
+// Inject sets the traceparent header of an outgoing request to the trace in ctx, with
+// the span in ctx as the parent. Headers are left alone if ctx has no trace.
+func Inject(ctx context.Context, header http.Header) {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return
+	}
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	header.Set(traceparentHeader, "00-"+hex.EncodeToString(s.traceID[:])+"-"+hex.EncodeToString(s.spanID[:])+"-"+flags)
+}
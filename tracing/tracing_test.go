@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestInjectSetsTraceparent(t *testing.T) {
+	traceparent := regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-(0[01])$`)
+
+	for _, tt := range []struct {
+		name        string
+		sampleRatio float64
+		wantFlags   string
+	}{
+		{"sampled", 1, "01"},
+		{"not sampled", 0, "00"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := setup(t, startCollector(t, http.StatusOK), tt.sampleRatio)
+			defer shutdown(t, e)
+
+			ctx, span := Start(context.Background(), "request")
+			defer span.End()
+
+			header := http.Header{}
+			Inject(ctx, header)
+			m := traceparent.FindStringSubmatch(header.Get("traceparent"))
+			if m == nil || m[3] != tt.wantFlags {
+				t.Fatalf("traceparent = %q, want flags %s", header.Get("traceparent"), tt.wantFlags)
+			}
+			if span.IsRecording() {
+				if spanID := hex.EncodeToString(span.spanID[:]); m[1] != span.TraceID() || m[2] != spanID {
+					t.Errorf("traceparent = %q, want trace %s under span %s", m[0], span.TraceID(), spanID)
+				}
+			}
+
+			// Children of an unsampled trace carry its decision on
+			childCtx, _ := Start(ctx, "child")
+			child := http.Header{}
+			Inject(childCtx, child)
+			if got := traceparent.FindStringSubmatch(child.Get("traceparent")); got == nil || got[1] != m[1] || got[3] != tt.wantFlags {
+				t.Errorf("child traceparent = %q, want trace %s with flags %s", child.Get("traceparent"), m[1], tt.wantFlags)
+			}
+		})
+	}
+}
+
+func TestInjectWithoutTraceLeavesHeaders(t *testing.T) {
+	header := http.Header{}
+	Inject(context.Background(), header)
+	if len(header) != 0 {
+		t.Errorf("headers = %v, want none without a trace", header)
+	}
+}
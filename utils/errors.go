@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error kinds for failed upstream requests, matched with errors.Is
+var (
+	ErrRateLimited  = errors.New("rate limited")
+	ErrNotFound     = errors.New("not found")
+	ErrUpstreamDown = errors.New("upstream unavailable")
+)
+
+// HTTPError describes a failed upstream request
+type HTTPError struct {
+	URL        string        // with credentials masked, see redactURL
+	StatusCode int           // 0 if no response was received
+	RetryAfter time.Duration // from the Retry-After header, 0 if absent
+	Kind       error         // one of the Err* kinds above, nil for other permanent failures
+	Cause      error         // transport error, if any
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("request to %s failed", e.URL)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" with status %d", e.StatusCode)
+	}
+	if e.Kind != nil {
+		msg += " (" + e.Kind.Error() + ")"
+	}
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Cause != nil {
+		errs = append(errs, e.Cause)
+	}
+	return errs
+}
+
+// retryable reports whether the request may succeed if sent again
+func (e *HTTPError) retryable() bool {
+	return e.Kind == ErrRateLimited || e.Kind == ErrUpstreamDown
+}
+
+// statusError classifies a non-200 response
+func statusError(url string, resp *http.Response) *HTTPError {
+	e := &HTTPError{URL: url, StatusCode: resp.StatusCode}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		e.Kind = ErrNotFound
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		e.Kind = ErrUpstreamDown
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return e
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status     int
+		retryAfter string
+		wantKind   error
+		wantRetry  bool
+		wantWait   time.Duration
+	}{
+		{http.StatusTooManyRequests, "7", ErrRateLimited, true, 7 * time.Second},
+		{http.StatusTooManyRequests, "", ErrRateLimited, true, 0},
+		{http.StatusNotFound, "", ErrNotFound, false, 0},
+		{http.StatusGone, "", ErrNotFound, false, 0},
+		{http.StatusRequestTimeout, "", ErrUpstreamDown, true, 0},
+		{http.StatusInternalServerError, "", ErrUpstreamDown, true, 0},
+		{http.StatusServiceUnavailable, "30", ErrUpstreamDown, true, 30 * time.Second},
+		{http.StatusBadRequest, "", nil, false, 0},
+		{http.StatusForbidden, "5", nil, false, 0},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+		if tt.retryAfter != "" {
+			resp.Header.Set("Retry-After", tt.retryAfter)
+		}
+
+		err := statusError("https://example.com/api", resp)
+		if err.Kind != tt.wantKind || err.retryable() != tt.wantRetry || err.RetryAfter != tt.wantWait {
+			t.Errorf("status %d: kind %v, retryable %t, retry after %s; want %v, %t, %s",
+				tt.status, err.Kind, err.retryable(), err.RetryAfter, tt.wantKind, tt.wantRetry, tt.wantWait)
+		}
+		if tt.wantKind != nil && !errors.Is(err, tt.wantKind) {
+			t.Errorf("status %d: errors.Is(%v, %v) = false", tt.status, err, tt.wantKind)
+		}
+	}
+}
+
+func TestHTTPErrorUnwrapsKindAndCause(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := error(&HTTPError{URL: "https://example.com", Kind: ErrUpstreamDown, Cause: cause})
+
+	if !errors.Is(err, ErrUpstreamDown) || !errors.Is(err, cause) || errors.Is(err, ErrNotFound) {
+		t.Errorf("%v does not match exactly its kind and cause", err)
+	}
+	if want := "request to https://example.com failed (upstream unavailable): connection refused"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"":                              0,
+		"0":                             0,
+		"120":                           2 * time.Minute,
+		"-5":                            0,
+		"soon":                          0,
+		"Thu, 01 Jan 2026 12:00:30 GMT": 30 * time.Second,
+		"Thu, 01 Jan 2026 11:59:00 GMT": 0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"steam_bot/tracing"
+)
+
+// ----- HTTP Client -----
+
+// Client fetches JSON from upstream APIs, retrying rate-limited and failed
+// requests with jittered exponential backoff
+type Client struct {
+	http          *http.Client
+	maxAttempts   int
+	baseDelay     time.Duration
+	maxDelay      time.Duration
+	maxRetryAfter time.Duration
+	limiters      map[string]*Limiter // by host
+}
+
+// ClientOption is a functional option for configuring the client
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the underlying http.Client
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithMaxAttempts sets how many times a request is sent before giving up
+func WithMaxAttempts(n int) ClientOption {
+	return func(c *Client) {
+		c.maxAttempts = max(n, 1)
+	}
+}
+
+// WithBackoff sets the initial and maximum delay between attempts
+func WithBackoff(base, maxDelay time.Duration) ClientOption {
+	return func(c *Client) {
+		c.baseDelay = base
+		c.maxDelay = maxDelay
+	}
+}
+
+// WithMaxRetryAfter sets the longest Retry-After the client will wait out;
+// longer ones are returned to the caller straight away
+func WithMaxRetryAfter(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.maxRetryAfter = d
+	}
+}
+
+// WithRateLimit makes every request to host wait for a token from l
+func WithRateLimit(host string, l *Limiter) ClientOption {
+	return func(c *Client) {
+		c.limiters[host] = l
+	}
+}
+
+// NewClient creates a new client with the given options
+func NewClient(opts ...ClientOption) *Client {
+	client := &Client{
+		http:          &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:   3,
+		baseDelay:     500 * time.Millisecond,
+		maxDelay:      8 * time.Second,
+		maxRetryAfter: 30 * time.Second,
+		limiters:      make(map[string]*Limiter),
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
+}
+
+// DefaultClient is used by GetJSON
+var DefaultClient = NewClient()
+
+// GetJSON fetches rawURL with DefaultClient and decodes the JSON response into target
+func GetJSON(ctx context.Context, rawURL string, target any) error {
+	return DefaultClient.GetJSON(ctx, rawURL, target)
+}
+
+// GetJSON fetches rawURL and decodes the JSON response into target. Failed requests
+// are returned as *HTTPError, which matches ErrRateLimited, ErrNotFound or
+// ErrUpstreamDown with errors.Is. Requests to rate-limited hosts first wait for
+// a token at the priority set on ctx with WithPriority.
+func (c *Client) GetJSON(ctx context.Context, rawURL string, target any) error {
+	limiter := c.limiterFor(rawURL)
+
+	for attempt := 1; ; attempt++ {
+		if limiter != nil {
+			if err := limiter.Wait(ctx, PriorityFrom(ctx)); err != nil {
+				return fmt.Errorf("waiting to fetch %s: %w", redactURL(rawURL), err)
+			}
+		}
+
+		err := c.get(ctx, rawURL, target)
+		if err == nil {
+			return nil
+		}
+
+		var httpErr *HTTPError
+		if limiter != nil && errors.As(err, &httpErr) && httpErr.Kind == ErrRateLimited {
+			// Slow every caller down, not just this one
+			limiter.Drain()
+		}
+		if !errors.As(err, &httpErr) || !httpErr.retryable() || attempt >= c.maxAttempts {
+			return err
+		}
+		if httpErr.RetryAfter > c.maxRetryAfter {
+			return err
+		}
+
+		delay := c.backoff(attempt)
+		if httpErr.RetryAfter > 0 {
+			delay = httpErr.RetryAfter
+		}
+		slog.WarnContext(ctx, "Retrying upstream request", "host", urlHost(rawURL), "status", httpErr.StatusCode, "attempt", attempt, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// limiterFor returns the limiter for rawURL's host, or nil if it isn't rate limited
+func (c *Client) limiterFor(rawURL string) *Limiter {
+	return c.limiters[urlHost(rawURL)]
+}
+
+// urlHost returns rawURL's host, or "" if it doesn't parse
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// secretParams are query parameters carrying credentials, such as the Steam Web API key
+var secretParams = []string{"key", "access_token", "token"}
+
+// redactURL returns rawURL with the values of credential query parameters masked,
+// so it can go into errors and logs
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		before, _, _ := strings.Cut(rawURL, "?")
+		return before
+	}
+
+	query := u.Query()
+	redacted := false
+	for _, name := range secretParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if redacted {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// redactURLError masks credentials in the URL the http package puts in its errors
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactURL(urlErr.URL)
+	}
+	return err
+}
+
+// get sends a single request. Errors only carry the URL with credentials masked.
+func (c *Client) get(ctx context.Context, rawURL string, target any) (err error) {
+	ctx, span := tracing.Start(ctx, "HTTP GET")
+	defer func() { span.Finish(err) }()
+
+	safeURL := redactURL(rawURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("building request for %s: %w", safeURL, redactURLError(err))
+	}
+	if span.IsRecording() {
+		// The query is left out since it may carry an API key
+		span.SetKind(tracing.KindClient)
+		span.SetAttributes(tracing.String("server.address", req.URL.Host), tracing.String("url.path", req.URL.Path))
+	}
+	tracing.Inject(ctx, req.Header)
+
+	// As in the span, the query is left out of log lines
+	logAttrs := []any{"host", req.URL.Host, "path", req.URL.Path}
+
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// Cancellation is the caller's doing, not the upstream's
+		if ctx.Err() != nil {
+			return fmt.Errorf("fetching %s: %w", safeURL, ctx.Err())
+		}
+		ObserveUpstream(req.URL.Host, "error", start)
+		slog.DebugContext(ctx, "Upstream request failed", append(logAttrs, "duration", time.Since(start))...)
+		return &HTTPError{URL: safeURL, Kind: ErrUpstreamDown, Cause: redactURLError(err)}
+	}
+	defer resp.Body.Close()
+	ObserveUpstream(req.URL.Host, strconv.Itoa(resp.StatusCode), start)
+	span.SetAttributes(tracing.Int("http.response.status_code", int64(resp.StatusCode)))
+	slog.DebugContext(ctx, "Upstream request", append(logAttrs, "status", resp.StatusCode, "duration", time.Since(start))...)
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(safeURL, resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("decoding response from %s: %w", safeURL, err)
+	}
+	return nil
+}
+
+// backoff returns the delay before retrying after the given attempt: a random
+// duration between half and all of baseDelay doubled per attempt, capped at maxDelay
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.baseDelay << (attempt - 1)
+	if delay <= 0 || delay > c.maxDelay {
+		delay = c.maxDelay
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"steam_bot/tracing"
+)
+
+// sequenceServer answers the nth request with responses[n], repeating the last one,
+// and counts the requests it got
+func sequenceServer(t *testing.T, responses ...func(http.ResponseWriter)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := int(requests.Add(1)) - 1
+		responses[min(n, len(responses)-1)](w)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func respondJSON(body string) func(http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func respondStatus(status int, retryAfter string) func(http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+	}
+}
+
+// fastClient retries without noticeable backoff
+func fastClient(opts ...ClientOption) *Client {
+	return NewClient(append([]ClientOption{WithBackoff(time.Millisecond, 2*time.Millisecond)}, opts...)...)
+}
+
+func TestGetJSONDecodesResponse(t *testing.T) {
+	srv, requests := sequenceServer(t, respondJSON(`{"name":"Portal 2"}`))
+
+	var got struct{ Name string }
+	if err := fastClient().GetJSON(context.Background(), srv.URL, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Portal 2" || requests.Load() != 1 {
+		t.Errorf("got %+v after %d requests, want Portal 2 after 1", got, requests.Load())
+	}
+}
+
+func TestGetJSONRetriesServerErrors(t *testing.T) {
+	srv, requests := sequenceServer(t,
+		respondStatus(http.StatusServiceUnavailable, ""),
+		respondStatus(http.StatusBadGateway, ""),
+		respondJSON(`{"ok":true}`),
+	)
+
+	var got struct{ Ok bool }
+	if err := fastClient().GetJSON(context.Background(), srv.URL, &got); err != nil {
+		t.Fatalf("GetJSON = %v, want success on the third attempt", err)
+	}
+	if !got.Ok || requests.Load() != 3 {
+		t.Errorf("got %+v after %d requests, want ok after 3", got, requests.Load())
+	}
+}
+
+func TestGetJSONGivesUpAfterMaxAttempts(t *testing.T) {
+	srv, requests := sequenceServer(t, respondStatus(http.StatusInternalServerError, ""))
+
+	err := fastClient(WithMaxAttempts(2)).GetJSON(context.Background(), srv.URL, &struct{}{})
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusInternalServerError || !errors.Is(err, ErrUpstreamDown) {
+		t.Errorf("GetJSON = %v, want a 500 *HTTPError matching ErrUpstreamDown", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
+
+func TestGetJSONDoesNotRetryNotFound(t *testing.T) {
+	srv, requests := sequenceServer(t, respondStatus(http.StatusNotFound, ""), respondJSON(`{}`))
+
+	err := fastClient().GetJSON(context.Background(), srv.URL, &struct{}{})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetJSON = %v, want ErrNotFound", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestGetJSONDoesNotRetryClientErrors(t *testing.T) {
+	srv, requests := sequenceServer(t, respondStatus(http.StatusForbidden, ""), respondJSON(`{}`))
+
+	err := fastClient().GetJSON(context.Background(), srv.URL, &struct{}{})
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusForbidden || httpErr.Kind != nil {
+		t.Errorf("GetJSON = %v, want a 403 *HTTPError of no kind", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestGetJSONWaitsOutRetryAfter(t *testing.T) {
+	srv, requests := sequenceServer(t, respondStatus(http.StatusTooManyRequests, "1"), respondJSON(`{}`))
+
+	start := time.Now()
+	if err := fastClient().GetJSON(context.Background(), srv.URL, &struct{}{}); err != nil {
+		t.Fatalf("GetJSON = %v, want success after the rate limit", err)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("retried after %s, want the 1s Retry-After honored", waited)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("sent %d requests, want 2", n)
+	}
+}
+
+func TestGetJSONReturnsLongRetryAfter(t *testing.T) {
+	srv, requests := sequenceServer(t, respondStatus(http.StatusTooManyRequests, "120"), respondJSON(`{}`))
+
+	start := time.Now()
+	err := fastClient(WithMaxRetryAfter(time.Minute)).GetJSON(context.Background(), srv.URL, &struct{}{})
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || !errors.Is(err, ErrRateLimited) || httpErr.RetryAfter != 2*time.Minute {
+		t.Errorf("GetJSON = %v, want ErrRateLimited with a 2m Retry-After", err)
+	}
+	if n := requests.Load(); n != 1 || time.Since(start) > time.Second {
+		t.Errorf("sent %d requests in %s, want 1 without waiting", n, time.Since(start))
+	}
+}
+
+func TestGetJSONReportsUnreachableHost(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	err := fastClient(WithMaxAttempts(2)).GetJSON(context.Background(), srv.URL, &struct{}{})
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != 0 || httpErr.Cause == nil || !errors.Is(err, ErrUpstreamDown) {
+		t.Errorf("GetJSON = %v, want ErrUpstreamDown with the transport error", err)
+	}
+}
+
+func TestGetJSONStopsRetryingWhenCancelled(t *testing.T) {
+	srv, requests := sequenceServer(t, respondStatus(http.StatusServiceUnavailable, ""))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := NewClient(WithBackoff(time.Hour, time.Hour))
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := client.GetJSON(ctx, srv.URL, &struct{}{})
+	if !errors.Is(err, ErrUpstreamDown) {
+		t.Errorf("GetJSON = %v, want the last ErrUpstreamDown", err)
+	}
+	if n := requests.Load(); n != 1 || time.Since(start) > 5*time.Second {
+		t.Errorf("sent %d requests in %s, want 1 before cancellation", n, time.Since(start))
+	}
+}
+
+func TestGetJSONErrorsHideAPIKey(t *testing.T) {
+	const secret = "0123456789ABCDEF"
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := map[string]struct {
+		respond func(http.ResponseWriter)
+		baseURL string
+	}{
+		"status":      {respond: respondStatus(http.StatusForbidden, "")},
+		"bad json":    {respond: respondJSON(`{`)},
+		"unreachable": {baseURL: down.URL},
+	}
+	for name, tt := range tests {
+		baseURL := tt.baseURL
+		if baseURL == "" {
+			srv, _ := sequenceServer(t, tt.respond)
+			baseURL = srv.URL
+		}
+
+		err := fastClient(WithMaxAttempts(1)).GetJSON(context.Background(), baseURL+"/ISteamUser/GetPlayerSummaries/v0002/?key="+secret+"&steamids=1", &struct{}{})
+		if err == nil {
+			t.Fatalf("%s: GetJSON succeeded, want an error", name)
+		}
+		if strings.Contains(err.Error(), secret) || !strings.Contains(err.Error(), "key=REDACTED") {
+			t.Errorf("%s: error %q leaks the API key", name, err)
+		}
+	}
+}
+
+func TestGetJSONPropagatesTrace(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer collector.Close()
+	exporter, err := tracing.Setup(tracing.Config{Endpoint: collector.URL, SampleRatio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Shutdown(context.Background())
+
+	var traceparent atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent.Store(r.Header.Get("traceparent"))
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	ctx, span := tracing.Start(context.Background(), "test")
+	defer span.End()
+	var got struct{}
+	if err := NewClient().GetJSON(ctx, srv.URL, &got); err != nil {
+		t.Fatal(err)
+	}
+	if header, _ := traceparent.Load().(string); !strings.HasPrefix(header, "00-"+span.TraceID()+"-") {
+		t.Errorf("traceparent = %q, want one in trace %s", header, span.TraceID())
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	tests := map[string]string{
+		"https://api.steampowered.com/x/?key=abc&steamid=1":        "https://api.steampowered.com/x/?key=REDACTED&steamid=1",
+		"https://store.steampowered.com/api/appdetails?appids=620": "https://store.steampowered.com/api/appdetails?appids=620",
+		"https://example.com/%zz?key=abc":                          "https://example.com/%zz",
+	}
+	for rawURL, want := range tests {
+		if got := redactURL(rawURL); got != want {
+			t.Errorf("redactURL(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := NewClient(WithBackoff(100*time.Millisecond, time.Second))
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 70: time.Second} {
+		for range 20 {
+			if d := c.backoff(attempt); d < want/2 || d > want {
+				t.Errorf("backoff(%d) = %s, want between %s and %s", attempt, d, want/2, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// ----- Logging -----
+
+// Attribute keys shared by every package's log lines
+const (
+	LogKeyUpdateID     = "update_id"
+	LogKeyUserID       = "user_id"
+	LogKeyChatID       = "chat_id"
+	LogKeyCallbackType = "callback_type"
+	LogKeyAppID        = "app_id"
+	LogKeyTraceID      = "trace_id"
+)
+
+// Log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// NewLogger creates a logger writing lines at level or above to w in the given
+// format. Lines logged with a context carry the attributes added to it with WithLogAttrs.
+func NewLogger(w io.Writer, level slog.Leveler, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case LogFormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (expected %s or %s)", format, LogFormatJSON, LogFormatText)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// ParseLogLevel parses debug, info, warn or error, optionally with an offset such as "info+2"
+func ParseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("parsing log level: %w", err)
+	}
+	return level, nil
+}
+
+type logAttrsKey struct{}
+
+// WithLogAttrs returns a context whose log lines also carry attrs, such as the update
+// being handled. Attributes added to a context it was derived from come first.
+func WithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(slices.Clip(existing), attrs...))
+}
+
+// LogAttrs returns the attributes added to ctx with WithLogAttrs
+func LogAttrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// contextHandler adds the attributes carried by a record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := LogAttrs(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ----- Rate Limiting -----
+
+// Priority orders requests competing for the same upstream
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // a user is waiting for the result
+	PriorityBackground                  // scheduled jobs such as deal polling
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose requests are limited with priority p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority set by WithPriority, defaulting to interactive
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityInteractive
+}
+
+// Limiter is a token bucket shared by every request to one upstream. Background
+// requests leave a quarter of the bucket for interactive ones and don't start
+// while an interactive request is waiting, so users are served first.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	reserve float64 // tokens background requests must leave in the bucket
+	tokens  float64
+	last    time.Time
+
+	interactiveWaiting int
+	idle               chan struct{} // closed when no interactive request is waiting
+}
+
+// NewLimiter creates a limiter allowing perSecond requests on average and bursts of up to burst
+func NewLimiter(perSecond float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    perSecond,
+		burst:   float64(burst),
+		reserve: float64(burst) / 4,
+		tokens:  float64(burst),
+		last:    time.Now(),
+		idle:    make(chan struct{}),
+	}
+}
+
+// Wait blocks until a request with priority p may be sent or ctx is done
+func (l *Limiter) Wait(ctx context.Context, p Priority) error {
+	interactive := p == PriorityInteractive
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if interactive {
+		l.interactiveWaiting++
+		defer l.leaveInteractive()
+	}
+
+	for {
+		l.refill(time.Now())
+
+		need := 1.0
+		if !interactive {
+			need += l.reserve
+		}
+		if (interactive || l.interactiveWaiting == 0) && l.tokens >= need {
+			l.tokens--
+			return nil
+		}
+
+		// Background requests re-check once the interactive queue drains
+		var wake <-chan struct{}
+		delay := time.Duration((need - l.tokens) / l.rate * float64(time.Second))
+		if !interactive && l.interactiveWaiting > 0 {
+			wake = l.idle
+			delay = max(delay, time.Duration(float64(time.Second)/l.rate))
+		}
+
+		l.mu.Unlock()
+		err := sleepOrWake(ctx, delay, wake)
+		l.mu.Lock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Drain empties the bucket, e.g. after the upstream reported a rate limit
+func (l *Limiter) Drain() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.tokens = 0
+}
+
+// refill adds the tokens accrued since the last call (must be called with lock held)
+func (l *Limiter) refill(now time.Time) {
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// leaveInteractive removes an interactive waiter and wakes background requests
+// once none are left (must be called with lock held)
+func (l *Limiter) leaveInteractive() {
+	l.interactiveWaiting--
+	if l.interactiveWaiting == 0 {
+		close(l.idle)
+		l.idle = make(chan struct{})
+	}
+}
+
+// sleepOrWake waits for d to pass or wake to close, returning ctx's error if it is done first
+func sleepOrWake(ctx context.Context, d time.Duration, wake <-chan struct{}) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	case <-wake:
+	}
+	return nil
+}
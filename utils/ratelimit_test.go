@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitWithin reports whether l lets a request with priority p through within d
+func waitWithin(l *Limiter, p Priority, d time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return l.Wait(ctx, p) == nil
+}
+
+func TestLimiterAllowsBurstThenRate(t *testing.T) {
+	l := NewLimiter(10, 3)
+
+	for i := range 3 {
+		if !waitWithin(l, PriorityInteractive, 20*time.Millisecond) {
+			t.Fatalf("request %d of the burst was delayed", i+1)
+		}
+	}
+	if waitWithin(l, PriorityInteractive, 50*time.Millisecond) {
+		t.Fatal("request after the burst went through before a token accrued")
+	}
+
+	start := time.Now()
+	if err := l.Wait(context.Background(), PriorityInteractive); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited > 150*time.Millisecond {
+		t.Errorf("waited %s for the next token, want about 50ms", waited)
+	}
+}
+
+func TestLimiterKeepsReserveForInteractive(t *testing.T) {
+	l := NewLimiter(1, 4) // background requests leave 1 token
+
+	for i := range 3 {
+		if !waitWithin(l, PriorityBackground, 20*time.Millisecond) {
+			t.Fatalf("background request %d was delayed", i+1)
+		}
+	}
+	if waitWithin(l, PriorityBackground, 50*time.Millisecond) {
+		t.Error("background request took the interactive reserve")
+	}
+	if !waitWithin(l, PriorityInteractive, 20*time.Millisecond) {
+		t.Error("interactive request could not use the reserve")
+	}
+}
+
+func TestLimiterServesInteractiveFirst(t *testing.T) {
+	l := NewLimiter(20, 4)
+	l.Drain()
+
+	var (
+		mu    sync.Mutex
+		order []Priority
+		wg    sync.WaitGroup
+	)
+	wait := func(p Priority) {
+		if err := l.Wait(context.Background(), p); err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		order = append(order, p)
+		mu.Unlock()
+	}
+
+	// Background requests queue up first, then interactive ones arrive
+	for range 3 {
+		wg.Go(func() { wait(PriorityBackground) })
+	}
+	time.Sleep(10 * time.Millisecond)
+	for range 3 {
+		wg.Go(func() { wait(PriorityInteractive) })
+	}
+	wg.Wait()
+
+	want := []Priority{PriorityInteractive, PriorityInteractive, PriorityInteractive, PriorityBackground, PriorityBackground, PriorityBackground}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("served %v, want every interactive request before the background ones", order)
+		}
+	}
+}
+
+func TestLimiterWaitIsCancelled(t *testing.T) {
+	l := NewLimiter(0.1, 1)
+	l.Drain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, PriorityBackground); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The cancelled waiter no longer holds background requests back
+	if l.interactiveWaiting != 0 {
+		t.Errorf("%d interactive waiters left behind", l.interactiveWaiting)
+	}
+}
+
+func TestPriorityFrom(t *testing.T) {
+	ctx := context.Background()
+	if p := PriorityFrom(ctx); p != PriorityInteractive {
+		t.Errorf("default priority = %d, want interactive", p)
+	}
+	if p := PriorityFrom(WithPriority(ctx, PriorityBackground)); p != PriorityBackground {
+		t.Errorf("priority = %d, want background", p)
+	}
+}
+
+func TestGetJSONDrainsLimiterWhenRateLimited(t *testing.T) {
+	srv, requests := sequenceServer(t, respondStatus(http.StatusTooManyRequests, ""))
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := NewLimiter(1, 5)
+	client := fastClient(WithMaxAttempts(1), WithRateLimit(u.Host, l))
+
+	if err := client.GetJSON(context.Background(), srv.URL, &struct{}{}); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("GetJSON = %v, want ErrRateLimited", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+	if waitWithin(l, PriorityInteractive, 50*time.Millisecond) {
+		t.Error("limiter still had tokens after the upstream rate limited us")
+	}
+}
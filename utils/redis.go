@@ -0,0 +1,379 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"steam_bot/logattr"
+)
+
+// ----- Redis Client -----
+
+// ErrRedisUnavailable is returned without contacting Redis while it is considered down
+var ErrRedisUnavailable = errors.New("redis unavailable")
+
+// redisBreakerCooldown is how long commands fail fast after Redis stopped answering
+const redisBreakerCooldown = 10 * time.Second
+
+// RedisClient is a minimal Redis client speaking RESP2, with just the commands
+// the caches need. Connections are opened on demand and kept in a small pool.
+// Once a command can't reach the server, commands fail fast with
+// ErrRedisUnavailable for a cooldown, after which a single command probes it again.
+type RedisClient struct {
+	addr     string
+	username string
+	password string
+	db       int
+
+	timeout time.Duration // per command when the context has no deadline
+	idle    chan *redisConn
+
+	cooldown  time.Duration
+	mu        sync.Mutex
+	openUntil time.Time // zero while Redis is reachable
+	probing   bool      // a command is checking whether Redis is back
+}
+
+// RedisError is an error reply from the server
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewRedisClient creates a client for a redis://[user:password@]host[:port][/db] URL
+func NewRedisClient(rawURL string) (*RedisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis URL: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported redis URL scheme %q", u.Scheme)
+	}
+
+	client := &RedisClient{
+		addr:     u.Host,
+		timeout:  5 * time.Second,
+		idle:     make(chan *redisConn, 8),
+		cooldown: redisBreakerCooldown,
+	}
+	if u.Port() == "" {
+		client.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		client.password, _ = u.User.Password()
+		client.username = u.User.Username()
+		// redis://:password@host authenticates as the default user
+		if _, hasPassword := u.User.Password(); !hasPassword {
+			client.password, client.username = client.username, ""
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if client.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+
+	return client, nil
+}
+
+// Do sends a command and returns its reply: a string, []byte, int64, []any or nil.
+// Error replies are returned as RedisError.
+func (c *RedisClient) Do(ctx context.Context, args ...string) (any, error) {
+	if !c.allow() {
+		return nil, fmt.Errorf("redis %s: %w", args[0], ErrRedisUnavailable)
+	}
+
+	conn, err := c.get(ctx)
+	if err != nil {
+		c.record(err)
+		return nil, err
+	}
+
+	reply, err := c.roundTrip(ctx, conn, args)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection may be mid-reply; don't reuse it
+		conn.Close()
+		c.record(err)
+		return nil, fmt.Errorf("redis %s: %w", args[0], err)
+	}
+
+	c.record(nil)
+	c.put(conn)
+	return reply, err
+}
+
+// allow reports whether a command may be sent: always while Redis is reachable,
+// and for one probe at a time once the cooldown has passed
+func (c *RedisClient) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.openUntil.IsZero():
+		return true
+	case c.probing || time.Now().Before(c.openUntil):
+		return false
+	default:
+		c.probing = true
+		return true
+	}
+}
+
+// record updates the breaker with a command's outcome. Commands the caller
+// cancelled say nothing about the server.
+func (c *RedisClient) record(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.probing = false
+	switch {
+	case err == nil:
+		if !c.openUntil.IsZero() {
+			slog.Info("Redis is reachable again", "addr", c.addr)
+		}
+		c.openUntil = time.Time{}
+	case errors.Is(err, context.Canceled):
+	default:
+		if c.openUntil.IsZero() {
+			slog.Warn("Redis is unreachable, skipping it for a while", "addr", c.addr, "cooldown", c.cooldown, logattr.Error(err))
+		}
+		c.openUntil = time.Now().Add(c.cooldown)
+	}
+}
+
+// Get returns the value of key and whether it exists
+func (c *RedisClient) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis GET: unexpected reply %T", reply)
+	}
+	return value, true, nil
+}
+
+// Set stores value under key, expiring after ttl (never if ttl is 0)
+func (c *RedisClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del removes keys, returning how many existed
+func (c *RedisClient) Del(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	reply, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := reply.(int64)
+	return n, nil
+}
+
+// Scan calls fn with batches of keys matching pattern until the keyspace is exhausted
+func (c *RedisClient) Scan(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	cursor := "0"
+	for {
+		reply, err := c.Do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", "500")
+		if err != nil {
+			return err
+		}
+
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 2 {
+			return fmt.Errorf("redis SCAN: unexpected reply %v", reply)
+		}
+		next, _ := parts[0].([]byte)
+		items, _ := parts[1].([]any)
+
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			if key, ok := item.([]byte); ok {
+				keys = append(keys, string(key))
+			}
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// Ping checks that the server is reachable
+func (c *RedisClient) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Close closes all idle connections
+func (c *RedisClient) Close() error {
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// get takes an idle connection or dials a new one
+func (c *RedisClient) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+
+	var setup [][]string
+	if c.password != "" {
+		if c.username != "" {
+			setup = append(setup, []string{"AUTH", c.username, c.password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, args := range setup {
+		if _, err := c.roundTrip(ctx, conn, args); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis %s: %w", args[0], err)
+		}
+	}
+
+	return conn, nil
+}
+
+// put returns a healthy connection to the pool, closing it if the pool is full
+func (c *RedisClient) put(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// roundTrip writes one command and reads its reply, honouring ctx
+func (c *RedisClient) roundTrip(ctx context.Context, conn *redisConn, args []string) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(c.timeout)
+	}
+	conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+
+	// Unblock the read if ctx is cancelled before its deadline
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if err := writeCommand(conn.w, args); err != nil {
+		return nil, err
+	}
+	reply, err := readReply(conn.r)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return reply, err
+}
+
+// writeCommand encodes args as a RESP array of bulk strings
+func writeCommand(w *bufio.Writer, args []string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return w.Flush()
+}
+
+// readReply decodes one RESP reply
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply line")
+	}
+
+	switch prefix, rest := line[0], line[1:]; prefix {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, RedisError(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length %q", rest)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length %q", rest)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				var redisErr RedisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				items[i] = err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply type %q", prefix)
+	}
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"steam_bot/internal/fakeredis"
+)
+
+// startBlackHole accepts connections and never answers, like a hung Redis
+func startBlackHole(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// timedOut reports whether err comes from a command that was sent and got no answer
+func timedOut(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func getWithin(c *RedisClient, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	_, _, err := c.Get(ctx, "k")
+	return err
+}
+
+func TestRedisClientFailsFastWhileUnreachable(t *testing.T) {
+	c, err := NewRedisClient("redis://" + startBlackHole(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.cooldown = 100 * time.Millisecond
+
+	if err := getWithin(c, 50*time.Millisecond); !timedOut(err) {
+		t.Fatalf("first GET = %v, want it to time out", err)
+	}
+
+	start := time.Now()
+	if err := getWithin(c, time.Second); !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("GET during the cooldown = %v, want ErrRedisUnavailable", err)
+	}
+	if waited := time.Since(start); waited > 20*time.Millisecond {
+		t.Errorf("GET during the cooldown took %s, want no wait", waited)
+	}
+
+	// After the cooldown one probe is sent; it times out again and reopens the breaker
+	time.Sleep(150 * time.Millisecond)
+	if err := getWithin(c, 50*time.Millisecond); !timedOut(err) {
+		t.Errorf("probe = %v, want it sent and timed out", err)
+	}
+	if err := getWithin(c, time.Second); !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("GET after a failed probe = %v, want ErrRedisUnavailable", err)
+	}
+}
+
+func TestRedisClientSendsOneProbeAtATime(t *testing.T) {
+	c, err := NewRedisClient("redis://" + startBlackHole(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.openUntil = time.Now().Add(-time.Millisecond) // cooldown just passed
+
+	probe := make(chan error, 1)
+	go func() { probe <- getWithin(c, 100*time.Millisecond) }()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := getWithin(c, time.Second); !errors.Is(err, ErrRedisUnavailable) {
+		t.Errorf("GET during a probe = %v, want ErrRedisUnavailable", err)
+	}
+	if err := <-probe; !timedOut(err) {
+		t.Errorf("probe = %v, want it sent and timed out", err)
+	}
+}
+
+func TestRedisClientRecoversAfterCooldown(t *testing.T) {
+	srv, err := fakeredis.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	c, err := NewRedisClient(srv.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.openUntil = time.Now().Add(time.Hour)
+
+	if err := c.Ping(context.Background()); !errors.Is(err, ErrRedisUnavailable) {
+		t.Fatalf("Ping during the cooldown = %v, want ErrRedisUnavailable", err)
+	}
+
+	c.openUntil = time.Now().Add(-time.Millisecond)
+	for i := range 2 {
+		if err := c.Ping(context.Background()); err != nil {
+			t.Errorf("Ping %d after the cooldown = %v, want the breaker closed", i+1, err)
+		}
+	}
+}
+
+func TestRedisClientIgnoresCancelledCommands(t *testing.T) {
+	c, err := NewRedisClient("redis://" + startBlackHole(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, _, err := c.Get(ctx, "k"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GET = %v, want context.Canceled", err)
+	}
+
+	// The caller gave up; that says nothing about the server
+	if err := getWithin(c, 20*time.Millisecond); !timedOut(err) {
+		t.Errorf("next GET = %v, want it sent", err)
+	}
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"maps"
+	"strconv"
+	"sync"
+	"time"
+
+	"steam_bot/metrics"
+)
+
+// ----- Upstream Tracking -----
+
+// Upstream request metrics
+var (
+	upstreamRequests = metrics.NewCounterVec("steam_bot_upstream_requests_total",
+		"Requests to upstream APIs by host and HTTP status code (error if no response arrived)", "host", "code")
+	upstreamDuration = metrics.NewHistogramVec("steam_bot_upstream_request_duration_seconds",
+		"Time to the response headers of upstream API requests", metrics.LatencyBuckets, "host")
+)
+
+// UpstreamStatus is the outcome of the latest requests to one upstream host
+type UpstreamStatus struct {
+	LastSuccess time.Time // last answer other than a rate limit or server error
+	LastFailure time.Time
+	LastError   string // status code or "error" of the last failure
+}
+
+var (
+	upstreamMu       sync.Mutex
+	upstreamStatuses = make(map[string]UpstreamStatus)
+)
+
+// ObserveUpstream records a request to host that started at start and ended with code
+func ObserveUpstream(host, code string, start time.Time) {
+	upstreamRequests.Inc(host, code)
+	upstreamDuration.ObserveSince(start, host)
+
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+
+	status := upstreamStatuses[host]
+	if upstreamAnswered(code) {
+		status.LastSuccess = time.Now()
+	} else {
+		status.LastFailure = time.Now()
+		status.LastError = code
+	}
+	upstreamStatuses[host] = status
+}
+
+// UpstreamStatuses returns the status of every host requested so far
+func UpstreamStatuses() map[string]UpstreamStatus {
+	upstreamMu.Lock()
+	defer upstreamMu.Unlock()
+	return maps.Clone(upstreamStatuses)
+}
+
+// upstreamAnswered reports whether code means the upstream is up: not-found and other
+// client errors are valid answers, rate limits and server errors are not
+func upstreamAnswered(code string) bool {
+	status, err := strconv.Atoi(code)
+	return err == nil && status < 500 && status != 429
+}
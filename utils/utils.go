@@ -1,24 +0,0 @@
-package utils
-
-import (
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"time"
-)
-
-var httpClient = &http.Client{Timeout: 10 * time.Second}
-
-func HttpGetJSON(url string, target interface{}) error {
-	resp, err := httpClient.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to fetch URL %s: %w", url, err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received non-200 status code: %d for URL %s", resp.StatusCode, url)
-	}
-
-	return json.NewDecoder(resp.Body).Decode(target)
-}